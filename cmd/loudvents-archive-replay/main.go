@@ -0,0 +1,154 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// loudvents-archive-replay sends the events kept at LoudVentsChannel archives
+// to a channel address.
+//
+//	loudvents-archive-replay -dir /archive/ns/channel \
+//	  -target http://channel-kn-channel.ns.svc.cluster.local \
+//	  -from 2021-10-01T00:00:00Z -to 2021-10-02T00:00:00Z \
+//	  -filter type=com.example.order -rate 50
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"golang.org/x/time/rate"
+
+	"knative.dev/pkg/signals"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/archive"
+)
+
+// attributeFilters collects repeated name=value flags.
+type attributeFilters map[string]string
+
+func (a attributeFilters) String() string {
+	var s []string
+	for k, v := range a {
+		s = append(s, k+"="+v)
+	}
+	return strings.Join(s, ",")
+}
+
+func (a attributeFilters) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("expected name=value, got %q", value)
+	}
+	a[kv[0]] = kv[1]
+	return nil
+}
+
+func main() {
+	filters := attributeFilters{}
+	dir := flag.String("dir", "", "Directory containing the archive files, read recursively.")
+	target := flag.String("target", "", "Address of the LoudVentsChannel the events are sent to.")
+	from := flag.String("from", "", "Replay events with a time at or after this RFC3339 timestamp.")
+	to := flag.String("to", "", "Replay events with a time before this RFC3339 timestamp.")
+	eventsPerSecond := flag.Float64("rate", 10, "Maximum events sent per second, unlimited when 0.")
+	dryRun := flag.Bool("dry-run", false, "Print the selected events instead of sending them.")
+	flag.Var(filters, "filter", "Replay events whose attribute or extension equals the value, as name=value. Can be repeated.")
+	flag.Parse()
+
+	if *dir == "" || (*target == "" && !*dryRun) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f := archive.Filter{Attributes: filters}
+	var err error
+	if *from != "" {
+		if f.From, err = time.Parse(time.RFC3339, *from); err != nil {
+			log.Fatalf("Invalid from timestamp: %v", err)
+		}
+	}
+	if *to != "" {
+		if f.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			log.Fatalf("Invalid to timestamp: %v", err)
+		}
+	}
+
+	limit := rate.Inf
+	if *eventsPerSecond > 0 {
+		limit = rate.Limit(*eventsPerSecond)
+	}
+	limiter := rate.NewLimiter(limit, 1)
+
+	c, err := cloudevents.NewClientHTTP()
+	if err != nil {
+		log.Fatalf("Failed to create the CloudEvents client: %v", err)
+	}
+
+	ctx := signals.NewContext()
+	sendCtx := cloudevents.ContextWithTarget(ctx, *target)
+
+	files, err := archive.Files(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sent, failed := 0, 0
+	for _, file := range files {
+		// Files opened after the time range cannot contain selected events.
+		if t, err := archive.FileTime(file); err == nil && !f.To.IsZero() && !t.Before(f.To) {
+			continue
+		}
+
+		err := archive.ReadFile(file, f, func(e *event.Event) error {
+			if *dryRun {
+				fmt.Printf("%s\t%s\t%s\t%s\n", e.Time().Format(time.RFC3339Nano), e.Source(), e.ID(), e.Type())
+				sent++
+				return nil
+			}
+
+			if err := limiter.Wait(ctx); err != nil {
+				return err
+			}
+			if res := c.Send(sendCtx, *e); !cloudevents.IsACK(res) {
+				log.Printf("Failed to send event source=%s id=%s: %v", e.Source(), e.ID(), res)
+				failed++
+				return nil
+			}
+			sent++
+			return nil
+		})
+		if errors.Is(err, context.Canceled) {
+			break
+		}
+		if errors.Is(err, archive.ErrTruncated) {
+			log.Printf("Replayed the complete events of a truncated file: %v", err)
+			continue
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	log.Printf("Replayed %d events from %d files, %d failed", sent, len(files), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -28,6 +28,7 @@ var loudventCondSet = apis.NewLivingConditionSet(
 	LoudVentsChannelConditionAddressable,
 	LoudVentsChannelConditionChannelServiceReady,
 	LoudVentsChannelConditionDeadLetterSinkResolved,
+	LoudVentsChannelConditionDispatcherChannelLoaded,
 )
 
 const (
@@ -59,6 +60,11 @@ const (
 	// LoudVentsChannelConditionDeadLetterSinkResolved has status True when there is a Dead Letter Sink ref or URI
 	// defined in the Spec.Delivery, is a valid destination and its correctly resolved into a valid URI
 	LoudVentsChannelConditionDeadLetterSinkResolved apis.ConditionType = "DeadLetterSinkResolved"
+
+	// LoudVentsChannelConditionDispatcherChannelLoaded has status True when every dispatcher
+	// pod has loaded the latest generation of the channel, which means events sent to the
+	// channel are routed to its subscribers.
+	LoudVentsChannelConditionDispatcherChannelLoaded apis.ConditionType = "DispatcherChannelLoaded"
 )
 
 // GetConditionSet retrieves the condition set for this resource. Implements the KRShaped interface.
@@ -89,6 +95,29 @@ func (lvc *LoudVentsChannel) IsReady() bool {
 		lvc.GetConditionSet().Manage(&lvcs).IsHappy()
 }
 
+// IsReadyForDispatch returns true if the latest spec has been observed and
+// every condition other than LoudVentsChannelConditionDispatcherChannelLoaded
+// is true, which is when dispatchers load the channel.
+func (lvc *LoudVentsChannel) IsReadyForDispatch() bool {
+	lvcs := lvc.Status
+	if lvcs.ObservedGeneration != lvc.Generation {
+		return false
+	}
+	for _, t := range []apis.ConditionType{
+		LoudVentsChannelConditionDispatcherReady,
+		LoudVentsChannelConditionServiceReady,
+		LoudVentsChannelConditionEndpointsReady,
+		LoudVentsChannelConditionAddressable,
+		LoudVentsChannelConditionChannelServiceReady,
+		LoudVentsChannelConditionDeadLetterSinkResolved,
+	} {
+		if c := lvcs.GetCondition(t); c == nil || !c.IsTrue() {
+			return false
+		}
+	}
+	return true
+}
+
 // InitializeConditions sets relevant unset conditions to Unknown state.
 func (lvcs *LoudVentsChannelStatus) InitializeConditions() {
 	loudventCondSet.Manage(lvcs).InitializeConditions()
@@ -176,3 +205,18 @@ func (lvcs *LoudVentsChannelStatus) MarkDeadLetterSinkResolvedFailed(reason, mes
 	lvcs.DeadLetterSinkURI = nil
 	loudventCondSet.Manage(lvcs).MarkFalse(LoudVentsChannelConditionDeadLetterSinkResolved, reason, messageFormat, messageA...)
 }
+
+// MarkDispatcherChannelLoaded sets the condition that every dispatcher loaded the channel generation to True.
+func (lvcs *LoudVentsChannelStatus) MarkDispatcherChannelLoaded() {
+	loudventCondSet.Manage(lvcs).MarkTrue(LoudVentsChannelConditionDispatcherChannelLoaded)
+}
+
+// MarkDispatcherChannelNotLoaded sets the condition that every dispatcher loaded the channel generation to False.
+func (lvcs *LoudVentsChannelStatus) MarkDispatcherChannelNotLoaded(reason, messageFormat string, messageA ...interface{}) {
+	loudventCondSet.Manage(lvcs).MarkFalse(LoudVentsChannelConditionDispatcherChannelLoaded, reason, messageFormat, messageA...)
+}
+
+// MarkDispatcherChannelLoadedUnknown sets the condition that every dispatcher loaded the channel generation to Unknown.
+func (lvcs *LoudVentsChannelStatus) MarkDispatcherChannelLoadedUnknown(reason, messageFormat string, messageA ...interface{}) {
+	loudventCondSet.Manage(lvcs).MarkUnknown(LoudVentsChannelConditionDispatcherChannelLoaded, reason, messageFormat, messageA...)
+}
@@ -14,12 +14,17 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 	"knative.dev/pkg/apis"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
 	"knative.dev/pkg/kmeta"
+
+	"github.com/odacremolbap/loudvents/pkg/apis/messaging"
 )
 
 // +genclient
@@ -54,18 +59,591 @@ var (
 	_ duckv1.KRShaped = (*LoudVentsChannel)(nil)
 )
 
+// SchedulingWeightAnnotation is the annotation that sets the share of the
+// dispatcher delivery concurrency a channel gets, relative to the other
+// channels, when the dispatcher is saturated. It is a positive integer that
+// defaults to 1.
+const SchedulingWeightAnnotation = messaging.GroupName + "/scheduling-weight"
+
 // LoudVentsChannelSpec defines which subscribers have expressed interest in
 // receiving events from this LoudVentsChannel.
 // arguments for a Channel.
 type LoudVentsChannelSpec struct {
 	// Channel conforms to Duck type Channelable.
 	eventingduckv1.ChannelableSpec `json:",inline"`
+
+	// Dedup enables dropping events whose (source, id) pair has already
+	// been received by the channel.
+	// +optional
+	Dedup *DedupSpec `json:"dedup,omitempty"`
+
+	// Delay enables delayed delivery for events that carry the deliverat
+	// (RFC3339 timestamp) or deliverafter (duration) extensions.
+	// +optional
+	Delay *DelaySpec `json:"delay,omitempty"`
+
+	// TTL is the time after which events are no longer delivered to
+	// subscribers, counted from the event time attribute, or from the time
+	// the event was received when not present. It is checked before each
+	// delivery attempt. Subscriber options can override it.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// OnExpired is what happens to expired events. Defaults to Drop.
+	// +optional
+	OnExpired ExpiredPolicy `json:"onExpired,omitempty"`
+
+	// DeadLetterEnrichment adds extensions describing the delivery failure
+	// to events sent to dead letter sinks: the channel, subscriber URI,
+	// number of attempts and the first and last attempt times, along with
+	// the Knative knativeerrordest, knativeerrorcode and knativeerrordata
+	// extensions.
+	// +optional
+	DeadLetterEnrichment *DeadLetterEnrichmentSpec `json:"deadLetterEnrichment,omitempty"`
+
+	// Replay keeps the most recent events in the dispatcher memory so that
+	// they can be redelivered to individual subscribers.
+	// +optional
+	Replay *ReplaySpec `json:"replay,omitempty"`
+
+	// Webhook makes the channel accept requests that are not CloudEvents,
+	// wrapping their body into a CloudEvent.
+	// +optional
+	Webhook *WebhookSpec `json:"webhook,omitempty"`
+
+	// Archive writes every event that goes through the channel to rotated,
+	// compressed files at the dispatcher archive directory. Ignored when the
+	// dispatcher has no archive directory configured.
+	// +optional
+	Archive *ArchiveSpec `json:"archive,omitempty"`
+
+	// Validation makes the channel validate the data of incoming events
+	// against JSON schemas.
+	// +optional
+	Validation *ValidationSpec `json:"validation,omitempty"`
+
+	// Hops configures loop detection. Every delivery and reply increments
+	// the hopcount extension of events, and events that would exceed the
+	// maximum are not sent.
+	// +optional
+	Hops *HopsSpec `json:"hops,omitempty"`
+
+	// Bridges forward the channel events to other LoudVentsChannels, which
+	// receive them as if they were sent to their address. Events are never
+	// forwarded to a channel they already went through.
+	// +optional
+	Bridges []BridgeSpec `json:"bridges,omitempty"`
+
+	// Priority queues events in lanes chosen by their priority extension,
+	// an integer where 0 is the lowest priority. Lanes are served by
+	// weighted round robin starting at the highest one.
+	// +optional
+	Priority *PrioritySpec `json:"priority,omitempty"`
+
+	// MemoryBudget bounds the size of the event payloads the channel holds
+	// in memory while dispatching them, within the dispatcher memory budget.
+	// Events that do not fit after waiting briefly are refused with 429.
+	// +optional
+	MemoryBudget *resource.Quantity `json:"memoryBudget,omitempty"`
+
+	// SubscriberOptions customizes the delivery to individual subscribers.
+	// +optional
+	SubscriberOptions []SubscriberOptions `json:"subscriberOptions,omitempty"`
+
+	// Groups configures the delivery groups subscribers can join. Groups
+	// referenced by subscribers but not declared here use round robin.
+	// +optional
+	Groups []DeliveryGroup `json:"groups,omitempty"`
+}
+
+// DeliveryGroupStrategy selects the group member that receives each event.
+type DeliveryGroupStrategy string
+
+const (
+	// DeliveryGroupStrategyRoundRobin rotates events across group members.
+	DeliveryGroupStrategyRoundRobin DeliveryGroupStrategy = "RoundRobin"
+
+	// DeliveryGroupStrategyPartitionKey delivers events that share a
+	// partition key to the same group member.
+	DeliveryGroupStrategyPartitionKey DeliveryGroupStrategy = "PartitionKey"
+)
+
+// DeliveryGroup is a set of competing subscribers. Each event is delivered
+// to exactly one healthy member of the group, failing over to the next
+// member when delivery fails.
+type DeliveryGroup struct {
+	// Name of the group, referenced from subscriber options.
+	Name string `json:"name"`
+
+	// Strategy used to choose the member for each event. Defaults to RoundRobin.
+	// +optional
+	Strategy DeliveryGroupStrategy `json:"strategy,omitempty"`
+
+	// PartitionKey is the CloudEvent extension attribute hashed by the
+	// PartitionKey strategy. Defaults to partitionkey. Events without
+	// the attribute are delivered round robin.
+	// +optional
+	PartitionKey string `json:"partitionKey,omitempty"`
+}
+
+// SubscriberOptions are loudvents specific delivery options for a subscriber.
+type SubscriberOptions struct {
+	// SubscriptionUID identifies the subscription these options apply to,
+	// which tells apart subscriptions that deliver to the same URI.
+	// +optional
+	SubscriptionUID types.UID `json:"subscriptionUid,omitempty"`
+
+	// SubscriberURI identifies the subscribers these options apply to when
+	// SubscriptionUID is not set. It must match the URI of at least one of
+	// the channel subscribers.
+	// +optional
+	SubscriberURI *apis.URL `json:"subscriberUri,omitempty"`
+
+	// Transform modifies events before they are delivered to the subscriber.
+	// +optional
+	Transform *TransformSpec `json:"transform,omitempty"`
+
+	// Group makes the subscriber a member of a delivery group. Events are
+	// delivered to a single member of the group instead of to all of them.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// TTL overrides the channel TTL for the subscriber.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// OnExpired overrides the channel expired events policy for the subscriber.
+	// +optional
+	OnExpired ExpiredPolicy `json:"onExpired,omitempty"`
+
+	// ReplayFrom redelivers the events buffered by the channel to the
+	// subscriber, starting at this position. Events are replayed each time
+	// the position changes. Requires replay to be enabled for the channel.
+	// +optional
+	ReplayFrom *ReplayPosition `json:"replayFrom,omitempty"`
+
+	// Batch delivers events to the subscriber in batches using the
+	// CloudEvents JSON batch format.
+	// +optional
+	Batch *BatchSpec `json:"batch,omitempty"`
+
+	// ContentMode is the CloudEvents content mode events are sent to the
+	// subscriber with. Defaults to Passthrough.
+	// +optional
+	ContentMode ContentMode `json:"contentMode,omitempty"`
+
+	// ReplyContentMode is the content mode subscriber responses are sent to
+	// the reply with. Defaults to Passthrough.
+	// +optional
+	ReplyContentMode ContentMode `json:"replyContentMode,omitempty"`
+
+	// DeadLetterContentMode is the content mode events are sent to the dead
+	// letter sink with. Defaults to Passthrough.
+	// +optional
+	DeadLetterContentMode ContentMode `json:"deadLetterContentMode,omitempty"`
+
+	// Compression compresses the requests sent to the subscriber.
+	// +optional
+	Compression *CompressionSpec `json:"compression,omitempty"`
+}
+
+// CompressionEncoding is an HTTP content coding.
+type CompressionEncoding string
+
+const (
+	// CompressionEncodingGzip compresses using gzip.
+	CompressionEncodingGzip CompressionEncoding = "Gzip"
+
+	// CompressionEncodingDeflate compresses using deflate.
+	CompressionEncodingDeflate CompressionEncoding = "Deflate"
+)
+
+// CompressionSpec configures the compression of delivered requests.
+type CompressionSpec struct {
+	// Encoding is the content coding requests are compressed with.
+	// Defaults to Gzip.
+	// +optional
+	Encoding CompressionEncoding `json:"encoding,omitempty"`
+
+	// MinSize is the request body size from which requests are compressed.
+	// Defaults to 1Ki.
+	// +optional
+	MinSize *resource.Quantity `json:"minSize,omitempty"`
+}
+
+// ContentMode is a CloudEvents HTTP content mode.
+type ContentMode string
+
+const (
+	// ContentModeBinary sends event attributes as headers and data as body.
+	ContentModeBinary ContentMode = "Binary"
+
+	// ContentModeStructured sends the whole event encoded as JSON in the body.
+	ContentModeStructured ContentMode = "Structured"
+
+	// ContentModePassthrough keeps the content mode events were received with.
+	ContentModePassthrough ContentMode = "Passthrough"
+)
+
+// BatchSpec configures batched delivery. A batch is sent as soon as any of
+// the limits is reached.
+type BatchSpec struct {
+	// MaxSize is the number of events in a batch. Defaults to 100.
+	// +optional
+	MaxSize *int32 `json:"maxSize,omitempty"`
+
+	// MaxBytes is the size of the encoded batch. Defaults to 1Mi.
+	// +optional
+	MaxBytes *resource.Quantity `json:"maxBytes,omitempty"`
+
+	// MaxLinger is the time events wait for a batch to fill. Defaults to 1s.
+	// +optional
+	MaxLinger *metav1.Duration `json:"maxLinger,omitempty"`
+
+	// SplitOnFailure retries failed batches by halves, so that only the
+	// events that cannot be delivered are sent to the dead letter sink.
+	// +optional
+	SplitOnFailure bool `json:"splitOnFailure,omitempty"`
+}
+
+// ReplayPosition is the point a replay starts from. Events received at or
+// after the time, and with a sequence number equal or greater than the
+// sequence, are replayed.
+type ReplayPosition struct {
+	// +optional
+	Time *metav1.Time `json:"time,omitempty"`
+	// +optional
+	Sequence *int64 `json:"sequence,omitempty"`
+}
+
+// ExpiredPolicy defines what happens to events whose TTL elapsed before
+// being delivered.
+type ExpiredPolicy string
+
+const (
+	// ExpiredPolicyDrop discards expired events.
+	ExpiredPolicyDrop ExpiredPolicy = "Drop"
+
+	// ExpiredPolicyDeadLetter sends expired events to the subscriber dead
+	// letter sink with the deadletterreason extension set to expired, or
+	// drops them if there is none.
+	ExpiredPolicyDeadLetter ExpiredPolicy = "DeadLetter"
+)
+
+// PrioritySpec configures the priority lanes of a channel.
+type PrioritySpec struct {
+	// Lanes is the number of lanes, up to 10. Defaults to 3.
+	// +optional
+	Lanes *int32 `json:"lanes,omitempty"`
+
+	// Weights is the number of events served from each lane per round,
+	// starting at the lowest lane. Lanes without a weight use 2^lane.
+	// +optional
+	Weights []int32 `json:"weights,omitempty"`
+
+	// DefaultLane is the lane of events without a valid priority. Defaults to 0.
+	// +optional
+	DefaultLane *int32 `json:"defaultLane,omitempty"`
+
+	// Concurrency is the number of events dispatched at the same time.
+	// Events wait at their lane once it is reached. Defaults to 100.
+	// +optional
+	Concurrency *int32 `json:"concurrency,omitempty"`
+}
+
+// BridgeSpec forwards the events of a channel to another channel.
+type BridgeSpec struct {
+	// Channel is the LoudVentsChannel events are forwarded to.
+	Channel ChannelReference `json:"channel"`
+
+	// Filter selects the forwarded events by exact match of attributes and
+	// extensions, like Trigger filters do. An empty value matches any
+	// value. All events are forwarded when empty.
+	// +optional
+	Filter map[string]string `json:"filter,omitempty"`
+}
+
+// ChannelReference references a LoudVentsChannel.
+type ChannelReference struct {
+	// Namespace of the channel. Defaults to the namespace of the referring channel.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name of the channel.
+	Name string `json:"name"`
+}
+
+// HopsSpec configures the hop limit of a channel.
+type HopsSpec struct {
+	// Max is the highest hop count events can be sent with. Defaults to 32.
+	// +optional
+	Max *int32 `json:"max,omitempty"`
+
+	// OnExceeded is what happens to events that exceed the hop limit.
+	// Defaults to Drop.
+	// +optional
+	OnExceeded HopsExceededPolicy `json:"onExceeded,omitempty"`
+}
+
+// HopsExceededPolicy defines what happens to events that exceed the hop limit.
+type HopsExceededPolicy string
+
+const (
+	// HopsExceededPolicyDrop discards events that exceed the hop limit.
+	HopsExceededPolicyDrop HopsExceededPolicy = "Drop"
+
+	// HopsExceededPolicyDeadLetter sends events that exceed the hop limit to
+	// the subscriber dead letter sink with the deadletterreason extension
+	// set to hopsexceeded, or drops them if there is none. Events bridged to
+	// other channels are kept at the dispatcher local dead letter store
+	// instead, when enabled.
+	HopsExceededPolicyDeadLetter HopsExceededPolicy = "DeadLetter"
+)
+
+// TransformErrorPolicy defines what happens to an event that cannot be transformed.
+type TransformErrorPolicy string
+
+const (
+	// TransformErrorPolicySkip does not deliver the event to the subscriber.
+	TransformErrorPolicySkip TransformErrorPolicy = "Skip"
+
+	// TransformErrorPolicyDeadLetter sends the original event to the subscriber
+	// dead letter sink, or skips it if there is none.
+	TransformErrorPolicyDeadLetter TransformErrorPolicy = "DeadLetter"
+
+	// TransformErrorPolicyDeliverOriginal delivers the original event to the subscriber.
+	TransformErrorPolicyDeliverOriginal TransformErrorPolicy = "DeliverOriginal"
+)
+
+// TransformSpec declares the transformation applied to events for a
+// subscriber. Rules are either declared inline or read from a ConfigMap key
+// that contains them as a YAML or JSON document.
+type TransformSpec struct {
+	TransformRules `json:",inline"`
+
+	// ConfigMapKeyRef references a ConfigMap key in the channel namespace
+	// that contains the transformation rules. When set inline rules are ignored.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// OnError is the policy for events that cannot be transformed. Defaults to DeadLetter.
+	// +optional
+	OnError TransformErrorPolicy `json:"onError,omitempty"`
+}
+
+// TransformRules are the operations applied to an event, in order.
+type TransformRules struct {
+	// Attributes operations modify CloudEvent attributes and extensions.
+	// +optional
+	Attributes []AttributeOperation `json:"attributes,omitempty"`
+
+	// Data operations modify JSON event payloads.
+	// +optional
+	Data []DataOperation `json:"data,omitempty"`
+}
+
+// AttributeOperationType is an operation on a CloudEvent attribute.
+type AttributeOperationType string
+
+const (
+	// AttributeOperationSet sets the attribute to Value.
+	AttributeOperationSet AttributeOperationType = "Set"
+	// AttributeOperationRemove removes the attribute.
+	AttributeOperationRemove AttributeOperationType = "Remove"
+	// AttributeOperationRename moves the attribute value to the To attribute.
+	AttributeOperationRename AttributeOperationType = "Rename"
+)
+
+// AttributeOperation modifies a CloudEvent attribute or extension.
+type AttributeOperation struct {
+	Operation AttributeOperationType `json:"operation"`
+	// Name of the attribute.
+	Name string `json:"name"`
+	// Value for Set operations.
+	// +optional
+	Value string `json:"value,omitempty"`
+	// To is the new attribute name for Rename operations.
+	// +optional
+	To string `json:"to,omitempty"`
+}
+
+// DataOperationType is an operation on a JSON payload field.
+type DataOperationType string
+
+const (
+	// DataOperationSet sets the field to Value.
+	DataOperationSet DataOperationType = "Set"
+	// DataOperationDelete deletes the field.
+	DataOperationDelete DataOperationType = "Delete"
+	// DataOperationMove moves the field value to the To path.
+	DataOperationMove DataOperationType = "Move"
+)
+
+// DataOperation modifies a field of a JSON event payload. Fields are
+// referenced by a dot separated path of object keys.
+type DataOperation struct {
+	Operation DataOperationType `json:"operation"`
+	// Path of the field.
+	Path string `json:"path"`
+	// Value for Set operations, as a JSON value.
+	// +optional
+	Value *runtime.RawExtension `json:"value,omitempty"`
+	// To is the destination path for Move operations.
+	// +optional
+	To string `json:"to,omitempty"`
+}
+
+// DedupSpec configures duplicate event detection for a channel.
+// Remembered (source, id) pairs are always bounded by Size, the oldest
+// pair being forgotten when the limit is reached.
+type DedupSpec struct {
+	// Window is the amount of time a (source, id) pair is remembered.
+	// When not set pairs are only forgotten when Size is exceeded.
+	// +optional
+	Window *metav1.Duration `json:"window,omitempty"`
+
+	// Size is the maximum number of (source, id) pairs remembered.
+	// Defaults to 10000.
+	// +optional
+	Size *int32 `json:"size,omitempty"`
+}
+
+// DeadLetterEnrichmentSpec configures the failure metadata added to dead
+// lettered events.
+type DeadLetterEnrichmentSpec struct {
+	// MaxDataLength truncates the response body informed at the
+	// knativeerrordata extension. It cannot exceed 1024, which is the default.
+	// +optional
+	MaxDataLength *int32 `json:"maxDataLength,omitempty"`
+}
+
+// ReplaySpec configures the buffer of recent events kept by a channel.
+// Events are evicted when any of the limits is reached.
+type ReplaySpec struct {
+	// MaxEvents is the number of events kept.
+	// +optional
+	MaxEvents *int32 `json:"maxEvents,omitempty"`
+
+	// Retention is the time events are kept for.
+	// +optional
+	Retention *metav1.Duration `json:"retention,omitempty"`
+
+	// MaxMemory caps the memory used by the buffered events. Defaults to 64Mi.
+	// +optional
+	MaxMemory *resource.Quantity `json:"maxMemory,omitempty"`
+}
+
+// WebhookSpec configures how plain requests are wrapped into CloudEvents.
+// Attributes are Go templates that can refer to the request path as
+// {{ .Path }}, to its segments as {{ index .Segments 0 }}, and to request
+// headers as {{ header "X-Name" }}. The uuid function returns a random UUID.
+type WebhookSpec struct {
+	// Type of the wrapped events. Defaults to io.triggermesh.loudvents.webhook.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Source of the wrapped events. Defaults to the channel URI.
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// ID of the wrapped events. Defaults to a random UUID.
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// HeaderExtensions keeps the request headers as extensions, named after
+	// the lowercased header with the http prefix and without dashes.
+	// Credentials and transport headers are never kept.
+	// +optional
+	HeaderExtensions bool `json:"headerExtensions,omitempty"`
+}
+
+// ArchiveSpec configures the rotation of channel archive files.
+type ArchiveSpec struct {
+	// MaxFileSize is the uncompressed size after which archive files are
+	// rotated. Defaults to 100Mi.
+	// +optional
+	MaxFileSize *resource.Quantity `json:"maxFileSize,omitempty"`
+
+	// MaxFileAge is the time after which archive files are rotated.
+	// Defaults to 1 hour.
+	// +optional
+	MaxFileAge *metav1.Duration `json:"maxFileAge,omitempty"`
+}
+
+// DelaySpec configures delayed delivery for a channel.
+type DelaySpec struct {
+	// MaxDelay is the longest delay an event can request. Events requesting
+	// longer delays are rejected. Defaults to 24 hours.
+	// +optional
+	MaxDelay *metav1.Duration `json:"maxDelay,omitempty"`
+
+	// MaxPending is the number of delayed events the channel holds. Events
+	// requesting a delay while it is full are rejected. Defaults to 10000.
+	// +optional
+	MaxPending *int32 `json:"maxPending,omitempty"`
+}
+
+// ValidationMode defines what happens to events that fail validation.
+type ValidationMode string
+
+const (
+	// ValidationModeEnforce rejects invalid events, or routes them to the
+	// invalid events sink when one is configured.
+	ValidationModeEnforce ValidationMode = "Enforce"
+
+	// ValidationModeAudit logs and counts invalid events, which are then
+	// delivered as any other event.
+	ValidationModeAudit ValidationMode = "Audit"
+)
+
+// ValidationSpec configures JSON schema validation for a channel.
+type ValidationSpec struct {
+	// Mode is the validation mode. Defaults to Enforce.
+	// +optional
+	Mode ValidationMode `json:"mode,omitempty"`
+
+	// Schemas are the JSON schemas that incoming events data are validated
+	// against. Events that do not match any schema are not validated.
+	Schemas []EventSchema `json:"schemas"`
+
+	// InvalidEventsSink is the destination for events that fail validation
+	// in Enforce mode. When not set invalid events are rejected.
+	// +optional
+	InvalidEventsSink *duckv1.Destination `json:"invalidEventsSink,omitempty"`
+}
+
+// EventSchema is a JSON schema for the data of events with a given
+// CloudEvent type and dataschema. Exactly one of Inline or ConfigMapKeyRef
+// must be set. Schemas may only reference definitions within the document.
+type EventSchema struct {
+	// Type is the CloudEvent type this schema applies to. When empty the
+	// schema applies to any type.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// DataSchema is the CloudEvent dataschema this schema applies to. When
+	// empty the schema applies to any dataschema.
+	// +optional
+	DataSchema string `json:"dataschema,omitempty"`
+
+	// Inline is the JSON schema document.
+	// +optional
+	Inline *runtime.RawExtension `json:"inline,omitempty"`
+
+	// ConfigMapKeyRef references a ConfigMap key in the channel namespace
+	// that contains the JSON schema document.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
 }
 
 // LoudVentsChannelStatus represents the current state of a Channel.
 type LoudVentsChannelStatus struct {
 	// Channel conforms to Duck type ChannelableStatus.
 	eventingduckv1.ChannelableStatus `json:",inline"`
+
+	// InvalidEventsSinkURI is the resolved URI of the validation invalid events sink.
+	// +optional
+	InvalidEventsSinkURI *apis.URL `json:"invalidEventsSinkUri,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -0,0 +1,180 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// maxLineSize bounds the size of an archived event.
+const maxLineSize = 64 << 20
+
+// ErrTruncated is returned for archive files whose last event was not
+// completely written, after reading the events before it.
+var ErrTruncated = errors.New("archive file is truncated")
+
+// Filter selects archived events. Empty fields match any event.
+type Filter struct {
+	// From and To select the events whose time is in the [From, To) range.
+	// Events without a time attribute use the time their file was opened at.
+	From time.Time
+	To   time.Time
+	// Attributes must be equal to the event context attributes or extensions
+	// of the same name.
+	Attributes map[string]string
+}
+
+// Matches returns whether the event is selected by the filter. fallback is
+// the time used for events without a time attribute.
+func (f *Filter) Matches(e *event.Event, fallback time.Time) bool {
+	t := e.Time()
+	if t.IsZero() {
+		t = fallback
+	}
+	if (!f.From.IsZero() && t.Before(f.From)) || (!f.To.IsZero() && !t.Before(f.To)) {
+		return false
+	}
+
+	for name, value := range f.Attributes {
+		v, ok := attribute(e, name)
+		if !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// attribute returns the string value of a context attribute or extension.
+func attribute(e *event.Event, name string) (string, bool) {
+	switch name {
+	case "specversion":
+		return e.SpecVersion(), true
+	case "id":
+		return e.ID(), true
+	case "type":
+		return e.Type(), true
+	case "source":
+		return e.Source(), true
+	case "subject":
+		return e.Subject(), e.Subject() != ""
+	case "datacontenttype":
+		return e.DataContentType(), e.DataContentType() != ""
+	case "dataschema":
+		return e.DataSchema(), e.DataSchema() != ""
+	}
+	v, ok := e.Extensions()[name]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// Files returns the complete archive files under dir, recursively, in the
+// order they were written for each directory.
+func Files(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, FileExtension) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing archive files: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// FileTime returns the time the archive file was opened at, parsed from its name.
+func FileTime(path string) (time.Time, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "events-"), FileExtension)
+	t, err := time.Parse(fileTimeLayout, name)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected archive file name %q: %w", path, err)
+	}
+	return t, nil
+}
+
+// ReadFile calls fn for each event in the archive file that matches the
+// filter, in the order they were written. Reading stops at the first error
+// returned by fn. Files whose last event is incomplete return ErrTruncated.
+func ReadFile(path string, f Filter, fn func(*event.Event) error) error {
+	fallback, err := FileTime(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening archive file: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("reading archive file %s: %w", path, err)
+	}
+	defer gz.Close()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	// A line that cannot be decoded is only an error when followed by more
+	// lines, otherwise it is the truncated last event.
+	var decodeErr error
+	for n := 1; scanner.Scan(); n++ {
+		if decodeErr != nil {
+			return decodeErr
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		e := &event.Event{}
+		if err := json.Unmarshal(line, e); err != nil {
+			decodeErr = fmt.Errorf("decoding event at %s:%d: %w", path, n, err)
+			continue
+		}
+		if !f.Matches(e, fallback) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	err = scanner.Err()
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF), err == nil && decodeErr != nil:
+		return fmt.Errorf("%w: %s", ErrTruncated, path)
+	case err != nil:
+		return fmt.Errorf("reading archive file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/go-cmp/cmp"
+)
+
+// readAll returns the IDs of the events in the files that match the filter.
+func readAll(t *testing.T, files []string, f Filter) []string {
+	ids := []string{}
+	for _, file := range files {
+		if err := ReadFile(file, f, func(e *event.Event) error {
+			ids = append(ids, e.ID())
+			return nil
+		}); err != nil {
+			t.Fatalf("Unexpected error reading %s: %v", file, err)
+		}
+	}
+	return ids
+}
+
+// writeFile writes an archive file opened at the time with the lines,
+// returning its path. The gzip stream is not completed when truncated.
+func writeFile(t *testing.T, opened time.Time, lines []string, truncated bool) string {
+	path := filepath.Join(t.TempDir(), "events-"+opened.UTC().Format(fileTimeLayout)+FileExtension)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Unexpected error creating file: %v", err)
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	for _, l := range lines {
+		if _, err := gz.Write([]byte(l)); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+	}
+	if truncated {
+		err = gz.Flush()
+	} else {
+		err = gz.Close()
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+	return path
+}
+
+func eventLine(t *testing.T, e *event.Event) string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("Unexpected error encoding event: %v", err)
+	}
+	return string(b) + "\n"
+}
+
+func TestReadRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir, Config{MaxFileSize: 300})
+	if err != nil {
+		t.Fatalf("Unexpected error creating writer: %v", err)
+	}
+
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	var written []*event.Event
+	for i := 0; i < 5; i++ {
+		e := newEvent(string(rune('0'+i)), "a", now.Add(time.Duration(i)*time.Minute))
+		if err := w.Write(e); err != nil {
+			t.Fatalf("Unexpected error writing event: %v", err)
+		}
+		written = append(written, e)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error closing writer: %v", err)
+	}
+
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error listing files: %v", err)
+	}
+	var read []*event.Event
+	for _, file := range files {
+		if err := ReadFile(file, Filter{}, func(e *event.Event) error {
+			read = append(read, e)
+			return nil
+		}); err != nil {
+			t.Fatalf("Unexpected error reading %s: %v", file, err)
+		}
+	}
+
+	if len(read) != len(written) {
+		t.Fatalf("Expected %d events read, got %d", len(written), len(read))
+	}
+	for i := range written {
+		if diff := cmp.Diff(eventLine(t, written[i]), eventLine(t, read[i])); diff != "" {
+			t.Errorf("Unexpected event %d (-written, +read):\n%s", i, diff)
+		}
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	opened := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	first := eventLine(t, newEvent("1", "a", opened))
+	second := eventLine(t, newEvent("2", "a", opened))
+	third := eventLine(t, newEvent("3", "a", opened))
+
+	testCases := map[string]struct {
+		lines     []string
+		truncated bool
+		wantIDs   []string
+		wantErr   error
+	}{
+		"complete": {
+			lines:   []string{first, second, third},
+			wantIDs: []string{"1", "2", "3"},
+		},
+		"incomplete last event": {
+			lines:   []string{first, second, third[:len(third)/2]},
+			wantIDs: []string{"1", "2"},
+			wantErr: ErrTruncated,
+		},
+		"incomplete gzip stream": {
+			lines:     []string{first, second, third[:len(third)/2]},
+			truncated: true,
+			wantIDs:   []string{"1", "2"},
+			wantErr:   ErrTruncated,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := writeFile(t, opened, tc.lines, tc.truncated)
+
+			ids := []string{}
+			err := ReadFile(path, Filter{}, func(e *event.Event) error {
+				ids = append(ids, e.ID())
+				return nil
+			})
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if diff := cmp.Diff(tc.wantIDs, ids); diff != "" {
+				t.Errorf("Unexpected events read (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadCorrupted(t *testing.T) {
+	opened := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	path := writeFile(t, opened, []string{
+		eventLine(t, newEvent("1", "a", opened)),
+		"{not an event\n",
+		eventLine(t, newEvent("3", "a", opened)),
+	}, false)
+
+	err := ReadFile(path, Filter{}, func(*event.Event) error { return nil })
+	if err == nil || errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected a decoding error for an event followed by others, got %v", err)
+	}
+}
+
+func TestReadFilter(t *testing.T) {
+	opened := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	untimed := newEvent("untimed", "b", time.Time{})
+	other := newEvent("other-tenant", "a", opened.Add(2*time.Minute))
+	other.SetExtension("tenant", "b")
+
+	path := writeFile(t, opened, []string{
+		eventLine(t, newEvent("1", "a", opened.Add(time.Minute))),
+		eventLine(t, newEvent("2", "b", opened.Add(2*time.Minute))),
+		eventLine(t, other),
+		eventLine(t, newEvent("3", "a", opened.Add(3*time.Minute))),
+		eventLine(t, untimed),
+	}, false)
+
+	testCases := map[string]struct {
+		filter  Filter
+		wantIDs []string
+	}{
+		"all events": {
+			wantIDs: []string{"1", "2", "other-tenant", "3", "untimed"},
+		},
+		"time range": {
+			filter:  Filter{From: opened.Add(2 * time.Minute), To: opened.Add(3 * time.Minute)},
+			wantIDs: []string{"2", "other-tenant"},
+		},
+		"events without time use the file time": {
+			filter:  Filter{To: opened.Add(time.Second)},
+			wantIDs: []string{"untimed"},
+		},
+		"type": {
+			filter:  Filter{Attributes: map[string]string{"type": "a"}},
+			wantIDs: []string{"1", "other-tenant", "3"},
+		},
+		"type and extension": {
+			filter:  Filter{Attributes: map[string]string{"type": "a", "tenant": "a"}},
+			wantIDs: []string{"1", "3"},
+		},
+		"missing attribute": {
+			filter:  Filter{Attributes: map[string]string{"subject": "orders"}},
+			wantIDs: []string{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.wantIDs, readAll(t, []string{path}, tc.filter)); diff != "" {
+				t.Errorf("Unexpected events read (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
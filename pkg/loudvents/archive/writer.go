@@ -0,0 +1,185 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package archive writes the events that go through a channel to rotated,
+// gzip compressed files of CloudEvents JSON lines, and reads them back.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+const (
+	// DefaultMaxFileSize is the uncompressed file size used when not configured.
+	DefaultMaxFileSize = 100 << 20
+	// DefaultMaxFileAge is the file age used when not configured.
+	DefaultMaxFileAge = time.Hour
+
+	// FileExtension is the extension of complete archive files.
+	FileExtension = ".jsonl.gz"
+	// openExtension is appended to the file being written until rotated.
+	openExtension = ".open"
+
+	// fileTimeLayout formats the time a file was opened at into its name,
+	// so that names sort in the order files were written.
+	fileTimeLayout = "20060102T150405.000000000Z"
+)
+
+// Config for archive file rotation. Files are rotated when either limit
+// is reached.
+type Config struct {
+	// MaxFileSize is the uncompressed size of the events written to a file.
+	MaxFileSize int64 `json:"maxFileSize"`
+	// MaxFileAge is the time a file is written to.
+	MaxFileAge time.Duration `json:"maxFileAge"`
+}
+
+// Writer appends events to the archive files at a directory.
+type Writer struct {
+	dir string
+	cfg Config
+
+	mu     sync.Mutex
+	file   *os.File
+	gz     *gzip.Writer
+	buf    *bufio.Writer
+	name   string
+	size   int64
+	timer  *time.Timer
+	closed bool
+
+	// overridable for testing
+	now func() time.Time
+}
+
+// NewWriter creates a Writer at dir. Files are only created once events
+// are written.
+func NewWriter(dir string, cfg Config) (*Writer, error) {
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = DefaultMaxFileSize
+	}
+	if cfg.MaxFileAge <= 0 {
+		cfg.MaxFileAge = DefaultMaxFileAge
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating archive directory: %w", err)
+	}
+
+	return &Writer{
+		dir: dir,
+		cfg: cfg,
+		now: time.Now,
+	}, nil
+}
+
+// Write appends the event to the current archive file, rotating it when full.
+func (w *Writer) Write(e *event.Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return fmt.Errorf("archive at %s is closed", w.dir)
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.buf.Write(line); err != nil {
+		return fmt.Errorf("writing archive file: %w", err)
+	}
+	w.size += int64(len(line))
+
+	if w.size >= w.cfg.MaxFileSize {
+		return w.rotate()
+	}
+	return nil
+}
+
+// Close completes the current archive file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	return w.rotate()
+}
+
+// open creates a new archive file. Must be called with the lock held.
+func (w *Writer) open() error {
+	w.name = filepath.Join(w.dir, "events-"+w.now().UTC().Format(fileTimeLayout)+FileExtension)
+	f, err := os.OpenFile(w.name+openExtension, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("creating archive file: %w", err)
+	}
+
+	w.file = f
+	w.gz = gzip.NewWriter(f)
+	w.buf = bufio.NewWriter(w.gz)
+	w.size = 0
+
+	file := f
+	w.timer = time.AfterFunc(w.cfg.MaxFileAge, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		// The file might have been rotated by size meanwhile.
+		if w.file == file {
+			_ = w.rotate()
+		}
+	})
+	return nil
+}
+
+// rotate completes the current archive file, if any. Must be called with
+// the lock held.
+func (w *Writer) rotate() error {
+	if w.file == nil {
+		return nil
+	}
+	w.timer.Stop()
+
+	f := w.file
+	w.file = nil
+
+	if err := w.buf.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing archive file: %w", err)
+	}
+	if err := w.gz.Close(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing archive file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing archive file: %w", err)
+	}
+	if err := os.Rename(f.Name(), w.name); err != nil {
+		return fmt.Errorf("completing archive file: %w", err)
+	}
+	return nil
+}
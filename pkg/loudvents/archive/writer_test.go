@@ -0,0 +1,111 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+func newEvent(id, typ string, t time.Time) *event.Event {
+	e := event.New()
+	e.SetID(id)
+	e.SetType(typ)
+	e.SetSource("test")
+	e.SetTime(t)
+	e.SetExtension("tenant", "a")
+	_ = e.SetData(event.ApplicationJSON, map[string]string{"id": id})
+	return &e
+}
+
+func TestWriteAndRead(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir, Config{MaxFileSize: 300})
+	if err != nil {
+		t.Fatalf("Unexpected error creating writer: %v", err)
+	}
+
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	clock := now
+	w.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	for i, typ := range []string{"a", "b", "a", "b", "a", "b"} {
+		if err := w.Write(newEvent(string(rune('0'+i)), typ, now.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatalf("Unexpected error writing event: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error closing writer: %v", err)
+	}
+
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error listing files: %v", err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("Expected files to be rotated by size, got %d files", len(files))
+	}
+
+	var ids []string
+	f := Filter{
+		From:       now.Add(time.Minute),
+		To:         now.Add(5 * time.Minute),
+		Attributes: map[string]string{"type": "a", "tenant": "a"},
+	}
+	for _, file := range files {
+		if err := ReadFile(file, f, func(e *event.Event) error {
+			ids = append(ids, e.ID())
+			return nil
+		}); err != nil {
+			t.Fatalf("Unexpected error reading %s: %v", file, err)
+		}
+	}
+
+	if len(ids) != 2 || ids[0] != "2" || ids[1] != "4" {
+		t.Errorf("Expected events 2 and 4, got %v", ids)
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir, Config{MaxFileAge: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error creating writer: %v", err)
+	}
+	defer w.Close()
+
+	if err := w.Write(newEvent("1", "a", time.Now())); err != nil {
+		t.Fatalf("Unexpected error writing event: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		files, err := Files(dir)
+		if err != nil {
+			t.Fatalf("Unexpected error listing files: %v", err)
+		}
+		if len(files) == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the file to be completed once expired")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
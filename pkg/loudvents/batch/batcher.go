@@ -0,0 +1,199 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package batch groups events into batches encoded using the CloudEvents
+// JSON batch format.
+package batch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	nethttp "net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+const (
+	// ContentType is the media type of JSON encoded batches.
+	ContentType = "application/cloudevents-batch+json"
+
+	// Defaults used when limits are not configured.
+	DefaultMaxSize   = 100
+	DefaultMaxBytes  = 1 << 20
+	DefaultMaxLinger = time.Second
+)
+
+// Config for batching. A batch is flushed as soon as any limit is reached.
+type Config struct {
+	MaxSize        int           `json:"maxSize"`
+	MaxBytes       int64         `json:"maxBytes"`
+	MaxLinger      time.Duration `json:"maxLinger"`
+	SplitOnFailure bool          `json:"splitOnFailure,omitempty"`
+}
+
+// Item is an event waiting to be delivered in a batch.
+type Item struct {
+	Event   *event.Event
+	Headers nethttp.Header
+	// Expires is the time after which the event should not be delivered,
+	// zero when it never expires.
+	Expires time.Time
+	// Release frees the resources held for the event until its batch is
+	// delivered, nil when there are none.
+	Release func()
+
+	encoded json.RawMessage
+}
+
+// Encode returns the items as a JSON batch.
+func Encode(items []Item) []byte {
+	size := 2
+	for _, it := range items {
+		size += len(it.encoded) + 1
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	buf.WriteByte('[')
+	for i, it := range items {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(it.encoded)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// Batcher accumulates items, handing them over to the flush function in
+// batches, in the order they were added.
+type Batcher struct {
+	cfg   Config
+	flush func([]Item)
+
+	mu    sync.Mutex
+	items []Item
+	bytes int64
+	timer *time.Timer
+	// batch identifies the current batch for its linger timer.
+	batch  uint64
+	closed bool
+}
+
+// NewBatcher creates a Batcher. The flush function is called from its own
+// goroutine for each batch.
+func NewBatcher(cfg Config, flush func([]Item)) *Batcher {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultMaxSize
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBytes
+	}
+	if cfg.MaxLinger <= 0 {
+		cfg.MaxLinger = DefaultMaxLinger
+	}
+	return &Batcher{
+		cfg:   cfg,
+		flush: flush,
+	}
+}
+
+// Config returns the batcher configuration.
+func (b *Batcher) Config() Config {
+	return b.cfg
+}
+
+// Add appends the item to the current batch.
+func (b *Batcher) Add(it Item) error {
+	encoded, err := json.Marshal(it.Event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	it.encoded = encoded
+	size := int64(len(encoded)) + 1
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return fmt.Errorf("batcher is closed")
+	}
+
+	// Events that would make the batch exceed its size go to the next one.
+	// Events larger than the limit are sent in a batch of their own.
+	if len(b.items) > 0 && b.bytes+size > b.cfg.MaxBytes {
+		b.release()
+	}
+
+	b.items = append(b.items, it)
+	b.bytes += size
+	if len(b.items) == 1 {
+		batch := b.batch
+		b.timer = time.AfterFunc(b.cfg.MaxLinger, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			// The batch might have been released meanwhile.
+			if b.batch == batch {
+				b.release()
+			}
+		})
+	}
+
+	if len(b.items) >= b.cfg.MaxSize || b.bytes >= b.cfg.MaxBytes {
+		b.release()
+	}
+	return nil
+}
+
+// Close flushes the pending items, waiting for the flush to finish. Items
+// cannot be added once closed.
+func (b *Batcher) Close() {
+	b.mu.Lock()
+	b.closed = true
+	items := b.take()
+	b.mu.Unlock()
+
+	if len(items) > 0 {
+		b.flush(items)
+	}
+}
+
+// release flushes the current batch. Must be called with the lock held.
+func (b *Batcher) release() {
+	if items := b.take(); len(items) > 0 {
+		go b.flush(items)
+	}
+}
+
+// take returns the current batch, starting a new one. Must be called with
+// the lock held.
+func (b *Batcher) take() []Item {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	items := b.items
+	b.items = nil
+	b.bytes = 0
+	b.batch++
+	return items
+}
+
+// Len returns the number of items waiting in the current batch.
+func (b *Batcher) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.items)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package batch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+func newItem(id string) Item {
+	e := event.New()
+	e.SetID(id)
+	e.SetType("test.type")
+	e.SetSource("test")
+	return Item{Event: &e}
+}
+
+func collect(t *testing.T, cfg Config, ids ...string) [][]Item {
+	t.Helper()
+
+	batches := make(chan []Item, len(ids))
+	b := NewBatcher(cfg, func(items []Item) { batches <- items })
+	for _, id := range ids {
+		if err := b.Add(newItem(id)); err != nil {
+			t.Fatalf("Unexpected error adding item: %v", err)
+		}
+	}
+
+	var got [][]Item
+	count := 0
+	timeout := time.After(5 * time.Second)
+	for count < len(ids) {
+		select {
+		case items := <-batches:
+			got = append(got, items)
+			count += len(items)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for batches, got %d of %d items", count, len(ids))
+		}
+	}
+	return got
+}
+
+func TestBatcherMaxSize(t *testing.T) {
+	got := collect(t, Config{MaxSize: 2, MaxLinger: time.Hour}, "1", "2", "3", "4")
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 batches, got %d", len(got))
+	}
+	for _, items := range got {
+		if len(items) != 2 {
+			t.Errorf("Expected batches of 2 items, got %d", len(items))
+		}
+	}
+}
+
+func TestBatcherMaxBytes(t *testing.T) {
+	encoded, err := json.Marshal(newItem("1").Event)
+	if err != nil {
+		t.Fatalf("Unexpected error encoding event: %v", err)
+	}
+	// Room for two events and their separators.
+	maxBytes := 2*int64(len(encoded)+1) + 1
+	got := collect(t, Config{MaxSize: 10, MaxBytes: maxBytes, MaxLinger: 10 * time.Millisecond}, "1", "2", "3")
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 batches, got %d", len(got))
+	}
+}
+
+func TestBatcherMaxLinger(t *testing.T) {
+	got := collect(t, Config{MaxSize: 10, MaxLinger: 10 * time.Millisecond}, "1", "2")
+	if len(got) != 1 || len(got[0]) != 2 {
+		t.Fatalf("Expected a single batch of 2 items, got %v", got)
+	}
+}
+
+func TestBatcherClose(t *testing.T) {
+	var got []Item
+	b := NewBatcher(Config{MaxLinger: time.Hour}, func(items []Item) { got = items })
+	for _, id := range []string{"1", "2"} {
+		if err := b.Add(newItem(id)); err != nil {
+			t.Fatalf("Unexpected error adding item: %v", err)
+		}
+	}
+	b.Close()
+
+	if len(got) != 2 {
+		t.Fatalf("Expected pending items to be flushed on close, got %d", len(got))
+	}
+	if err := b.Add(newItem("3")); err == nil {
+		t.Error("Expected an error adding items once closed")
+	}
+
+	var events []event.Event
+	if err := json.Unmarshal(Encode(got), &events); err != nil {
+		t.Fatalf("Unexpected error decoding batch: %v", err)
+	}
+	if len(events) != 2 || events[0].ID() != "1" || events[1].ID() != "2" {
+		t.Errorf("Unexpected batch contents: %v", events)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bridge selects the events forwarded from a channel to another,
+// keeping track of the channels each event went through so that they are
+// never forwarded in a loop.
+package bridge
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+
+	"knative.dev/eventing/pkg/eventfilter"
+	"knative.dev/eventing/pkg/eventfilter/attributes"
+)
+
+// PathExtension lists the channels an event was bridged from, as comma
+// separated namespace/name pairs.
+const PathExtension = "bridgepath"
+
+const pathSeparator = ","
+
+// Config for a bridge to a channel.
+type Config struct {
+	// Channel is the namespace/name of the target channel.
+	Channel string `json:"channel"`
+	// HostName is the host of the target channel address, which identifies
+	// its handler at the dispatcher.
+	HostName string `json:"hostName"`
+	// Filter selects the forwarded events by exact match of attributes and
+	// extensions, empty values matching any value. All events are
+	// forwarded when empty.
+	Filter map[string]string `json:"filter,omitempty"`
+}
+
+// Matches returns whether the event is selected by the bridge filter.
+func (c *Config) Matches(ctx context.Context, e *event.Event) bool {
+	if len(c.Filter) == 0 {
+		return true
+	}
+	return attributes.NewAttributesFilter(c.Filter).Filter(ctx, *e) != eventfilter.FailFilter
+}
+
+// Path returns the channels the event was bridged from, in order.
+func Path(e *event.Event) []string {
+	v, ok := e.Extensions()[PathExtension].(string)
+	if !ok || v == "" {
+		return nil
+	}
+	return strings.Split(v, pathSeparator)
+}
+
+// Visited returns whether the event went through the channel, either
+// because it was bridged from it or because it is the channel it is at.
+func Visited(e *event.Event, current, channel string) bool {
+	if channel == current {
+		return true
+	}
+	for _, c := range Path(e) {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// AppendPath adds the channel the event is being bridged from to its path.
+func AppendPath(e *event.Event, channel string) {
+	e.SetExtension(PathExtension, strings.Join(append(Path(e), channel), pathSeparator))
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+func newEvent() *event.Event {
+	e := event.New()
+	e.SetID("1")
+	e.SetType("test.type")
+	e.SetSource("test")
+	e.SetExtension("region", "eu")
+	return &e
+}
+
+func TestMatches(t *testing.T) {
+	testCases := map[string]struct {
+		filter map[string]string
+		want   bool
+	}{
+		"No filter": {
+			want: true,
+		},
+		"Attribute": {
+			filter: map[string]string{"type": "test.type"},
+			want:   true,
+		},
+		"Extension": {
+			filter: map[string]string{"type": "test.type", "region": "eu"},
+			want:   true,
+		},
+		"Any value": {
+			filter: map[string]string{"region": ""},
+			want:   true,
+		},
+		"Different value": {
+			filter: map[string]string{"region": "us"},
+		},
+		"Missing extension": {
+			filter: map[string]string{"tenant": "a"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{Filter: tc.filter}
+			if got := c.Matches(context.Background(), newEvent()); got != tc.want {
+				t.Errorf("Expected match %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	e := newEvent()
+	if Path(e) != nil {
+		t.Fatalf("Expected an empty path, got %v", Path(e))
+	}
+
+	AppendPath(e, "ns/a")
+	AppendPath(e, "ns/b")
+	if got := e.Extensions()[PathExtension]; got != "ns/a,ns/b" {
+		t.Errorf("Unexpected path extension %v", got)
+	}
+
+	testCases := map[string]struct {
+		current string
+		channel string
+		want    bool
+	}{
+		"Bridged from":    {current: "ns/c", channel: "ns/a", want: true},
+		"Current channel": {current: "ns/c", channel: "ns/c", want: true},
+		"Not visited":     {current: "ns/c", channel: "other/a"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := Visited(e, tc.current, tc.channel); got != tc.want {
+				t.Errorf("Expected visited %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package budget bounds the memory used by the payloads of events in flight.
+// Budgets can be nested, a reservation at a budget being also made at its
+// parent, so that channels can have their own share of the dispatcher budget.
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrTooLarge is returned for reservations that exceed the budget limit,
+// and can never be satisfied.
+var ErrTooLarge = errors.New("payload exceeds the memory budget")
+
+// ExhaustedError is returned when a reservation cannot be made before the
+// context is done.
+type ExhaustedError struct {
+	// Budget is the budget that had not enough room for the reservation.
+	Budget *Budget
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("%s memory budget exhausted", e.Budget.name)
+}
+
+// Budget is a number of bytes that can be reserved.
+type Budget struct {
+	name   string
+	limit  int64
+	parent *Budget
+
+	mu   sync.Mutex
+	used int64
+	// freed is closed when bytes are released, to wake up waiting reservations.
+	freed chan struct{}
+}
+
+// New creates a budget of limit bytes, unbounded when not positive. Reservations
+// are also made at the parent budget, if any.
+func New(name string, limit int64, parent *Budget) *Budget {
+	return &Budget{
+		name:   name,
+		limit:  limit,
+		parent: parent,
+		freed:  make(chan struct{}),
+	}
+}
+
+// Limit returns the budget limit, not positive when unbounded.
+func (b *Budget) Limit() int64 {
+	return b.limit
+}
+
+// Parent returns the budget reservations are also made at, if any.
+func (b *Budget) Parent() *Budget {
+	return b.parent
+}
+
+// Used returns the bytes currently reserved.
+func (b *Budget) Used() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// Acquire reserves n bytes at the budget and its parents, waiting for room
+// until the context is done. It returns the function that releases them.
+func (b *Budget) Acquire(ctx context.Context, n int64) (func(), error) {
+	for {
+		full, freed, err := b.tryAcquire(n)
+		if err != nil {
+			return nil, err
+		}
+		if full == nil {
+			var once sync.Once
+			return func() { once.Do(func() { b.release(n) }) }, nil
+		}
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, &ExhaustedError{Budget: full}
+		}
+	}
+}
+
+// tryAcquire reserves n bytes at the budget and its parents, or none of them.
+// When there is not enough room it returns the full budget and the channel
+// closed once it releases bytes.
+func (b *Budget) tryAcquire(n int64) (*Budget, <-chan struct{}, error) {
+	b.mu.Lock()
+	if b.limit > 0 {
+		if n > b.limit {
+			b.mu.Unlock()
+			return nil, nil, ErrTooLarge
+		}
+		if b.used+n > b.limit {
+			freed := b.freed
+			b.mu.Unlock()
+			return b, freed, nil
+		}
+	}
+	b.used += n
+	b.mu.Unlock()
+
+	if b.parent == nil {
+		return nil, nil, nil
+	}
+	full, freed, err := b.parent.tryAcquire(n)
+	if err != nil || full != nil {
+		b.releaseLocal(n)
+	}
+	return full, freed, err
+}
+
+func (b *Budget) release(n int64) {
+	b.releaseLocal(n)
+	if b.parent != nil {
+		b.parent.release(n)
+	}
+}
+
+func (b *Budget) releaseLocal(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package budget
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func shortContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestAcquire(t *testing.T) {
+	b := New("global", 100, nil)
+
+	release, err := b.Acquire(context.Background(), 60)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if used := b.Used(); used != 60 {
+		t.Errorf("Expected 60 bytes used, got %d", used)
+	}
+
+	var eerr *ExhaustedError
+	if _, err := b.Acquire(shortContext(t), 60); !errors.As(err, &eerr) || eerr.Budget != b {
+		t.Errorf("Expected the budget to be exhausted, got %v", err)
+	}
+	if _, err := b.Acquire(context.Background(), 101); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected the payload to be too large, got %v", err)
+	}
+
+	release()
+	release()
+	if used := b.Used(); used != 0 {
+		t.Errorf("Expected no bytes used, got %d", used)
+	}
+}
+
+func TestAcquireWaits(t *testing.T) {
+	b := New("global", 100, nil)
+	release, _ := b.Acquire(context.Background(), 100)
+
+	done := make(chan error)
+	go func() {
+		_, err := b.Acquire(context.Background(), 50)
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	release()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Reservation was not made after releasing bytes")
+	}
+}
+
+func TestAcquireNested(t *testing.T) {
+	global := New("global", 100, nil)
+	a := New("a", 60, global)
+	b := New("b", 0, global)
+
+	if _, err := a.Acquire(context.Background(), 50); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var eerr *ExhaustedError
+	if _, err := a.Acquire(shortContext(t), 20); !errors.As(err, &eerr) || eerr.Budget != a {
+		t.Errorf("Expected the channel budget to be exhausted, got %v", err)
+	}
+
+	if _, err := b.Acquire(context.Background(), 40); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := b.Acquire(shortContext(t), 20); !errors.As(err, &eerr) || eerr.Budget != global {
+		t.Errorf("Expected the global budget to be exhausted, got %v", err)
+	}
+	if used := b.Used(); used != 40 {
+		t.Errorf("Expected failed reservations to be undone, got %d bytes used", used)
+	}
+	if used := global.Used(); used != 90 {
+		t.Errorf("Expected 90 bytes used globally, got %d", used)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package compression implements the HTTP gzip and deflate content codings
+// for request bodies, measuring their effectiveness and cost.
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Content codings.
+const (
+	Gzip    = "gzip"
+	Deflate = "deflate"
+)
+
+// DefaultMinSize is the body size compression starts at when not configured.
+const DefaultMinSize = 1024
+
+// Config for compressing request bodies.
+type Config struct {
+	// Encoding is the content coding, either Gzip or Deflate.
+	Encoding string `json:"encoding"`
+	// MinSize is the body size in bytes from which bodies are compressed.
+	MinSize int `json:"minSize"`
+}
+
+// Stats describes a compression or decompression.
+type Stats struct {
+	Encoding     string
+	Compressed   int64
+	Uncompressed int64
+	// Duration is the time spent compressing or decompressing.
+	Duration time.Duration
+}
+
+// Ratio returns the compression ratio, zero when nothing was compressed.
+func (s *Stats) Ratio() float64 {
+	if s.Compressed == 0 {
+		return 0
+	}
+	return float64(s.Uncompressed) / float64(s.Compressed)
+}
+
+// Supported returns whether the content coding is supported.
+func Supported(encoding string) bool {
+	switch normalize(encoding) {
+	case Gzip, Deflate:
+		return true
+	}
+	return false
+}
+
+func normalize(encoding string) string {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "x-gzip" {
+		return Gzip
+	}
+	return encoding
+}
+
+// Compress encodes data using the content coding.
+func Compress(encoding string, data []byte) ([]byte, *Stats, error) {
+	start := time.Now()
+	encoding = normalize(encoding)
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Deflate:
+		// The HTTP deflate coding is the zlib format.
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, nil, fmt.Errorf("compressing data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, nil, fmt.Errorf("compressing data: %w", err)
+	}
+
+	return buf.Bytes(), &Stats{
+		Encoding:     encoding,
+		Compressed:   int64(buf.Len()),
+		Uncompressed: int64(len(data)),
+		Duration:     time.Since(start),
+	}, nil
+}
+
+// Decompressor decodes a compressed body as it is read.
+type Decompressor struct {
+	compressed *countingReader
+	r          io.ReadCloser
+	stats      Stats
+}
+
+// NewDecompressor returns a reader for the body encoded with the content
+// coding. Deflate bodies are accepted both in zlib and raw deflate formats,
+// since both are commonly sent.
+func NewDecompressor(encoding string, body io.Reader) (*Decompressor, error) {
+	encoding = normalize(encoding)
+	d := &Decompressor{
+		compressed: &countingReader{r: body},
+		stats:      Stats{Encoding: encoding},
+	}
+
+	start := time.Now()
+	defer func() { d.stats.Duration += time.Since(start) }()
+
+	var err error
+	switch encoding {
+	case Gzip:
+		d.r, err = gzip.NewReader(d.compressed)
+	case Deflate:
+		br := bufio.NewReader(d.compressed)
+		if isZlib(br) {
+			d.r, err = zlib.NewReader(br)
+		} else {
+			d.r = flate.NewReader(br)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s body: %w", encoding, err)
+	}
+	return d, nil
+}
+
+// isZlib returns whether the stream starts with a zlib header.
+func isZlib(br *bufio.Reader) bool {
+	h, err := br.Peek(2)
+	if err != nil {
+		return false
+	}
+	return h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0
+}
+
+// Read implements io.Reader.
+func (d *Decompressor) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := d.r.Read(p)
+	d.stats.Duration += time.Since(start)
+	d.stats.Uncompressed += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer.
+func (d *Decompressor) Close() error {
+	return d.r.Close()
+}
+
+// Stats returns the decompression statistics for the body read so far.
+func (d *Decompressor) Stats() Stats {
+	s := d.stats
+	s.Compressed = d.compressed.n
+	return s
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat(`{"key":"value"}`, 100))
+
+	for _, enc := range []string{Gzip, Deflate} {
+		compressed, stats, err := Compress(enc, data)
+		if err != nil {
+			t.Fatalf("Unexpected error compressing with %s: %v", enc, err)
+		}
+		if stats.Ratio() <= 1 {
+			t.Errorf("Expected %s to compress repetitive data, got ratio %f", enc, stats.Ratio())
+		}
+
+		d, err := NewDecompressor(enc, bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("Unexpected error creating %s decompressor: %v", enc, err)
+		}
+		got, err := ioutil.ReadAll(d)
+		if err != nil {
+			t.Fatalf("Unexpected error decompressing %s: %v", enc, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Unexpected %s decompressed data", enc)
+		}
+
+		ds := d.Stats()
+		if ds.Compressed != int64(len(compressed)) || ds.Uncompressed != int64(len(data)) {
+			t.Errorf("Unexpected %s decompression stats %+v", enc, ds)
+		}
+	}
+}
+
+func TestRawDeflate(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	_, _ = w.Write([]byte("hello"))
+	_ = w.Close()
+
+	d, err := NewDecompressor(Deflate, &buf)
+	if err != nil {
+		t.Fatalf("Unexpected error creating decompressor: %v", err)
+	}
+	got, err := ioutil.ReadAll(d)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("Unexpected raw deflate result %q: %v", got, err)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	if Supported("br") {
+		t.Error("Expected brotli not to be supported")
+	}
+	if _, err := NewDecompressor("br", bytes.NewReader(nil)); err == nil {
+		t.Error("Expected an error decompressing an unsupported encoding")
+	}
+}
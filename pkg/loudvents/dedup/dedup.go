@@ -0,0 +1,172 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dedup provides a memory bounded cache that detects duplicated
+// CloudEvents using their (source, id) pair.
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultSize is the number of entries remembered when no size is configured.
+const DefaultSize = 10000
+
+// Config for a dedup Cache.
+type Config struct {
+	// Window is the amount of time an entry is remembered. Zero means
+	// entries are only evicted when Size is exceeded.
+	Window time.Duration `json:"window,omitempty"`
+	// Size is the maximum number of entries remembered.
+	Size int `json:"size,omitempty"`
+}
+
+// Entry is a remembered (source, id) pair.
+type Entry struct {
+	Key  string    `json:"key"`
+	Time time.Time `json:"time"`
+}
+
+// Cache remembers the (source, id) pairs of received events. Entries are
+// kept in arrival order, so that the oldest ones are evicted first both when
+// they fall out of the time window and when the size limit is reached.
+type Cache struct {
+	window time.Duration
+	size   int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	dirty bool
+
+	// overridable for testing
+	now func() time.Time
+}
+
+// NewCache creates a dedup Cache.
+func NewCache(cfg Config) *Cache {
+	size := cfg.Size
+	if size <= 0 {
+		size = DefaultSize
+	}
+
+	return &Cache{
+		window: cfg.Window,
+		size:   size,
+		ll:     list.New(),
+		items:  make(map[string]*list.Element, size),
+		now:    time.Now,
+	}
+}
+
+// Seen records the (source, id) pair and returns whether it was already
+// remembered by the cache.
+func (c *Cache) Seen(source, id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.expire(now)
+
+	key := Key(source, id)
+	if _, ok := c.items[key]; ok {
+		return true
+	}
+
+	c.items[key] = c.ll.PushFront(&Entry{Key: key, Time: now})
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+	c.dirty = true
+
+	return false
+}
+
+// Forget removes the (source, id) pair from the cache.
+func (c *Cache) Forget(source, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[Key(source, id)]; ok {
+		c.remove(e)
+		c.dirty = true
+	}
+}
+
+// Entries returns the remembered entries, oldest first.
+func (c *Cache) Entries() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(c.now())
+
+	entries := make([]Entry, 0, c.ll.Len())
+	for e := c.ll.Back(); e != nil; e = e.Prev() {
+		entries = append(entries, *e.Value.(*Entry))
+	}
+	return entries
+}
+
+// Restore adds the entries, which are expected oldest first, to the cache.
+// Entries out of the window or exceeding the size are discarded.
+func (c *Cache) Restore(entries []Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range entries {
+		if _, ok := c.items[entries[i].Key]; ok {
+			continue
+		}
+		entry := entries[i]
+		c.items[entry.Key] = c.ll.PushFront(&entry)
+	}
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+	c.expire(c.now())
+}
+
+// Dirty returns whether the cache was modified since the last call.
+func (c *Cache) Dirty() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dirty := c.dirty
+	c.dirty = false
+	return dirty
+}
+
+// expire removes entries older than the window. Must be called with the lock held.
+func (c *Cache) expire(now time.Time) {
+	if c.window <= 0 {
+		return
+	}
+	for e := c.ll.Back(); e != nil; e = c.ll.Back() {
+		if now.Sub(e.Value.(*Entry).Time) < c.window {
+			return
+		}
+		c.remove(e)
+	}
+}
+
+func (c *Cache) remove(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.items, e.Value.(*Entry).Key)
+}
+
+// Key returns the cache key for a (source, id) pair.
+func Key(source, id string) string {
+	return source + "\x00" + id
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeen(t *testing.T) {
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	c := NewCache(Config{Window: time.Minute, Size: 2})
+	c.now = func() time.Time { return now }
+
+	if c.Seen("src", "1") {
+		t.Error("first event reported as duplicated")
+	}
+	if !c.Seen("src", "1") {
+		t.Error("repeated event not reported as duplicated")
+	}
+	if c.Seen("other", "1") {
+		t.Error("same id from a different source reported as duplicated")
+	}
+
+	// exceeding size evicts the oldest entry
+	if c.Seen("src", "2") {
+		t.Error("new event reported as duplicated")
+	}
+	if c.Seen("src", "1") {
+		t.Error("evicted event reported as duplicated")
+	}
+
+	// moving out of the window forgets every entry
+	now = now.Add(time.Minute)
+	if c.Seen("src", "2") {
+		t.Error("expired event reported as duplicated")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	c := NewCache(Config{Window: time.Minute})
+	c.now = func() time.Time { return now }
+	c.Seen("src", "1")
+	now = now.Add(30 * time.Second)
+	c.Seen("src", "2")
+
+	restored := NewCache(Config{Window: time.Minute})
+	restored.now = func() time.Time { return now.Add(45 * time.Second) }
+	restored.Restore(c.Entries())
+
+	if restored.Seen("src", "1") {
+		t.Error("restored entry out of the window reported as duplicated")
+	}
+	if !restored.Seen("src", "2") {
+		t.Error("restored entry not reported as duplicated")
+	}
+}
+
+func TestForget(t *testing.T) {
+	c := NewCache(Config{})
+	c.Seen("src", "1")
+	c.Dirty()
+
+	c.Forget("src", "1")
+	if !c.Dirty() {
+		t.Error("forgetting an entry did not mark the cache dirty")
+	}
+	if c.Seen("src", "1") {
+		t.Error("forgotten event reported as duplicated")
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package delay holds events until the delivery time requested through
+// CloudEvent extensions.
+package delay
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+const (
+	// DeliverAtExtension requests delivery at an RFC3339 timestamp.
+	DeliverAtExtension = "deliverat"
+	// DeliverAfterExtension requests delivery after a duration, using
+	// Go duration syntax, since the event was received.
+	DeliverAfterExtension = "deliverafter"
+
+	// DefaultMaxDelay is the longest delay allowed when not configured.
+	DefaultMaxDelay = 24 * time.Hour
+	// DefaultMaxPending is the number of events that can be waiting for
+	// delivery when not configured.
+	DefaultMaxPending = 10000
+)
+
+// ErrFull is returned when the queue holds as many events as allowed.
+var ErrFull = errors.New("too many delayed events pending")
+
+// Config for delayed delivery.
+type Config struct {
+	// MaxDelay is the longest delay an event can request.
+	MaxDelay time.Duration `json:"maxDelay"`
+	// MaxPending is the number of events that can be waiting for delivery.
+	// Not bounded when zero.
+	MaxPending int `json:"maxPending,omitempty"`
+}
+
+// DueTime returns the time the event should be delivered at, and whether
+// delivery should be delayed at all. Events requesting a delay longer than
+// the configured maximum are rejected.
+func DueTime(e *event.Event, now time.Time, cfg Config) (time.Time, bool, error) {
+	ext := e.Extensions()
+
+	var due time.Time
+	if v, ok := ext[DeliverAtExtension]; ok {
+		t, err := types.ToTime(v)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s extension: %w", DeliverAtExtension, err)
+		}
+		due = t
+	} else if v, ok := ext[DeliverAfterExtension]; ok {
+		s, err := types.ToString(v)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s extension: %w", DeliverAfterExtension, err)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s extension: %w", DeliverAfterExtension, err)
+		}
+		due = now.Add(d)
+	} else {
+		return time.Time{}, false, nil
+	}
+
+	if !due.After(now) {
+		return time.Time{}, false, nil
+	}
+	if delay := due.Sub(now); delay > cfg.MaxDelay {
+		return time.Time{}, false, fmt.Errorf("requested delay %s exceeds the channel maximum of %s",
+			delay.Round(time.Second), cfg.MaxDelay)
+	}
+	return due, true, nil
+}
+
+// Item is an event waiting for delivery.
+type Item struct {
+	Due     time.Time      `json:"due"`
+	Seq     uint64         `json:"seq"`
+	Event   *event.Event   `json:"event"`
+	Headers nethttp.Header `json:"headers,omitempty"`
+
+	// Release frees the resources held for the event while it is pending,
+	// nil when there are none, like for restored items.
+	Release func() `json:"-"`
+}
+
+// Queue holds events ordered by due time. Events with the same due time
+// are released in arrival order.
+type Queue struct {
+	mu     sync.Mutex
+	items  itemHeap
+	seq    uint64
+	dirty  bool
+	max    int
+	wakeCh chan struct{}
+
+	// overridable for testing
+	now func() time.Time
+}
+
+// NewQueue creates an empty queue.
+func NewQueue() *Queue {
+	return &Queue{
+		wakeCh: make(chan struct{}, 1),
+		now:    time.Now,
+	}
+}
+
+// SetMaxPending bounds the number of events Push accepts. Not bounded when
+// not positive.
+func (q *Queue) SetMaxPending(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.max = n
+}
+
+// Push adds an event to the queue, failing with ErrFull when it holds as many
+// events as allowed. The delivery extensions are removed so that the event is
+// not delayed again by downstream channels. The release function, if any, is
+// handed over with the item when it is due, or called when the queue is
+// cleared.
+func (q *Queue) Push(due time.Time, e *event.Event, headers nethttp.Header, release func()) error {
+	clone := e.Clone()
+	clone.SetExtension(DeliverAtExtension, nil)
+	clone.SetExtension(DeliverAfterExtension, nil)
+
+	q.mu.Lock()
+	if q.max > 0 && len(q.items) >= q.max {
+		q.mu.Unlock()
+		return ErrFull
+	}
+	q.seq++
+	heap.Push(&q.items, &Item{Due: due, Seq: q.seq, Event: &clone, Headers: headers, Release: release})
+	q.dirty = true
+	q.mu.Unlock()
+
+	q.wake()
+	return nil
+}
+
+// Len returns the number of pending events.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Items returns a copy of the pending events, and marks the queue as clean.
+func (q *Queue) Items() []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]Item, 0, len(q.items))
+	for _, it := range q.items {
+		items = append(items, *it)
+	}
+	q.dirty = false
+	return items
+}
+
+// Restore adds previously saved items to the queue.
+func (q *Queue) Restore(items []Item) {
+	q.mu.Lock()
+	for i := range items {
+		it := items[i]
+		if it.Event == nil {
+			continue
+		}
+		if it.Seq > q.seq {
+			q.seq = it.Seq
+		}
+		heap.Push(&q.items, &it)
+	}
+	q.mu.Unlock()
+
+	q.wake()
+}
+
+// Clear removes all pending events, calling their release functions.
+func (q *Queue) Clear() {
+	q.mu.Lock()
+	items := q.items
+	q.items = nil
+	q.dirty = true
+	q.mu.Unlock()
+
+	for _, it := range items {
+		if it.Release != nil {
+			it.Release()
+		}
+	}
+}
+
+// Dirty returns whether the queue changed since items were last read.
+func (q *Queue) Dirty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dirty
+}
+
+// Run calls release for each event when it is due, until stopCh is closed.
+func (q *Queue) Run(stopCh <-chan struct{}, release func(Item)) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		for _, it := range q.popDue() {
+			release(it)
+		}
+
+		wait := time.Hour
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			wait = q.items[0].Due.Sub(q.now())
+		}
+		q.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-stopCh:
+			return
+		case <-q.wakeCh:
+		case <-timer.C:
+		}
+	}
+}
+
+// popDue removes and returns the items whose due time has passed.
+func (q *Queue) popDue() []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	var due []Item
+	for len(q.items) > 0 && !q.items[0].Due.After(now) {
+		due = append(due, *heap.Pop(&q.items).(*Item))
+		q.dirty = true
+	}
+	return due
+}
+
+func (q *Queue) wake() {
+	select {
+	case q.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// itemHeap implements heap.Interface ordering items by due time.
+type itemHeap []*Item
+
+func (h itemHeap) Len() int { return len(h) }
+func (h itemHeap) Less(i, j int) bool {
+	if h[i].Due.Equal(h[j].Due) {
+		return h[i].Seq < h[j].Seq
+	}
+	return h[i].Due.Before(h[j].Due)
+}
+func (h itemHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *itemHeap) Push(x interface{}) { *h = append(*h, x.(*Item)) }
+func (h *itemHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return it
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package delay
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newEvent(id string, ext map[string]string) *event.Event {
+	e := event.New()
+	e.SetID(id)
+	e.SetType("reminder")
+	e.SetSource("test")
+	for k, v := range ext {
+		e.SetExtension(k, v)
+	}
+	return &e
+}
+
+func TestDueTime(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	cfg := Config{MaxDelay: time.Hour}
+
+	testCases := map[string]struct {
+		ext     map[string]string
+		due     time.Time
+		delayed bool
+		wantErr bool
+	}{
+		"No extension": {},
+		"Deliver at": {
+			ext:     map[string]string{DeliverAtExtension: "2021-10-01T12:30:00Z"},
+			due:     now.Add(30 * time.Minute),
+			delayed: true,
+		},
+		"Deliver after": {
+			ext:     map[string]string{DeliverAfterExtension: "10m"},
+			due:     now.Add(10 * time.Minute),
+			delayed: true,
+		},
+		"In the past": {
+			ext: map[string]string{DeliverAtExtension: "2021-10-01T11:00:00Z"},
+		},
+		"Exceeds maximum": {
+			ext:     map[string]string{DeliverAfterExtension: "2h"},
+			wantErr: true,
+		},
+		"Malformed": {
+			ext:     map[string]string{DeliverAfterExtension: "soon"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			due, delayed, err := DueTime(newEvent("1", tc.ext), now, cfg)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if delayed != tc.delayed || !due.Equal(tc.due) {
+				t.Errorf("Expected (%v, %v), got (%v, %v)", tc.due, tc.delayed, due, delayed)
+			}
+		})
+	}
+}
+
+func TestQueueRelease(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	q := NewQueue()
+	q.now = func() time.Time { return now }
+
+	q.Push(now.Add(2*time.Second), newEvent("2", map[string]string{DeliverAfterExtension: "2s"}), nil, nil)
+	q.Push(now.Add(time.Second), newEvent("1", nil), nil, nil)
+	q.Push(now.Add(2*time.Second), newEvent("3", nil), nil, nil)
+
+	if due := q.popDue(); len(due) != 0 {
+		t.Fatalf("Expected no due items, got %d", len(due))
+	}
+
+	now = now.Add(2 * time.Second)
+	var ids []string
+	for _, it := range q.popDue() {
+		ids = append(ids, it.Event.ID())
+		if _, ok := it.Event.Extensions()[DeliverAfterExtension]; ok {
+			t.Errorf("Expected delay extension to be removed from event %s", it.Event.ID())
+		}
+	}
+	if diff := cmp.Diff([]string{"1", "2", "3"}, ids); diff != "" {
+		t.Errorf("Unexpected release order (-want, +got): %s", diff)
+	}
+}
+
+func TestQueueRestore(t *testing.T) {
+	now := time.Now()
+	q := NewQueue()
+	q.Push(now.Add(time.Minute), newEvent("1", nil), nil, nil)
+
+	if !q.Dirty() {
+		t.Error("Expected queue to be dirty after push")
+	}
+	b, err := json.Marshal(q.Items())
+	if err != nil {
+		t.Fatalf("Unexpected error marshaling items: %v", err)
+	}
+	if q.Dirty() {
+		t.Error("Expected queue to be clean after reading items")
+	}
+
+	var items []Item
+	if err := json.Unmarshal(b, &items); err != nil {
+		t.Fatalf("Unexpected error unmarshaling items: %v", err)
+	}
+	restored := NewQueue()
+	restored.Restore(items)
+	if restored.Len() != 1 || restored.Items()[0].Event.ID() != "1" {
+		t.Errorf("Unexpected restored items: %+v", restored.Items())
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	q := NewQueue()
+	q.SetMaxPending(2)
+
+	for _, id := range []string{"1", "2"} {
+		if err := q.Push(now.Add(time.Second), newEvent(id, nil), nil, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := q.Push(now.Add(time.Second), newEvent("3", nil), nil, nil); !errors.Is(err, ErrFull) {
+		t.Errorf("Expected the queue to be full, got %v", err)
+	}
+
+	q.SetMaxPending(0)
+	if err := q.Push(now.Add(time.Second), newEvent("3", nil), nil, nil); err != nil {
+		t.Errorf("Unexpected error once not bounded: %v", err)
+	}
+}
+
+func TestQueueClear(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	q := NewQueue()
+
+	released := 0
+	q.Push(now.Add(time.Second), newEvent("1", nil), nil, func() { released++ })
+	q.Push(now.Add(time.Second), newEvent("2", nil), nil, nil)
+
+	q.Clear()
+	if q.Len() != 0 {
+		t.Errorf("Expected no pending events, got %d", q.Len())
+	}
+	if released != 1 {
+		t.Errorf("Expected the reservation to be released once, got %d", released)
+	}
+}
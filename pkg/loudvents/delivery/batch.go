@@ -0,0 +1,139 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	nethttp "net/http"
+	"net/url"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel"
+	"knative.dev/eventing/pkg/channel/attributes"
+	"knative.dev/eventing/pkg/kncloudevents"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/compression"
+)
+
+// BatchRequest describes the delivery of a batch of events encoded in a
+// single request body.
+type BatchRequest struct {
+	Body        []byte
+	ContentType string
+	Headers     nethttp.Header
+	Destination *url.URL
+	Retry       *kncloudevents.RetryConfig
+
+	// Expires is the time after which no delivery attempts are made.
+	// Zero means the batch never expires.
+	Expires time.Time
+	// Compression compresses the batch, disabled when nil.
+	Compression *compression.Config
+
+	// Acquire blocks until a delivery slot is granted before each attempt,
+	// returning the function that frees it once the attempt completes.
+	// Attempts are not bounded when nil.
+	Acquire AcquireFunc
+}
+
+// DispatchBatch posts the batch to the destination, retrying according to
+// the request retry configuration. Responses are not forwarded, and failed
+// batches are not dead lettered, which is left to the caller.
+func (d *Dispatcher) DispatchBatch(ctx context.Context, req *BatchRequest) (_ *Result, err error) {
+	res := &Result{
+		Info: &channel.DispatchExecutionInfo{
+			Time:         channel.NoDuration,
+			ResponseCode: channel.NoResponse,
+		},
+	}
+	destination := d.sanitizeURL(req.Destination)
+
+	d.logger.Debug("Dispatching batch", zap.String("url", destination.String()), zap.Int("bytes", len(req.Body)))
+
+	ctx, span := trace.StartSpan(ctx, "loudvents."+TargetBatch, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	defer func() { setSpanStatus(span, res.Info.ResponseCode, err) }()
+	span.AddAttributes(
+		trace.StringAttribute(TargetAttribute, TargetBatch),
+		trace.StringAttribute(SubscriberAttribute, destination.String()))
+
+	httpReq, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodPost, destination.String(), bytes.NewReader(req.Body))
+	if err != nil {
+		return res, err
+	}
+	for k, v := range req.Headers {
+		httpReq.Header[k] = v
+	}
+	httpReq.Header.Set("Content-Type", req.ContentType)
+
+	if res.Compression, err = compressRequest(httpReq, req.Compression); err != nil {
+		return res, err
+	}
+
+	newRequest, err := reusableRequest(httpReq)
+	if err != nil {
+		return res, err
+	}
+
+	start := time.Now()
+	response, err := d.sendWithRetries(ctx, newRequest, req.Retry, req.Expires, req.Acquire, res)
+	res.Info.Time = time.Since(start)
+	if err != nil {
+		if errors.Is(err, errExpired) {
+			res.Expired = true
+		}
+		res.Info.ResponseCode = nethttp.StatusInternalServerError
+		res.Info.ResponseBody = []byte(fmt.Sprintf("dispatch error: %s", err.Error()))
+		return res, err
+	}
+	defer response.Body.Close()
+
+	res.Info.ResponseCode = response.StatusCode
+	if isFailure(response.StatusCode) {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, attributes.KnativeErrorDataExtensionMaxLength))
+		res.Info.ResponseBody = body
+		return res, fmt.Errorf("unexpected HTTP response, expected 2xx, got %d", response.StatusCode)
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	return res, nil
+}
+
+// DispatchDeadLetter sends the request message to its dead letter sink,
+// informing that the delivery to the destination failed with reqErr and the
+// given result. Expired messages are dropped unless the request asks to dead
+// letter them.
+func (d *Dispatcher) DispatchDeadLetter(ctx context.Context, req *Request, res *Result, reqErr error) (*Result, error) {
+	var messagesToFinish []binding.Message
+	defer func() {
+		for _, msg := range messagesToFinish {
+			_ = msg.Finish(nil)
+		}
+	}()
+
+	messagesToFinish = append(messagesToFinish, req.Message)
+	dlRes := *res
+	if res.Expired {
+		reqErr = errExpired
+	}
+	return d.deadLetter(ctx, req, &dlRes, d.sanitizeURL(req.Destination), d.sanitizeURL(req.DeadLetter), req.Headers, reqErr, &messagesToFinish)
+}
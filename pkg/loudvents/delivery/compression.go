@@ -0,0 +1,48 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package delivery
+
+import (
+	"bytes"
+	"io/ioutil"
+	nethttp "net/http"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/compression"
+)
+
+// compressRequest compresses the request body when it reaches the configured
+// minimum size, returning nil stats when the body is left as is.
+func compressRequest(req *nethttp.Request, cfg *compression.Config) (*compression.Stats, error) {
+	if cfg == nil || req.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+
+	var stats *compression.Stats
+	if len(body) >= cfg.MinSize {
+		if body, stats, err = compression.Compress(cfg.Encoding, body); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Encoding", stats.Encoding)
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return stats, nil
+}
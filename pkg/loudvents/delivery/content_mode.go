@@ -0,0 +1,46 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package delivery
+
+import (
+	"context"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+)
+
+// ContentMode is the CloudEvents HTTP content mode messages are sent with.
+type ContentMode string
+
+const (
+	// ContentModeBinary sends event attributes as headers and data as body.
+	ContentModeBinary ContentMode = "binary"
+	// ContentModeStructured sends the whole event encoded as JSON in the body.
+	ContentModeStructured ContentMode = "structured"
+	// ContentModePassthrough keeps the content mode of the message, which
+	// is binary for messages that are not HTTP requests or responses.
+	ContentModePassthrough ContentMode = "passthrough"
+)
+
+// withContentMode returns a context that makes messages be written using
+// the content mode.
+func withContentMode(ctx context.Context, mode ContentMode) context.Context {
+	switch mode {
+	case ContentModeBinary:
+		return binding.WithForceBinary(ctx)
+	case ContentModeStructured:
+		return binding.WithForceStructured(ctx)
+	default:
+		return ctx
+	}
+}
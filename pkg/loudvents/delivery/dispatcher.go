@@ -0,0 +1,651 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package delivery dispatches messages to subscribers. It follows the Knative
+// channel.MessageDispatcherImpl behaviour, running the retry loop itself so
+// that each delivery attempt can be inspected.
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	nethttp "net/http"
+	"net/url"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/binding/buffering"
+	"github.com/cloudevents/sdk-go/v2/binding/transformer"
+	"github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"knative.dev/eventing/pkg/channel"
+	"knative.dev/eventing/pkg/channel/attributes"
+	"knative.dev/eventing/pkg/kncloudevents"
+	"knative.dev/eventing/pkg/tracing"
+	"knative.dev/eventing/pkg/utils"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/compression"
+)
+
+const (
+	// DeadLetterReasonExtension informs the dead letter sink why an event
+	// was dead lettered when it was not due to a failed delivery.
+	DeadLetterReasonExtension = "deadletterreason"
+
+	// ReasonExpired is the dead letter reason for events whose TTL elapsed.
+	ReasonExpired = "expired"
+
+	// Dead letter enrichment extensions. They complement the Knative
+	// knativeerrordest, knativeerrorcode and knativeerrordata extensions.
+	DeadLetterChannelExtension    = "deadletterchannel"
+	DeadLetterSubscriberExtension = "deadlettersubscriber"
+	DeadLetterAttemptsExtension   = "deadletterattempts"
+	DeadLetterFirstTimeExtension  = "deadletterfirsttime"
+	DeadLetterLastTimeExtension   = "deadletterlasttime"
+)
+
+// errExpired is returned when no more delivery attempts can be made
+// before the event expires.
+var errExpired = errors.New("event expired")
+
+// Request describes a message delivery.
+type Request struct {
+	Message      binding.Message
+	Headers      nethttp.Header
+	Destination  *url.URL
+	Reply        *url.URL
+	DeadLetter   *url.URL
+	Retry        *kncloudevents.RetryConfig
+	Transformers []binding.Transformer
+
+	// Expires is the time after which no delivery attempts are made.
+	// Zero means the message never expires.
+	Expires time.Time
+	// DeadLetterExpired sends expired messages to the dead letter sink,
+	// otherwise they are dropped.
+	DeadLetterExpired bool
+
+	// Channel is the namespace/name of the channel the message is
+	// delivered from, informed when enriching dead lettered messages.
+	Channel string
+	// Enrichment adds failure metadata to dead lettered messages, disabled when nil.
+	Enrichment *Enrichment
+
+	// ContentMode, ReplyContentMode and DeadLetterContentMode are the content
+	// modes messages are sent with to the destination, reply and dead letter
+	// sink. Empty values behave as ContentModePassthrough.
+	ContentMode           ContentMode
+	ReplyContentMode      ContentMode
+	DeadLetterContentMode ContentMode
+
+	// Compression compresses the message sent to the destination, disabled when nil.
+	Compression *compression.Config
+
+	// HopCount is the number of hops the message made before this delivery.
+	// Messages sent to the destination are stamped with one more hop, and
+	// replies with one more hop than the destination response, if higher.
+	HopCount int
+	// MaxHops is the highest hop count messages can be sent with, no limit
+	// when zero. Messages that would exceed it are not sent.
+	MaxHops int
+	// DeadLetterHopsExceeded sends messages that exceed the hop limit to the
+	// dead letter sink, otherwise they are dropped.
+	DeadLetterHopsExceeded bool
+
+	// Acquire blocks until a delivery slot is granted before each attempt,
+	// returning the function that frees it once the attempt completes.
+	// Attempts are not bounded when nil.
+	Acquire AcquireFunc
+}
+
+// AcquireFunc blocks until a delivery slot is granted, returning the function
+// that frees it, or until the context is done.
+type AcquireFunc func(ctx context.Context) (func(), error)
+
+// Enrichment configures the failure metadata added to dead lettered messages.
+type Enrichment struct {
+	// MaxDataLength truncates the response body informed at the
+	// knativeerrordata extension. Zero uses the Knative maximum.
+	MaxDataLength int `json:"maxDataLength,omitempty"`
+}
+
+// Transformers returns the extensions that describe the delivery of a
+// message from the channel to the subscriber.
+func (e *Enrichment) Transformers(channel string, subscriber *url.URL, res *Result) binding.Transformers {
+	ts := binding.Transformers{}
+	if channel != "" {
+		ts = append(ts, transformer.AddExtension(DeadLetterChannelExtension, channel))
+	}
+	if subscriber != nil {
+		ts = append(ts, transformer.AddExtension(DeadLetterSubscriberExtension, subscriber.String()))
+	}
+	if res != nil && res.Attempts > 0 {
+		ts = append(ts,
+			transformer.AddExtension(DeadLetterAttemptsExtension, res.Attempts),
+			transformer.AddExtension(DeadLetterFirstTimeExtension, res.FirstAttempt),
+			transformer.AddExtension(DeadLetterLastTimeExtension, res.LastAttempt),
+		)
+	}
+	return ts
+}
+
+// Result of a message delivery.
+type Result struct {
+	// Info about the last request performed.
+	Info *channel.DispatchExecutionInfo
+	// Expired is set when the message expired before being delivered.
+	Expired bool
+	// Attempts made to deliver to the destination and reply.
+	Attempts int
+	// FirstAttempt and LastAttempt are the times of the first and last
+	// delivery attempts to the destination or reply.
+	FirstAttempt time.Time
+	LastAttempt  time.Time
+	// Compression informs about the compression of the message sent to the
+	// destination, nil when not compressed.
+	Compression *compression.Stats
+	// HopsExceeded is set when a message was not sent to HopsExceededAt
+	// because its hop count, Hops, would exceed the limit.
+	HopsExceeded   bool
+	HopsExceededAt *url.URL
+	Hops           int
+}
+
+// Dispatcher dispatches messages over HTTP.
+type Dispatcher struct {
+	sender           *kncloudevents.HTTPMessageSender
+	supportedSchemes sets.String
+
+	logger *zap.Logger
+}
+
+var _ channel.MessageDispatcher = (*Dispatcher)(nil)
+
+// NewDispatcher creates a new message dispatcher.
+func NewDispatcher(logger *zap.Logger) *Dispatcher {
+	sender, err := kncloudevents.NewHTTPMessageSenderWithTarget("")
+	if err != nil {
+		logger.Fatal("Unable to create cloudevents binding sender", zap.Error(err))
+	}
+	return &Dispatcher{
+		sender:           sender,
+		supportedSchemes: sets.NewString("http", "https"),
+		logger:           logger,
+	}
+}
+
+// DispatchMessage implements channel.MessageDispatcher.
+func (d *Dispatcher) DispatchMessage(ctx context.Context, message binding.Message, additionalHeaders nethttp.Header, destination *url.URL, reply *url.URL, deadLetter *url.URL) (*channel.DispatchExecutionInfo, error) {
+	return d.DispatchMessageWithRetries(ctx, message, additionalHeaders, destination, reply, deadLetter, nil)
+}
+
+// DispatchMessageWithRetries implements channel.MessageDispatcher.
+func (d *Dispatcher) DispatchMessageWithRetries(ctx context.Context, message binding.Message, additionalHeaders nethttp.Header, destination *url.URL, reply *url.URL, deadLetter *url.URL, retriesConfig *kncloudevents.RetryConfig, transformers ...binding.Transformer) (*channel.DispatchExecutionInfo, error) {
+	res, err := d.Dispatch(ctx, &Request{
+		Message:      message,
+		Headers:      additionalHeaders,
+		Destination:  destination,
+		Reply:        reply,
+		DeadLetter:   deadLetter,
+		Retry:        retriesConfig,
+		Transformers: transformers,
+	})
+	return res.Info, err
+}
+
+// Dispatch delivers the message to the destination, forwarding the response
+// to the reply, and sending the message to the dead letter sink when any of
+// them fail.
+func (d *Dispatcher) Dispatch(ctx context.Context, req *Request) (*Result, error) {
+	res := &Result{}
+
+	// All messages that should be finished at the end of this function
+	// are placed in this slice
+	var messagesToFinish []binding.Message
+	defer func() {
+		for _, msg := range messagesToFinish {
+			_ = msg.Finish(nil)
+		}
+	}()
+
+	// sanitize eventual host-only URLs
+	destination := d.sanitizeURL(req.Destination)
+	reply := d.sanitizeURL(req.Reply)
+	deadLetter := d.sanitizeURL(req.DeadLetter)
+
+	// If there is a destination, variables response* are filled with the response of the destination
+	// Otherwise, they are filled with the original message
+	var responseMessage binding.Message
+	var responseAdditionalHeaders nethttp.Header
+
+	hops := req.HopCount + 1
+	if destination != nil {
+		var err error
+		messagesToFinish = append(messagesToFinish, req.Message)
+
+		if req.hopsExceeded(hops) {
+			res.Hops = hops
+			return d.deadLetter(ctx, req, res, destination, deadLetter, req.Headers, errHopsExceeded, &messagesToFinish)
+		}
+		transformers := append(append([]binding.Transformer{}, req.Transformers...), hopCountTransformer(hops))
+
+		additionalHeadersForDestination := nethttp.Header{}
+		if req.Headers != nil {
+			additionalHeadersForDestination = req.Headers.Clone()
+		}
+		additionalHeadersForDestination.Set("Prefer", "reply")
+
+		ctx, responseMessage, responseAdditionalHeaders, res.Info, err = d.executeRequest(ctx, destination, sendOptions{target: TargetDestination, mode: req.ContentMode, compression: req.Compression}, req.Message, additionalHeadersForDestination, req, res, transformers...)
+		if err != nil {
+			return d.deadLetter(ctx, req, res, destination, deadLetter, req.Headers, err, &messagesToFinish)
+		}
+	} else {
+		// No destination url, try to send to reply if available
+		responseMessage = req.Message
+		responseAdditionalHeaders = req.Headers
+	}
+
+	// No response, dispatch completed
+	if responseMessage == nil {
+		return res, nil
+	}
+
+	messagesToFinish = append(messagesToFinish, responseMessage)
+
+	if reply == nil {
+		d.logger.Debug("cannot forward response as reply is empty")
+		return res, nil
+	}
+
+	// Responses count one more hop than the message that caused them, unless
+	// they already carry a higher count.
+	replyHops := hops
+	if destination != nil {
+		response, err := binding.ToEvent(ctx, responseMessage)
+		if err != nil {
+			return d.deadLetter(ctx, req, res, reply, deadLetter, responseAdditionalHeaders, err, &messagesToFinish)
+		}
+		if h := HopCount(response); h > replyHops {
+			replyHops = h
+		}
+		replyHops++
+		responseMessage = binding.ToMessage(response)
+	}
+	if req.hopsExceeded(replyHops) {
+		res.Hops = replyHops
+		return d.deadLetter(ctx, req, res, reply, deadLetter, responseAdditionalHeaders, errHopsExceeded, &messagesToFinish)
+	}
+	replyTransformers := append(append([]binding.Transformer{}, req.Transformers...), hopCountTransformer(replyHops))
+
+	var responseResponseMessage binding.Message
+	var err error
+	ctx, responseResponseMessage, _, res.Info, err = d.executeRequest(ctx, reply, sendOptions{target: TargetReply, mode: req.ReplyContentMode}, responseMessage, responseAdditionalHeaders, req, res, replyTransformers...)
+	if err != nil {
+		return d.deadLetter(ctx, req, res, reply, deadLetter, responseAdditionalHeaders, err, &messagesToFinish)
+	}
+	if responseResponseMessage != nil {
+		messagesToFinish = append(messagesToFinish, responseResponseMessage)
+	}
+
+	return res, nil
+}
+
+// deadLetter handles a failed request to target, sending the original message
+// to the dead letter sink when configured.
+func (d *Dispatcher) deadLetter(ctx context.Context, req *Request, res *Result, target, deadLetter *url.URL,
+	headers nethttp.Header, reqErr error, messagesToFinish *[]binding.Message) (*Result, error) {
+	var dispatchTransformers binding.Transformers
+	if errors.Is(reqErr, errHopsExceeded) {
+		res.HopsExceeded = true
+		res.HopsExceededAt = target
+		if !req.DeadLetterHopsExceeded || deadLetter == nil {
+			d.logger.Debug("Dropping message that exceeded the hop limit", zap.String("url", target.String()))
+			return res, nil
+		}
+		dispatchTransformers = binding.Transformers{
+			transformer.AddExtension(attributes.KnativeErrorDestExtensionKey, *target),
+			transformer.AddExtension(DeadLetterReasonExtension, ReasonHopsExceeded),
+		}
+	} else if errors.Is(reqErr, errExpired) {
+		res.Expired = true
+		if !req.DeadLetterExpired || deadLetter == nil {
+			d.logger.Debug("Dropping expired message", zap.String("url", target.String()))
+			return res, nil
+		}
+		dispatchTransformers = binding.Transformers{
+			transformer.AddExtension(attributes.KnativeErrorDestExtensionKey, *target),
+			transformer.AddExtension(DeadLetterReasonExtension, ReasonExpired),
+		}
+	} else {
+		if deadLetter == nil {
+			return res, fmt.Errorf("unable to complete request to %s: %v", target, reqErr)
+		}
+		maxDataLength := attributes.KnativeErrorDataExtensionMaxLength
+		if req.Enrichment != nil && req.Enrichment.MaxDataLength > 0 && req.Enrichment.MaxDataLength < maxDataLength {
+			maxDataLength = req.Enrichment.MaxDataLength
+		}
+		dispatchTransformers = d.dispatchExecutionInfoTransformers(target, res.Info, maxDataLength)
+	}
+	if req.Enrichment != nil {
+		dispatchTransformers = append(dispatchTransformers, req.Enrichment.Transformers(req.Channel, req.Destination, res)...)
+	}
+
+	transformers := append(append([]binding.Transformer{}, req.Transformers...), dispatchTransformers)
+	var deadLetterResponse binding.Message
+	var deadLetterErr error
+	// Dead letter attempts are not subject to expiration.
+	dlReq := *req
+	dlReq.Expires = time.Time{}
+	_, deadLetterResponse, _, res.Info, deadLetterErr = d.executeRequest(ctx, deadLetter, sendOptions{target: TargetDeadLetter, mode: req.DeadLetterContentMode}, req.Message, headers, &dlReq, nil, transformers...)
+	if deadLetterErr != nil {
+		return res, fmt.Errorf("unable to complete request to either %s (%v) or %s (%v)", target, reqErr, deadLetter, deadLetterErr)
+	}
+	if deadLetterResponse != nil {
+		*messagesToFinish = append(*messagesToFinish, deadLetterResponse)
+	}
+	return res, nil
+}
+
+// sendOptions customize how a message is written to a request.
+type sendOptions struct {
+	target      string
+	mode        ContentMode
+	compression *compression.Config
+}
+
+// executeRequest sends the message to the URL, retrying according to the
+// request retry configuration. Attempts and compression are recorded in res
+// when not nil.
+func (d *Dispatcher) executeRequest(ctx context.Context,
+	url *url.URL,
+	opts sendOptions,
+	message binding.Message,
+	additionalHeaders nethttp.Header,
+	dispatchReq *Request,
+	res *Result,
+	transformers ...binding.Transformer) (_ context.Context, _ binding.Message, _ nethttp.Header, _ *channel.DispatchExecutionInfo, err error) {
+
+	d.logger.Debug("Dispatching event", zap.String("url", url.String()))
+
+	execInfo := channel.DispatchExecutionInfo{
+		Time:         channel.NoDuration,
+		ResponseCode: channel.NoResponse,
+	}
+	ctx, span := trace.StartSpan(ctx, "loudvents."+opts.target, trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		setSpanStatus(span, execInfo.ResponseCode, err)
+		span.End()
+	}()
+	span.AddAttributes(
+		trace.StringAttribute(TargetAttribute, opts.target),
+		trace.StringAttribute(ChannelAttribute, dispatchReq.Channel))
+	if dispatchReq.Destination != nil {
+		span.AddAttributes(trace.StringAttribute(SubscriberAttribute, dispatchReq.Destination.String()))
+	}
+	transformers = append(transformers, eventAttributesTransformer(span))
+	if span.IsRecordingEvents() {
+		transformers = append(transformers, tracing.PopulateSpan(span, url.String()))
+	}
+
+	// The message is written for each attempt, so that it carries the trace
+	// context of the attempt span.
+	if message, err = copyMessage(ctx, message); err != nil {
+		return ctx, nil, nil, &execInfo, err
+	}
+	defer func() { _ = message.Finish(nil) }()
+	newRequest := func(ctx context.Context) (*nethttp.Request, error) {
+		req, err := d.sender.NewCloudEventRequestWithTarget(ctx, url.String())
+		if err != nil {
+			return nil, err
+		}
+		ts := append(append([]binding.Transformer{}, transformers...), traceContextTransformer(trace.FromContext(ctx)))
+		if err := kncloudevents.WriteHTTPRequestWithAdditionalHeaders(withContentMode(ctx, opts.mode), message, req, additionalHeaders, ts...); err != nil {
+			return nil, err
+		}
+		stats, err := compressRequest(req, opts.compression)
+		if err != nil {
+			return nil, err
+		}
+		if res != nil && stats != nil {
+			res.Compression = stats
+		}
+		return req, nil
+	}
+
+	start := time.Now()
+	response, err := d.sendWithRetries(ctx, newRequest, dispatchReq.Retry, dispatchReq.Expires, dispatchReq.Acquire, res)
+	dispatchTime := time.Since(start)
+	if err != nil {
+		execInfo.Time = dispatchTime
+		execInfo.ResponseCode = nethttp.StatusInternalServerError
+		execInfo.ResponseBody = []byte(fmt.Sprintf("dispatch error: %s", err.Error()))
+		return ctx, nil, nil, &execInfo, err
+	}
+
+	execInfo.ResponseCode = response.StatusCode
+	execInfo.Time = dispatchTime
+
+	if isFailure(response.StatusCode) {
+		// Read response body into execInfo for failures
+		body := make([]byte, attributes.KnativeErrorDataExtensionMaxLength)
+		readLen, err := response.Body.Read(body)
+		if err != nil && err != io.EOF {
+			d.logger.Error("failed to read response body into DispatchExecutionInfo", zap.Error(err))
+			execInfo.ResponseBody = []byte(fmt.Sprintf("dispatch error: %s", err.Error()))
+		} else {
+			execInfo.ResponseBody = body[:readLen]
+		}
+		_ = response.Body.Close()
+		// Reject non-successful responses.
+		return ctx, nil, nil, &execInfo, fmt.Errorf("unexpected HTTP response, expected 2xx, got %d", response.StatusCode)
+	}
+	responseMessage := http.NewMessageFromHttpResponse(response)
+	if responseMessage.ReadEncoding() == binding.EncodingUnknown {
+		_ = response.Body.Close()
+		d.logger.Debug("Response is a non event, discarding it", zap.Int("status_code", response.StatusCode))
+		return ctx, nil, nil, &execInfo, nil
+	}
+	return ctx, responseMessage, utils.PassThroughHeaders(response.Header), &execInfo, nil
+}
+
+// requestFunc creates the request of a delivery attempt, whose span is in
+// the context.
+type requestFunc func(ctx context.Context) (*nethttp.Request, error)
+
+// reusableRequest returns a requestFunc that sends the request body with
+// every attempt.
+func reusableRequest(req *nethttp.Request) (requestFunc, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+	}
+	return func(ctx context.Context) (*nethttp.Request, error) {
+		attemptReq := req.Clone(ctx)
+		attemptReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+		attemptReq.ContentLength = int64(len(body))
+		return attemptReq, nil
+	}, nil
+}
+
+// copyMessage buffers the message so that it can be written for each
+// attempt. Events are cloned, since writing them sets their trace context
+// extensions, and they might be shared with deliveries to other subscribers.
+func copyMessage(ctx context.Context, message binding.Message) (binding.Message, error) {
+	if message.ReadEncoding() != binding.EncodingEvent {
+		return buffering.CopyMessage(ctx, message)
+	}
+	e, err := binding.ToEvent(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	clone := e.Clone()
+	return binding.ToMessage(&clone), nil
+}
+
+// sendWithRetries performs the request until it succeeds, retries are
+// exhausted or the message expires. Like the Knative sender, a failed
+// response is returned without error once retries are exhausted. When
+// acquire is not nil, each attempt holds a delivery slot, which is freed
+// while backing off.
+func (d *Dispatcher) sendWithRetries(ctx context.Context, newRequest requestFunc, config *kncloudevents.RetryConfig, expires time.Time, acquire AcquireFunc, res *Result) (*nethttp.Response, error) {
+	client := d.sender.Client
+	retryMax := 0
+	checkRetry := kncloudevents.CheckRetry(kncloudevents.RetryIfGreaterThan300)
+	if config != nil {
+		retryMax = config.RetryMax
+		if config.CheckRetry != nil {
+			checkRetry = config.CheckRetry
+		}
+		if config.RequestTimeout != 0 {
+			client = &nethttp.Client{
+				Transport:     client.Transport,
+				CheckRedirect: client.CheckRedirect,
+				Jar:           client.Jar,
+				Timeout:       config.RequestTimeout,
+			}
+		}
+	}
+
+	span := trace.FromContext(ctx)
+	for attempt := 0; ; attempt++ {
+		if !expires.IsZero() && !time.Now().Before(expires) {
+			return nil, errExpired
+		}
+		if span != nil {
+			span.AddAttributes(trace.Int64Attribute(RetriesAttribute, int64(attempt)))
+		}
+
+		release := func() {}
+		if acquire != nil {
+			var err error
+			if release, err = acquire(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		attemptCtx, attemptSpan := trace.StartSpan(ctx, "loudvents.attempt", trace.WithSpanKind(trace.SpanKindClient))
+		attemptSpan.AddAttributes(trace.Int64Attribute(AttemptAttribute, int64(attempt+1)))
+		attemptReq, err := newRequest(attemptCtx)
+		if err != nil {
+			release()
+			endAttemptSpan(attemptSpan, nil, err)
+			return nil, err
+		}
+
+		if res != nil {
+			now := time.Now()
+			if res.Attempts == 0 {
+				res.FirstAttempt = now
+			}
+			res.LastAttempt = now
+			res.Attempts++
+		}
+
+		resp, doErr := client.Do(attemptReq)
+		release()
+		endAttemptSpan(attemptSpan, resp, doErr)
+		shouldRetry, checkErr := checkRetry(ctx, resp, doErr)
+		if !shouldRetry || checkErr != nil || attempt >= retryMax {
+			if checkErr != nil {
+				return resp, checkErr
+			}
+			return resp, doErr
+		}
+
+		// We're going to retry, consume any response to reuse the connection.
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		var wait time.Duration
+		if config.Backoff != nil {
+			wait = config.Backoff(attempt, resp)
+		}
+		if !expires.IsZero() && time.Now().Add(wait).After(expires) {
+			// The next attempt would happen after the message expires.
+			return nil, errExpired
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (d *Dispatcher) sanitizeURL(u *url.URL) *url.URL {
+	if u == nil {
+		return nil
+	}
+	if d.supportedSchemes.Has(u.Scheme) {
+		// Already a URL with a known scheme.
+		return u
+	}
+	return &url.URL{
+		Scheme: "http",
+		Host:   u.Host,
+		Path:   "/",
+	}
+}
+
+// dispatchExecutionInfoTransformers returns Transformers based on the specified destination and DispatchExecutionInfo
+func (d *Dispatcher) dispatchExecutionInfoTransformers(destination *url.URL, dispatchExecutionInfo *channel.DispatchExecutionInfo, maxDataLength int) binding.Transformers {
+	if destination == nil {
+		destination = &url.URL{}
+	}
+	destination = d.sanitizeURL(destination)
+	// Unprintable control characters are not allowed in header values
+	// and cause HTTP requests to fail if not removed.
+	httpBody := sanitizeHTTPBody(dispatchExecutionInfo.ResponseBody)
+	if len(httpBody) > maxDataLength {
+		httpBody = httpBody[:maxDataLength]
+	}
+	return attributes.KnativeErrorTransformers(*destination, dispatchExecutionInfo.ResponseCode, httpBody)
+}
+
+func sanitizeHTTPBody(body []byte) string {
+	sanitized := make([]byte, 0, len(body))
+	for _, v := range body {
+		if !isControl(v) {
+			sanitized = append(sanitized, v)
+		}
+	}
+	return string(sanitized)
+}
+
+func isControl(c byte) bool {
+	// US ASCII codes range for printable graphic characters and a space.
+	const asciiUnitSeparator = 31
+	const asciiRubout = 127
+
+	return int(c) < asciiUnitSeparator || int(c) > asciiRubout
+}
+
+// isFailure returns true if the status code is not a successful HTTP status.
+func isFailure(statusCode int) bool {
+	return statusCode < nethttp.StatusOK /* 200 */ ||
+		statusCode >= nethttp.StatusMultipleChoices /* 300 */
+}
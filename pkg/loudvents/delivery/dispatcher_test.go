@@ -0,0 +1,522 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/event"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/kncloudevents"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/compression"
+)
+
+// recorder is a test server that fails the first requests it receives.
+type recorder struct {
+	mu       sync.Mutex
+	failures int
+	events   []*event.Event
+}
+
+func (r *recorder) ServeHTTP(w nethttp.ResponseWriter, req *nethttp.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+		return
+	}
+	e, err := binding.ToEvent(req.Context(), cehttp.NewMessageFromHttpRequest(req))
+	if err != nil {
+		w.WriteHeader(nethttp.StatusBadRequest)
+		return
+	}
+	r.events = append(r.events, e)
+	w.WriteHeader(nethttp.StatusAccepted)
+}
+
+func (r *recorder) received() []*event.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events
+}
+
+func newServer(t *testing.T, failures int) (*recorder, *url.URL) {
+	rec := &recorder{failures: failures}
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return rec, u
+}
+
+func newMessage() binding.Message {
+	e := event.New()
+	e.SetID("1")
+	e.SetType("test.type")
+	e.SetSource("test")
+	return binding.ToMessage(&e)
+}
+
+func retryConfig(retries int, backoff time.Duration) *kncloudevents.RetryConfig {
+	return &kncloudevents.RetryConfig{
+		RetryMax:   retries,
+		CheckRetry: kncloudevents.RetryIfGreaterThan300,
+		Backoff: func(int, *nethttp.Response) time.Duration {
+			return backoff
+		},
+	}
+}
+
+func TestDispatchRetries(t *testing.T) {
+	dest, destURL := newServer(t, 2)
+	d := NewDispatcher(zap.NewNop())
+
+	res, err := d.Dispatch(context.Background(), &Request{
+		Message:     newMessage(),
+		Destination: destURL,
+		Retry:       retryConfig(3, time.Millisecond),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", res.Attempts)
+	}
+	if len(dest.received()) != 1 {
+		t.Errorf("Expected the event to be delivered once, got %d", len(dest.received()))
+	}
+}
+
+func TestDispatchAcquire(t *testing.T) {
+	_, destURL := newServer(t, 2)
+	d := NewDispatcher(zap.NewNop())
+
+	var mu sync.Mutex
+	var held, acquired int
+	acquire := func(context.Context) (func(), error) {
+		mu.Lock()
+		defer mu.Unlock()
+		held++
+		acquired++
+		return func() {
+			mu.Lock()
+			defer mu.Unlock()
+			held--
+		}, nil
+	}
+
+	retry := retryConfig(3, time.Millisecond)
+	retry.Backoff = func(int, *nethttp.Response) time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		if held != 0 {
+			t.Errorf("Expected no slot to be held while backing off, got %d", held)
+		}
+		return time.Millisecond
+	}
+
+	res, err := d.Dispatch(context.Background(), &Request{
+		Message:     newMessage(),
+		Destination: destURL,
+		Retry:       retry,
+		Acquire:     acquire,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if acquired != res.Attempts {
+		t.Errorf("Expected a slot for each of the %d attempts, got %d", res.Attempts, acquired)
+	}
+	if held != 0 {
+		t.Errorf("Expected all slots to be freed, got %d held", held)
+	}
+}
+
+func TestDispatchExpired(t *testing.T) {
+	testCases := map[string]struct {
+		deadLetterExpired bool
+		wantDeadLettered  bool
+	}{
+		"Drop": {},
+		"Dead letter": {
+			deadLetterExpired: true,
+			wantDeadLettered:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, destURL := newServer(t, 10)
+			dls, dlsURL := newServer(t, 0)
+			d := NewDispatcher(zap.NewNop())
+
+			res, err := d.Dispatch(context.Background(), &Request{
+				Message:           newMessage(),
+				Destination:       destURL,
+				DeadLetter:        dlsURL,
+				Retry:             retryConfig(10, time.Second),
+				Expires:           time.Now().Add(500 * time.Millisecond),
+				DeadLetterExpired: tc.deadLetterExpired,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !res.Expired {
+				t.Error("Expected the event to expire")
+			}
+			if res.Attempts != 1 {
+				t.Errorf("Expected no retries after the backoff exceeds the TTL, got %d attempts", res.Attempts)
+			}
+
+			got := dls.received()
+			if !tc.wantDeadLettered {
+				if len(got) != 0 {
+					t.Errorf("Expected the event to be dropped, got %d dead lettered", len(got))
+				}
+				return
+			}
+			if len(got) != 1 {
+				t.Fatalf("Expected the event to be dead lettered, got %d", len(got))
+			}
+			if reason := got[0].Extensions()[DeadLetterReasonExtension]; reason != ReasonExpired {
+				t.Errorf("Expected dead letter reason %q, got %v", ReasonExpired, reason)
+			}
+		})
+	}
+}
+
+func TestDispatchDeadLetterEnrichment(t *testing.T) {
+	_, destURL := newServer(t, 10)
+	dls, dlsURL := newServer(t, 0)
+	d := NewDispatcher(zap.NewNop())
+
+	_, err := d.Dispatch(context.Background(), &Request{
+		Message:     newMessage(),
+		Destination: destURL,
+		DeadLetter:  dlsURL,
+		Retry:       retryConfig(2, time.Millisecond),
+		Channel:     "ns/channel",
+		Enrichment:  &Enrichment{},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := dls.received()
+	if len(got) != 1 {
+		t.Fatalf("Expected the event to be dead lettered, got %d", len(got))
+	}
+	ext := got[0].Extensions()
+	// Extensions are received in binary mode, as strings.
+	for k, want := range map[string]string{
+		DeadLetterChannelExtension:    "ns/channel",
+		DeadLetterSubscriberExtension: destURL.String(),
+		DeadLetterAttemptsExtension:   "3",
+		"knativeerrorcode":            "503",
+	} {
+		if fmt.Sprint(ext[k]) != want {
+			t.Errorf("Expected extension %s to be %v, got %v", k, want, ext[k])
+		}
+	}
+	for _, k := range []string{DeadLetterFirstTimeExtension, DeadLetterLastTimeExtension, "knativeerrordest"} {
+		if _, ok := ext[k]; !ok {
+			t.Errorf("Expected extension %s to be set", k)
+		}
+	}
+}
+
+func TestDispatchBatch(t *testing.T) {
+	var attempts int
+	var contentType, body string
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, req *nethttp.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(nethttp.StatusServiceUnavailable)
+			return
+		}
+		b, _ := ioutil.ReadAll(req.Body)
+		contentType, body = req.Header.Get("Content-Type"), string(b)
+		w.WriteHeader(nethttp.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	destURL, _ := url.Parse(srv.URL)
+
+	d := NewDispatcher(zap.NewNop())
+	res, err := d.DispatchBatch(context.Background(), &BatchRequest{
+		Body:        []byte(`[{"specversion":"1.0","id":"1","type":"t","source":"s"}]`),
+		ContentType: "application/cloudevents-batch+json",
+		Destination: destURL,
+		Retry:       retryConfig(1, time.Millisecond),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", res.Attempts)
+	}
+	if contentType != "application/cloudevents-batch+json" || !strings.HasPrefix(body, `[{"specversion"`) {
+		t.Errorf("Unexpected batch request %q: %s", contentType, body)
+	}
+}
+
+func TestDispatchContentMode(t *testing.T) {
+	contentTypes := make(chan string, 1)
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, req *nethttp.Request) {
+		contentTypes <- req.Header.Get("Content-Type")
+		w.WriteHeader(nethttp.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+	destURL, _ := url.Parse(srv.URL)
+
+	d := NewDispatcher(zap.NewNop())
+	// The test event has no data, so binary requests have no content type.
+	for mode, expected := range map[ContentMode]string{
+		ContentModeStructured:  "application/cloudevents+json",
+		ContentModeBinary:      "",
+		ContentModePassthrough: "",
+	} {
+		if _, err := d.Dispatch(context.Background(), &Request{
+			Message:     newMessage(),
+			Destination: destURL,
+			ContentMode: mode,
+		}); err != nil {
+			t.Fatalf("Unexpected error dispatching in %s mode: %v", mode, err)
+		}
+		if got := <-contentTypes; strings.Split(got, ";")[0] != expected {
+			t.Errorf("Unexpected content type in %s mode: %q", mode, got)
+		}
+	}
+}
+
+func TestDispatchCompression(t *testing.T) {
+	encodings := make(chan string, 1)
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, req *nethttp.Request) {
+		encodings <- req.Header.Get("Content-Encoding")
+		w.WriteHeader(nethttp.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+	destURL, _ := url.Parse(srv.URL)
+
+	d := NewDispatcher(zap.NewNop())
+	for minSize, expected := range map[int]string{0: "gzip", 1 << 20: ""} {
+		e := event.New()
+		e.SetID("1")
+		e.SetType("test.type")
+		e.SetSource("test")
+		_ = e.SetData(event.ApplicationJSON, map[string]string{"key": strings.Repeat("value", 100)})
+
+		res, err := d.Dispatch(context.Background(), &Request{
+			Message:     binding.ToMessage(&e),
+			Destination: destURL,
+			Compression: &compression.Config{Encoding: compression.Gzip, MinSize: minSize},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := <-encodings; got != expected {
+			t.Errorf("Expected content encoding %q with min size %d, got %q", expected, minSize, got)
+		}
+		if (res.Compression != nil) != (expected != "") {
+			t.Errorf("Unexpected compression stats with min size %d: %+v", minSize, res.Compression)
+		}
+	}
+}
+
+func TestDispatchHopCount(t *testing.T) {
+	testCases := map[string]struct {
+		hopCount               int
+		deadLetterHopsExceeded bool
+		wantHops               int
+		wantExceeded           bool
+		wantDeadLettered       bool
+	}{
+		"Stamped": {
+			hopCount: 2,
+			wantHops: 3,
+		},
+		"Dropped": {
+			hopCount:     3,
+			wantExceeded: true,
+		},
+		"Dead lettered": {
+			hopCount:               3,
+			deadLetterHopsExceeded: true,
+			wantExceeded:           true,
+			wantDeadLettered:       true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dest, destURL := newServer(t, 0)
+			dls, dlsURL := newServer(t, 0)
+			d := NewDispatcher(zap.NewNop())
+
+			res, err := d.Dispatch(context.Background(), &Request{
+				Message:                newMessage(),
+				Destination:            destURL,
+				DeadLetter:             dlsURL,
+				HopCount:               tc.hopCount,
+				MaxHops:                3,
+				DeadLetterHopsExceeded: tc.deadLetterHopsExceeded,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if res.HopsExceeded != tc.wantExceeded {
+				t.Errorf("Expected hops exceeded %t, got %t", tc.wantExceeded, res.HopsExceeded)
+			}
+
+			if !tc.wantExceeded {
+				got := dest.received()
+				if len(got) != 1 {
+					t.Fatalf("Expected the event to be delivered, got %d", len(got))
+				}
+				if hops := HopCount(got[0]); hops != tc.wantHops {
+					t.Errorf("Expected hop count %v, got %v", tc.wantHops, hops)
+				}
+				return
+			}
+
+			if got := dest.received(); len(got) != 0 {
+				t.Errorf("Expected the event not to be delivered, got %d", len(got))
+			}
+			got := dls.received()
+			if !tc.wantDeadLettered {
+				if len(got) != 0 {
+					t.Errorf("Expected the event to be dropped, got %d dead lettered", len(got))
+				}
+				return
+			}
+			if len(got) != 1 {
+				t.Fatalf("Expected the event to be dead lettered, got %d", len(got))
+			}
+			if reason := got[0].Extensions()[DeadLetterReasonExtension]; reason != ReasonHopsExceeded {
+				t.Errorf("Expected dead letter reason %q, got %v", ReasonHopsExceeded, reason)
+			}
+		})
+	}
+}
+
+// spanRecorder is a trace exporter that keeps the spans it is given.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *spanRecorder) named(name string) []*trace.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var spans []*trace.SpanData
+	for _, s := range r.spans {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func TestDispatchTraceContext(t *testing.T) {
+	exporter := &spanRecorder{}
+	trace.RegisterExporter(exporter)
+	defer trace.UnregisterExporter(exporter)
+
+	dest, destURL := newServer(t, 1)
+	d := NewDispatcher(zap.NewNop())
+
+	ctx, span := trace.StartSpan(context.Background(), "test", trace.WithSampler(trace.AlwaysSample()))
+	defer span.End()
+
+	if _, err := d.Dispatch(ctx, &Request{
+		Message:     newMessage(),
+		Destination: destURL,
+		Retry:       retryConfig(1, time.Millisecond),
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := dest.received()
+	if len(got) != 1 {
+		t.Fatalf("Expected the event to be delivered, got %d", len(got))
+	}
+	sc, ok := SpanContextFromEvent(got[0])
+	if !ok {
+		t.Fatalf("Expected the %s extension, got %v", TraceParentExtension, got[0].Extensions())
+	}
+	if sc.TraceID != span.SpanContext().TraceID {
+		t.Errorf("Expected trace %s, got %s", span.SpanContext().TraceID, sc.TraceID)
+	}
+
+	attempts := exporter.named("loudvents.attempt")
+	if len(attempts) != 2 {
+		t.Fatalf("Expected 2 attempt spans, got %d", len(attempts))
+	}
+	if last := attempts[1].SpanContext; sc.SpanID != last.SpanID {
+		t.Errorf("Expected the extension to refer to the last attempt span %s, got %s", last.SpanID, sc.SpanID)
+	}
+}
+
+func TestDispatchSharedEvent(t *testing.T) {
+	dest, destURL := newServer(t, 0)
+	d := NewDispatcher(zap.NewNop())
+
+	e := event.New()
+	e.SetID("1")
+	e.SetType("test.type")
+	e.SetSource("test")
+
+	ctx, span := trace.StartSpan(context.Background(), "test", trace.WithSampler(trace.AlwaysSample()))
+	defer span.End()
+
+	// The same event is delivered to several subscribers at once.
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.Dispatch(ctx, &Request{Message: binding.ToMessage(&e), Destination: destURL}); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(dest.received()); got != 2 {
+		t.Errorf("Expected the event to be delivered twice, got %d", got)
+	}
+	if _, ok := e.Extensions()[TraceParentExtension]; ok {
+		t.Errorf("Expected the delivered event not to be modified, got extensions %v", e.Extensions())
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package delivery
+
+import (
+	"errors"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/binding/transformer"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+const (
+	// HopCountExtension counts the deliveries and replies an event went
+	// through, so that loops can be detected.
+	HopCountExtension = "hopcount"
+
+	// DefaultMaxHops is the hop limit used when not configured.
+	DefaultMaxHops = 32
+
+	// ReasonHopsExceeded is the dead letter reason for events that exceeded
+	// the hop limit.
+	ReasonHopsExceeded = "hopsexceeded"
+)
+
+// errHopsExceeded is returned when delivering a message would exceed the hop limit.
+var errHopsExceeded = errors.New("hop limit exceeded")
+
+// HopCount returns the hops stamped on the event, zero when not present or invalid.
+func HopCount(e *event.Event) int {
+	v, ok := e.Extensions()[HopCountExtension]
+	if !ok {
+		return 0
+	}
+	hops, err := types.ToInteger(v)
+	if err != nil || hops < 0 {
+		return 0
+	}
+	return int(hops)
+}
+
+// hopCountTransformer stamps the hop count on messages.
+func hopCountTransformer(hops int) binding.Transformer {
+	return transformer.SetExtension(HopCountExtension, func(interface{}) (interface{}, error) {
+		return int32(hops), nil
+	})
+}
+
+// hopsExceeded returns whether the hop count is over the request limit.
+func (r *Request) hopsExceeded(hops int) bool {
+	return r.MaxHops > 0 && hops > r.MaxHops
+}
+
+// HopLimit configures loop detection.
+type HopLimit struct {
+	// Max is the highest hop count messages can be sent with, no limit when zero.
+	Max int `json:"max,omitempty"`
+	// DeadLetter sends messages that exceed the limit to the dead letter
+	// sink, otherwise they are dropped.
+	DeadLetter bool `json:"deadLetter,omitempty"`
+}
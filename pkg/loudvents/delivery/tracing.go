@@ -0,0 +1,132 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package delivery
+
+import (
+	"fmt"
+	nethttp "net/http"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/binding/spec"
+	"github.com/cloudevents/sdk-go/v2/binding/transformer"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/trace"
+)
+
+// W3C trace context extensions, as defined by the CloudEvents distributed
+// tracing extension.
+const (
+	TraceParentExtension = "traceparent"
+	TraceStateExtension  = "tracestate"
+)
+
+// Span attributes.
+const (
+	ChannelAttribute    = "loudvents.channel"
+	SubscriberAttribute = "loudvents.subscriber"
+	TargetAttribute     = "loudvents.target"
+	AttemptAttribute    = "loudvents.attempt"
+	RetriesAttribute    = "loudvents.retries"
+	EventTypeAttribute  = "cloudevents.type"
+	EventIDAttribute    = "cloudevents.id"
+	StatusCodeAttribute = "http.status_code"
+)
+
+// Targets of the messages sent by the dispatcher.
+const (
+	TargetDestination = "destination"
+	TargetReply       = "reply"
+	TargetDeadLetter  = "dead_letter"
+	TargetBatch       = "batch"
+)
+
+var traceContextFormat = &tracecontext.HTTPFormat{}
+
+// SpanContextFromEvent returns the span context of the event trace context
+// extensions, if any.
+func SpanContextFromEvent(e *event.Event) (trace.SpanContext, bool) {
+	tp, ok := e.Extensions()[TraceParentExtension].(string)
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+	ts, _ := e.Extensions()[TraceStateExtension].(string)
+	return traceContextFormat.SpanContextFromHeaders(tp, ts)
+}
+
+// EventAttributes returns the span attributes that identify the event.
+func EventAttributes(e *event.Event) []trace.Attribute {
+	return []trace.Attribute{
+		trace.StringAttribute(EventTypeAttribute, e.Type()),
+		trace.StringAttribute(EventIDAttribute, e.ID()),
+	}
+}
+
+// eventAttributesTransformer adds the attributes that identify the event
+// of a message to the span.
+func eventAttributesTransformer(span *trace.Span) binding.TransformerFunc {
+	return func(reader binding.MessageMetadataReader, _ binding.MessageMetadataWriter) error {
+		if _, v := reader.GetAttribute(spec.Type); v != nil {
+			span.AddAttributes(trace.StringAttribute(EventTypeAttribute, fmt.Sprint(v)))
+		}
+		if _, v := reader.GetAttribute(spec.ID); v != nil {
+			span.AddAttributes(trace.StringAttribute(EventIDAttribute, fmt.Sprint(v)))
+		}
+		return nil
+	}
+}
+
+// traceContextTransformer sets the trace context extensions of messages to
+// the span of the delivery attempt, so that the trace is followed by
+// receivers that do not look at the traceparent header.
+func traceContextTransformer(span *trace.Span) binding.Transformers {
+	tp, ts := traceContextFormat.SpanContextToHeaders(span.SpanContext())
+	transformers := binding.Transformers{
+		transformer.SetExtension(TraceParentExtension, func(interface{}) (interface{}, error) {
+			return tp, nil
+		}),
+	}
+	if ts != "" {
+		transformers = append(transformers, transformer.SetExtension(TraceStateExtension, func(interface{}) (interface{}, error) {
+			return ts, nil
+		}))
+	}
+	return transformers
+}
+
+// endAttemptSpan ends the span of a delivery attempt with its outcome.
+func endAttemptSpan(span *trace.Span, resp *nethttp.Response, err error) {
+	code := 0
+	if resp != nil {
+		code = resp.StatusCode
+		if err == nil && isFailure(code) {
+			err = fmt.Errorf("unexpected HTTP response, expected 2xx, got %d", code)
+		}
+	}
+	setSpanStatus(span, code, err)
+	span.End()
+}
+
+// setSpanStatus sets the span status from the HTTP status code of the
+// response and the request error.
+func setSpanStatus(span *trace.Span, code int, err error) {
+	if code > 0 {
+		span.AddAttributes(trace.Int64Attribute(StatusCodeAttribute, int64(code)))
+	}
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+		return
+	}
+	span.SetStatus(trace.Status{Code: trace.StatusCodeOK})
+}
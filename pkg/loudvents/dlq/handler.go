@@ -0,0 +1,244 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dlq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel"
+)
+
+// PathPrefix is the path the handler serves.
+const PathPrefix = "/deadletters"
+
+// RedriveRequest selects the entries to redrive, and optionally the URI
+// to send them to instead of the original subscriber.
+type RedriveRequest struct {
+	IDs        []string  `json:"ids,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Channel    string    `json:"channel,omitempty"`
+	Subscriber string    `json:"subscriber,omitempty"`
+	From       time.Time `json:"from,omitempty"`
+	To         time.Time `json:"to,omitempty"`
+	Target     string    `json:"target,omitempty"`
+}
+
+// RedriveResult informs the outcome of redriving an entry.
+type RedriveResult struct {
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// Handler serves the dead letter store admin API:
+//
+//	GET    /deadletters          list entries, filtered by query parameters
+//	DELETE /deadletters          delete the entries selected by query parameters
+//	GET    /deadletters/{id}     fetch an entry including its event
+//	DELETE /deadletters/{id}     delete an entry
+//	POST   /deadletters/redrive  redrive the entries selected by a RedriveRequest
+//
+// Query parameters are namespace, channel, subscriber, and from and to as
+// RFC3339 timestamps. Redriven entries are removed from the store once
+// delivered, and requested IDs that do not exist are reported as not found.
+type Handler struct {
+	store      *Store
+	dispatcher channel.MessageDispatcher
+	logger     *zap.Logger
+}
+
+// NewHandler creates the admin API handler for the store.
+func NewHandler(store *Store, dispatcher channel.MessageDispatcher, logger *zap.Logger) *Handler {
+	return &Handler{
+		store:      store,
+		dispatcher: dispatcher,
+		logger:     logger,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+
+	switch {
+	case path == "redrive" && r.Method == nethttp.MethodPost:
+		h.redrive(w, r)
+	case path == "" && r.Method == nethttp.MethodGet:
+		f, err := filterFromQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, nethttp.StatusBadRequest, err)
+			return
+		}
+		entries := h.store.List(f)
+		if entries == nil {
+			entries = []Entry{}
+		}
+		writeJSON(w, nethttp.StatusOK, map[string]interface{}{"entries": entries})
+	case path == "" && r.Method == nethttp.MethodDelete:
+		f, err := filterFromQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, nethttp.StatusBadRequest, err)
+			return
+		}
+		if f.IsEmpty() {
+			writeError(w, nethttp.StatusBadRequest, errors.New("at least one filter is required to delete entries"))
+			return
+		}
+		deleted := 0
+		for _, e := range h.store.List(f) {
+			if err := h.store.Delete(e.ID); err == nil {
+				deleted++
+			}
+		}
+		writeJSON(w, nethttp.StatusOK, map[string]int{"deleted": deleted})
+	case path != "" && r.Method == nethttp.MethodGet:
+		e, err := h.store.Get(path)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, nethttp.StatusOK, e)
+	case path != "" && r.Method == nethttp.MethodDelete:
+		if err := h.store.Delete(path); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(nethttp.StatusNoContent)
+	default:
+		w.WriteHeader(nethttp.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) redrive(w nethttp.ResponseWriter, r *nethttp.Request) {
+	req := &RedriveRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, nethttp.StatusBadRequest, fmt.Errorf("decoding redrive request: %w", err))
+		return
+	}
+
+	f := Filter{
+		IDs:        req.IDs,
+		Namespace:  req.Namespace,
+		Channel:    req.Channel,
+		Subscriber: req.Subscriber,
+		From:       req.From,
+		To:         req.To,
+	}
+	if f.IsEmpty() {
+		writeError(w, nethttp.StatusBadRequest, errors.New("at least one filter is required to redrive entries"))
+		return
+	}
+
+	var target *url.URL
+	if req.Target != "" {
+		var err error
+		if target, err = url.Parse(req.Target); err != nil || !target.IsAbs() {
+			writeError(w, nethttp.StatusBadRequest, fmt.Errorf("invalid target URI %q", req.Target))
+			return
+		}
+	}
+
+	results := []RedriveResult{}
+	listed := make(map[string]bool)
+	for _, meta := range h.store.List(f) {
+		listed[meta.ID] = true
+		res := RedriveResult{ID: meta.ID}
+		if err := h.redriveEntry(r, meta.ID, target); err != nil {
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+	}
+	// Report the requested entries that do not exist, or do not match the
+	// rest of the filter.
+	for _, id := range req.IDs {
+		if !listed[id] {
+			results = append(results, RedriveResult{ID: id, Error: ErrNotFound.Error()})
+		}
+	}
+	writeJSON(w, nethttp.StatusOK, map[string]interface{}{"results": results})
+}
+
+// redriveEntry sends the entry event to the target, or to the original
+// subscriber when nil, deleting it from the store once delivered.
+func (h *Handler) redriveEntry(r *nethttp.Request, id string, target *url.URL) error {
+	e, err := h.store.Get(id)
+	if err != nil {
+		return err
+	}
+
+	dest := target
+	if dest == nil {
+		if e.Subscriber == "" {
+			return errors.New("entry has no subscriber, a target is required")
+		}
+		if dest, err = url.Parse(e.Subscriber); err != nil {
+			return fmt.Errorf("parsing subscriber URI: %w", err)
+		}
+	}
+
+	if _, err := h.dispatcher.DispatchMessage(r.Context(), binding.ToMessage(e.Event), e.Headers, dest, nil, nil); err != nil {
+		return err
+	}
+	h.logger.Info("Redrove dead lettered event",
+		zap.String("id", id), zap.String("destination", dest.String()),
+		zap.String("source", e.Event.Source()), zap.String("eventID", e.Event.ID()))
+
+	return h.store.Delete(id)
+}
+
+func filterFromQuery(q url.Values) (Filter, error) {
+	f := Filter{
+		Namespace:  q.Get("namespace"),
+		Channel:    q.Get("channel"),
+		Subscriber: q.Get("subscriber"),
+	}
+	var err error
+	if v := q.Get("from"); v != "" {
+		if f.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, fmt.Errorf("invalid from parameter: %w", err)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if f.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, fmt.Errorf("invalid to parameter: %w", err)
+		}
+	}
+	return f, nil
+}
+
+func writeStoreError(w nethttp.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		writeError(w, nethttp.StatusNotFound, err)
+		return
+	}
+	writeError(w, nethttp.StatusInternalServerError, err)
+}
+
+func writeError(w nethttp.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w nethttp.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
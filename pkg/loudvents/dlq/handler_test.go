@@ -0,0 +1,250 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dlq
+
+import (
+	"bytes"
+	"encoding/json"
+	nethttp "net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel"
+)
+
+// newSink returns a test event sink answering with the status code, along
+// with the number of requests it received.
+func newSink(t *testing.T, code int) (string, *int32) {
+	var received int32
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, _ *nethttp.Request) {
+		atomic.AddInt32(&received, 1)
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &received
+}
+
+func newTestHandler(t *testing.T, entries ...*Entry) (*Handler, *Store) {
+	s, err := NewStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error creating store: %v", err)
+	}
+	for _, e := range entries {
+		if err := s.Add(e); err != nil {
+			t.Fatalf("Unexpected error adding entry: %v", err)
+		}
+	}
+	logger := zap.NewNop()
+	return NewHandler(s, channel.NewMessageDispatcher(logger), logger), s
+}
+
+func serve(h nethttp.Handler, method, target string, body []byte) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(method, target, bytes.NewReader(body)))
+	return res
+}
+
+func TestHandlerList(t *testing.T) {
+	h, _ := newTestHandler(t,
+		newEntry("ch1", "http://a", "1"),
+		newEntry("ch2", "http://a", "2"),
+		newEntry("ch1", "http://b", "3"),
+	)
+
+	testCases := map[string]struct {
+		query       string
+		wantCode    int
+		wantEntries int
+	}{
+		"all entries": {
+			wantCode:    nethttp.StatusOK,
+			wantEntries: 3,
+		},
+		"by channel": {
+			query:       "?channel=ch1",
+			wantCode:    nethttp.StatusOK,
+			wantEntries: 2,
+		},
+		"no matches": {
+			query:       "?channel=ch3",
+			wantCode:    nethttp.StatusOK,
+			wantEntries: 0,
+		},
+		"invalid time": {
+			query:    "?from=yesterday",
+			wantCode: nethttp.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			res := serve(h, nethttp.MethodGet, PathPrefix+tc.query, nil)
+			if res.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d", tc.wantCode, res.Code)
+			}
+			if tc.wantCode != nethttp.StatusOK {
+				return
+			}
+			var body struct {
+				Entries []Entry `json:"entries"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("Unexpected error decoding the response: %v", err)
+			}
+			if body.Entries == nil || len(body.Entries) != tc.wantEntries {
+				t.Errorf("Expected %d entries, got %v", tc.wantEntries, body.Entries)
+			}
+		})
+	}
+}
+
+func TestHandlerEntry(t *testing.T) {
+	h, s := newTestHandler(t, newEntry("ch1", "http://a", "1"))
+	id := s.List(Filter{})[0].ID
+
+	res := serve(h, nethttp.MethodGet, PathPrefix+"/"+id, nil)
+	if res.Code != nethttp.StatusOK {
+		t.Fatalf("Expected status 200, got %d", res.Code)
+	}
+	e := &Entry{}
+	if err := json.NewDecoder(res.Body).Decode(e); err != nil {
+		t.Fatalf("Unexpected error decoding the response: %v", err)
+	}
+	if e.Event == nil || e.Event.ID() != "1" {
+		t.Errorf("Expected the entry to include event 1, got %v", e.Event)
+	}
+
+	if res := serve(h, nethttp.MethodGet, PathPrefix+"/missing", nil); res.Code != nethttp.StatusNotFound {
+		t.Errorf("Expected status 404 getting a missing entry, got %d", res.Code)
+	}
+	if res := serve(h, nethttp.MethodDelete, PathPrefix+"/missing", nil); res.Code != nethttp.StatusNotFound {
+		t.Errorf("Expected status 404 deleting a missing entry, got %d", res.Code)
+	}
+	if res := serve(h, nethttp.MethodDelete, PathPrefix, nil); res.Code != nethttp.StatusBadRequest {
+		t.Errorf("Expected status 400 deleting entries without a filter, got %d", res.Code)
+	}
+
+	if res := serve(h, nethttp.MethodDelete, PathPrefix+"/"+id, nil); res.Code != nethttp.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", res.Code)
+	}
+	if s.Len() != 0 {
+		t.Errorf("Expected the entry to be deleted, got %d entries", s.Len())
+	}
+}
+
+func TestHandlerRedrive(t *testing.T) {
+	okSink, _ := newSink(t, nethttp.StatusAccepted)
+	failingSink, _ := newSink(t, nethttp.StatusInternalServerError)
+
+	testCases := map[string]struct {
+		subscriber string
+		// request returns the redrive request for the stored entry ID.
+		request    func(id string) *RedriveRequest
+		wantCode   int
+		wantKept   int
+		wantErrors int
+	}{
+		"original subscriber": {
+			subscriber: okSink,
+			request:    func(id string) *RedriveRequest { return &RedriveRequest{IDs: []string{id}} },
+			wantCode:   nethttp.StatusOK,
+			wantKept:   0,
+		},
+		"target": {
+			subscriber: failingSink,
+			request: func(id string) *RedriveRequest {
+				return &RedriveRequest{Channel: "ch1", Target: okSink}
+			},
+			wantCode: nethttp.StatusOK,
+			wantKept: 0,
+		},
+		"delivery failure": {
+			subscriber: failingSink,
+			request:    func(id string) *RedriveRequest { return &RedriveRequest{IDs: []string{id}} },
+			wantCode:   nethttp.StatusOK,
+			wantKept:   1,
+			wantErrors: 1,
+		},
+		"no subscriber": {
+			request:    func(id string) *RedriveRequest { return &RedriveRequest{IDs: []string{id}} },
+			wantCode:   nethttp.StatusOK,
+			wantKept:   1,
+			wantErrors: 1,
+		},
+		"missing ID": {
+			subscriber: okSink,
+			request: func(id string) *RedriveRequest {
+				return &RedriveRequest{IDs: []string{id, "missing"}}
+			},
+			wantCode:   nethttp.StatusOK,
+			wantKept:   0,
+			wantErrors: 1,
+		},
+		"no filter": {
+			subscriber: okSink,
+			request:    func(string) *RedriveRequest { return &RedriveRequest{} },
+			wantCode:   nethttp.StatusBadRequest,
+			wantKept:   1,
+		},
+		"invalid target": {
+			subscriber: okSink,
+			request: func(id string) *RedriveRequest {
+				return &RedriveRequest{IDs: []string{id}, Target: "not/absolute"}
+			},
+			wantCode: nethttp.StatusBadRequest,
+			wantKept: 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			h, s := newTestHandler(t, newEntry("ch1", tc.subscriber, "1"))
+			id := s.List(Filter{})[0].ID
+
+			body, err := json.Marshal(tc.request(id))
+			if err != nil {
+				t.Fatalf("Unexpected error encoding the request: %v", err)
+			}
+			res := serve(h, nethttp.MethodPost, PathPrefix+"/redrive", body)
+			if res.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d", tc.wantCode, res.Code)
+			}
+			if s.Len() != tc.wantKept {
+				t.Errorf("Expected %d entries kept, got %d", tc.wantKept, s.Len())
+			}
+			if tc.wantCode != nethttp.StatusOK {
+				return
+			}
+
+			var out struct {
+				Results []RedriveResult `json:"results"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+				t.Fatalf("Unexpected error decoding the response: %v", err)
+			}
+			errs := 0
+			for _, r := range out.Results {
+				if r.Error != "" {
+					errs++
+				}
+			}
+			if errs != tc.wantErrors {
+				t.Errorf("Expected %d failed results, got %+v", tc.wantErrors, out.Results)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dlq implements a dispatcher local dead letter store, which keeps
+// the events that could not be delivered to subscribers without a dead
+// letter sink so that they can be inspected and redriven.
+package dlq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	nethttp "net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// DefaultMaxEntries is the number of entries kept when not configured.
+const DefaultMaxEntries = 10000
+
+// ErrNotFound is returned when an entry does not exist.
+var ErrNotFound = errors.New("dead letter entry not found")
+
+// Entry is a dead lettered event along with its delivery failure details.
+type Entry struct {
+	ID         string    `json:"id"`
+	Namespace  string    `json:"namespace"`
+	Channel    string    `json:"channel"`
+	Subscriber string    `json:"subscriber"`
+	Time       time.Time `json:"time"`
+
+	Attempts     int    `json:"attempts,omitempty"`
+	ResponseCode int    `json:"responseCode,omitempty"`
+	ResponseBody string `json:"responseBody,omitempty"`
+	Error        string `json:"error,omitempty"`
+
+	Event   *event.Event   `json:"event,omitempty"`
+	Headers nethttp.Header `json:"headers,omitempty"`
+}
+
+// Filter selects entries. Empty fields match any entry.
+type Filter struct {
+	IDs        []string
+	Namespace  string
+	Channel    string
+	Subscriber string
+	From       time.Time
+	To         time.Time
+}
+
+// IsEmpty returns whether the filter matches all entries.
+func (f *Filter) IsEmpty() bool {
+	return len(f.IDs) == 0 && f.Namespace == "" && f.Channel == "" && f.Subscriber == "" &&
+		f.From.IsZero() && f.To.IsZero()
+}
+
+func (f *Filter) matches(e *Entry) bool {
+	if len(f.IDs) > 0 {
+		found := false
+		for _, id := range f.IDs {
+			if id == e.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return (f.Namespace == "" || f.Namespace == e.Namespace) &&
+		(f.Channel == "" || f.Channel == e.Channel) &&
+		(f.Subscriber == "" || f.Subscriber == e.Subscriber) &&
+		(f.From.IsZero() || !e.Time.Before(f.From)) &&
+		(f.To.IsZero() || e.Time.Before(f.To))
+}
+
+// target identifies the channel subscriber entries are indexed by.
+type target struct {
+	namespace  string
+	channel    string
+	subscriber string
+}
+
+// Store keeps entries as files under a directory, usually backed by a
+// persistent volume. Entry metadata is indexed in memory, while events are
+// read from disk when fetched. The oldest entries are evicted when the
+// store is full.
+type Store struct {
+	dir        string
+	maxEntries int
+
+	mu       sync.Mutex
+	seq      uint64
+	order    []string
+	entries  map[string]*Entry
+	byTarget map[target]map[string]struct{}
+}
+
+// NewStore creates a Store at dir, loading the entries saved by previous runs.
+func NewStore(dir string, maxEntries int) (*Store, error) {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating dead letter store directory: %w", err)
+	}
+
+	s := &Store{
+		dir:        dir,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*Entry),
+		byTarget:   make(map[target]map[string]struct{}),
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading dead letter store directory: %w", err)
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		e, err := s.read(strings.TrimSuffix(fi.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		e.Event, e.Headers = nil, nil
+		s.index(e)
+	}
+	sort.Strings(s.order)
+
+	return s, nil
+}
+
+// Add saves an entry, assigning its ID and time.
+func (s *Store) Add(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.seq++
+	// IDs sort in the order entries were added.
+	e.ID = fmt.Sprintf("%019d-%06d", now.UnixNano(), s.seq%1000000)
+	e.Time = now
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding dead letter entry: %w", err)
+	}
+	path := s.path(e.ID)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("writing dead letter entry: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing dead letter entry: %w", err)
+	}
+
+	meta := *e
+	meta.Event, meta.Headers = nil, nil
+	s.index(&meta)
+
+	for len(s.order) > s.maxEntries {
+		if err := s.remove(s.order[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the metadata of the entries that match the filter, oldest first.
+func (s *Store) List(f Filter) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.order
+	if f.Subscriber != "" && f.Channel != "" && f.Namespace != "" {
+		// Use the index when the filter selects a single subscriber.
+		indexed := s.byTarget[target{namespace: f.Namespace, channel: f.Channel, subscriber: f.Subscriber}]
+		ids = make([]string, 0, len(indexed))
+		for id := range indexed {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+
+	var entries []Entry
+	for _, id := range ids {
+		if e := s.entries[id]; f.matches(e) {
+			entries = append(entries, *e)
+		}
+	}
+	return entries
+}
+
+// Get returns the entry, including its event.
+func (s *Store) Get(id string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[id]; !ok {
+		return nil, ErrNotFound
+	}
+	return s.read(id)
+}
+
+// Delete removes the entry.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[id]; !ok {
+		return ErrNotFound
+	}
+	return s.remove(id)
+}
+
+// Len returns the number of entries in the store.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.order)
+}
+
+// index adds the entry metadata to the in memory indexes. Must be called
+// with the lock held, or before the store is shared.
+func (s *Store) index(e *Entry) {
+	s.entries[e.ID] = e
+	s.order = append(s.order, e.ID)
+
+	t := target{namespace: e.Namespace, channel: e.Channel, subscriber: e.Subscriber}
+	ids, ok := s.byTarget[t]
+	if !ok {
+		ids = make(map[string]struct{})
+		s.byTarget[t] = ids
+	}
+	ids[e.ID] = struct{}{}
+}
+
+// remove deletes the entry file and its index. Must be called with the lock held.
+func (s *Store) remove(id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("deleting dead letter entry: %w", err)
+	}
+
+	e := s.entries[id]
+	delete(s.entries, id)
+	if i := sort.SearchStrings(s.order, id); i < len(s.order) && s.order[i] == id {
+		s.order = append(s.order[:i], s.order[i+1:]...)
+	}
+
+	t := target{namespace: e.Namespace, channel: e.Channel, subscriber: e.Subscriber}
+	delete(s.byTarget[t], id)
+	if len(s.byTarget[t]) == 0 {
+		delete(s.byTarget, t)
+	}
+	return nil
+}
+
+func (s *Store) read(id string) (*Entry, error) {
+	b, err := ioutil.ReadFile(s.path(id))
+	if err != nil {
+		return nil, fmt.Errorf("reading dead letter entry %q: %w", id, err)
+	}
+	e := &Entry{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, fmt.Errorf("decoding dead letter entry %q: %w", id, err)
+	}
+	return e, nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
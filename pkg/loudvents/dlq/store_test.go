@@ -0,0 +1,92 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dlq
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+func newEntry(channel, subscriber, id string) *Entry {
+	e := event.New()
+	e.SetID(id)
+	e.SetType("test.type")
+	e.SetSource("test")
+	return &Entry{
+		Namespace:  "ns",
+		Channel:    channel,
+		Subscriber: subscriber,
+		Event:      &e,
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(dir, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error creating store: %v", err)
+	}
+
+	for _, e := range []*Entry{
+		newEntry("ch1", "http://a", "1"),
+		newEntry("ch1", "http://b", "2"),
+		newEntry("ch2", "http://a", "3"),
+		newEntry("ch1", "http://a", "4"),
+	} {
+		if err := s.Add(e); err != nil {
+			t.Fatalf("Unexpected error adding entry: %v", err)
+		}
+	}
+
+	if s.Len() != 3 {
+		t.Fatalf("Expected the oldest entry to be evicted, got %d entries", s.Len())
+	}
+
+	got := s.List(Filter{Namespace: "ns", Channel: "ch1", Subscriber: "http://a"})
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 entry for subscriber, got %d", len(got))
+	}
+	if got[0].Event != nil {
+		t.Error("Expected listed entries not to include the event")
+	}
+
+	full, err := s.Get(got[0].ID)
+	if err != nil {
+		t.Fatalf("Unexpected error getting entry: %v", err)
+	}
+	if full.Event.ID() != "4" {
+		t.Errorf("Expected event 4, got %s", full.Event.ID())
+	}
+
+	// Entries survive restarts.
+	s, err = NewStore(dir, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error reopening store: %v", err)
+	}
+	if s.Len() != 3 {
+		t.Errorf("Expected 3 entries after reopening, got %d", s.Len())
+	}
+
+	if err := s.Delete(full.ID); err != nil {
+		t.Fatalf("Unexpected error deleting entry: %v", err)
+	}
+	if _, err := s.Get(full.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted entry not to be found, got %v", err)
+	}
+	if s.Len() != 2 {
+		t.Errorf("Expected 2 entries after deleting, got %d", s.Len())
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"path/filepath"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/archive"
+)
+
+// setArchive creates, replaces or removes the archive writer. Must be called
+// with the config lock held.
+func (f *MessageHandler) setArchive(cfg *archive.Config) {
+	switch {
+	case f.archiveDir == "":
+		return
+	case f.archive != nil && cfg != nil && f.config.Archive != nil && *f.config.Archive == *cfg:
+		return
+	}
+
+	f.closeArchive()
+	if cfg == nil {
+		return
+	}
+
+	w, err := archive.NewWriter(filepath.Join(f.archiveDir, f.ref.Namespace, f.ref.Name), *cfg)
+	if err != nil {
+		f.logger.Error("Failed to set up the channel archive", zap.Error(err))
+		return
+	}
+	f.archive = w
+}
+
+// closeArchive completes the current archive file. Must be called with the
+// config lock held.
+func (f *MessageHandler) closeArchive() {
+	if f.archive == nil {
+		return
+	}
+	if err := f.archive.Close(); err != nil {
+		f.logger.Error("Failed to close the channel archive", zap.Error(err))
+	}
+	f.archive = nil
+}
+
+// archiveEvent writes the event to the channel archive, if enabled.
+func (f *MessageHandler) archiveEvent(e *event.Event) {
+	f.configMutex.RLock()
+	w := f.archive
+	f.configMutex.RUnlock()
+
+	if w == nil {
+		return
+	}
+	if err := w.Write(e); err != nil {
+		f.logger.Error("Failed to archive event",
+			zap.String("source", e.Source()), zap.String("id", e.ID()), zap.Error(err))
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	nethttp "net/http"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/batch"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+)
+
+// setBatchers creates the batchers for subscriptions with batching enabled,
+// keyed by subscription, keeping the existing ones whose configuration did
+// not change. Batchers no
+// longer needed are flushed in the background. Must be called with the config
+// lock held.
+func (f *MessageHandler) setBatchers(config Config) {
+	batchers := make(map[string]*batch.Batcher)
+	for _, sub := range config.Subscriptions {
+		if sub.Batch == nil || sub.Subscriber == nil {
+			continue
+		}
+		key := sub.key()
+		if b, ok := f.batchers[key]; ok && b.Config() == *sub.Batch {
+			batchers[key] = b
+			continue
+		}
+
+		sub := sub
+		batchers[key] = batch.NewBatcher(*sub.Batch, func(items []batch.Item) {
+			f.flushBatch(key, sub, items)
+		})
+	}
+
+	for key, b := range f.batchers {
+		if batchers[key] != b {
+			go b.Close()
+		}
+	}
+	f.batchers = batchers
+}
+
+// closeBatchers flushes the pending batches, waiting for their delivery.
+func (f *MessageHandler) closeBatchers() {
+	f.configMutex.Lock()
+	batchers := f.batchers
+	f.batchers = nil
+	f.configMutex.Unlock()
+
+	for _, b := range batchers {
+		b.Close()
+	}
+}
+
+// batchEvent adds the event to the subscription batch, holding the memory
+// reserved for the event until the batch is flushed. It returns false when
+// the subscription has no batcher.
+func (f *MessageHandler) batchEvent(ctx context.Context, e *event.Event, additionalHeaders nethttp.Header, sub Subscription) (*channel.DispatchExecutionInfo, bool, error) {
+	f.configMutex.RLock()
+	b := f.batchers[sub.key()]
+	f.configMutex.RUnlock()
+
+	if b == nil {
+		return nil, false, nil
+	}
+
+	release := holdReservation(ctx)
+	err := b.Add(batch.Item{
+		Event:   e,
+		Headers: additionalHeaders,
+		Expires: expiration(ctx, e, sub.TTL),
+		Release: release,
+	})
+	if err != nil {
+		release()
+	}
+	return &channel.DispatchExecutionInfo{
+		Time:         channel.NoDuration,
+		ResponseCode: nethttp.StatusAccepted,
+	}, true, err
+}
+
+// flushBatch delivers a batch to the subscription, using its current
+// delivery options when it is still configured, and releases the resources
+// held for its events.
+func (f *MessageHandler) flushBatch(key string, sub Subscription, items []batch.Item) {
+	defer func() {
+		for _, it := range items {
+			if it.Release != nil {
+				it.Release()
+			}
+		}
+	}()
+
+	for _, s := range f.GetConfig(context.Background()).Subscriptions {
+		if s.Batch != nil && s.Subscriber != nil && s.key() == key {
+			sub = s
+			break
+		}
+	}
+	f.deliverBatch(context.Background(), sub, items)
+}
+
+// deliverBatch sends the items to the subscriber in a single request. A batch
+// expires with its earliest event. Events in failed batches are dead lettered,
+// after splitting the batch in halves to find the failing events when enabled.
+func (f *MessageHandler) deliverBatch(ctx context.Context, sub Subscription, items []batch.Item) {
+	var expires time.Time
+	for _, it := range items {
+		if !it.Expires.IsZero() && (expires.IsZero() || it.Expires.Before(expires)) {
+			expires = it.Expires
+		}
+	}
+
+	res, err := f.dispatcher.DispatchBatch(ctx, &delivery.BatchRequest{
+		Body:        batch.Encode(items),
+		ContentType: batch.ContentType,
+		Headers:     items[0].Headers,
+		Destination: sub.Subscriber,
+		Retry:       sub.RetryConfig,
+		Expires:     expires,
+		Compression: sub.Compression,
+		Acquire:     f.acquire(),
+	})
+	f.reportCompression(metrics.DirectionEgress, "", res.Compression)
+	if err == nil {
+		return
+	}
+
+	if sub.Batch.SplitOnFailure && len(items) > 1 && !res.Expired {
+		f.logger.Warn("Batch delivery failed, splitting batch",
+			zap.String("subscriber", sub.Subscriber.String()), zap.Int("events", len(items)), zap.Error(err))
+		half := len(items) / 2
+		f.deliverBatch(ctx, sub, items[:half])
+		f.deliverBatch(ctx, sub, items[half:])
+		return
+	}
+
+	f.logger.Error("Batch delivery failed",
+		zap.String("subscriber", sub.Subscriber.String()), zap.Int("events", len(items)),
+		zap.Bool("expired", res.Expired), zap.Error(err))
+	for _, it := range items {
+		f.deadLetterBatched(ctx, sub, it, res, err)
+	}
+}
+
+// deadLetterBatched sends an event of a failed batch to the subscription
+// dead letter sink, or to the local dead letter store when there is none.
+func (f *MessageHandler) deadLetterBatched(ctx context.Context, sub Subscription, it batch.Item, res *delivery.Result, deliveryErr error) {
+	if res.Expired {
+		f.reportExpired(it.Event, sub)
+	}
+
+	if sub.DeadLetter == nil {
+		if !res.Expired && f.deadLetters != nil {
+			f.storeDeadLetter(it.Event, it.Headers, sub, res, deliveryErr)
+		}
+		return
+	}
+
+	if _, err := f.dispatcher.DispatchDeadLetter(ctx, &delivery.Request{
+		Message:           binding.ToMessage(it.Event),
+		Headers:           it.Headers,
+		Destination:       sub.Subscriber,
+		DeadLetter:        sub.DeadLetter,
+		Retry:             sub.RetryConfig,
+		DeadLetterExpired: sub.DeadLetterExpired,
+		Channel:           f.ref.Namespace + "/" + f.ref.Name,
+		Enrichment:        f.deadLetterEnrichment(),
+
+		DeadLetterContentMode: eventContentMode(ctx, sub.DeadLetterContentMode),
+	}, res, deliveryErr); err != nil {
+		f.logger.Error("Failed to dead letter batched event",
+			zap.String("subscriber", sub.Subscriber.String()),
+			zap.String("source", it.Event.Source()), zap.String("id", it.Event.ID()), zap.Error(err))
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	nethttp "net/http"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel"
+	"knative.dev/eventing/pkg/utils"
+)
+
+const (
+	// maxBatchBytes is the size of the largest batch body accepted, once
+	// decompressed.
+	maxBatchBytes = 10 << 20
+	// maxBatchEvents is the largest number of events accepted in a batch.
+	maxBatchEvents = 1000
+)
+
+// batchResponseBody is the response body for batch requests.
+type batchResponseBody struct {
+	Accepted int            `json:"accepted"`
+	Refused  int            `json:"refused"`
+	Failures []batchFailure `json:"failures,omitempty"`
+}
+
+// batchFailure describes an event in a batch that was not accepted.
+type batchFailure struct {
+	// Index is the position of the event in the batch.
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Source string `json:"source,omitempty"`
+	Code   int    `json:"code"`
+	ingressErrorBody
+}
+
+// isBatch returns whether the request contains a CloudEvents JSON batch.
+func isBatch(request *nethttp.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	return err == nil && mediaType == event.ApplicationCloudEventsBatchJSON
+}
+
+// receiveBatch handles a request containing a CloudEvents JSON batch. Each
+// event is received as if it had been sent on its own, and refused events
+// are reported in the response body.
+func (f *MessageHandler) receiveBatch(response nethttp.ResponseWriter, request *nethttp.Request) {
+	args := channel.ReportArgs{Ns: f.ref.Namespace}
+
+	raw, err := decodeBatch(request)
+	if err != nil {
+		var ierr *IngressError
+		if !errors.As(err, &ierr) {
+			ierr = &IngressError{Code: nethttp.StatusBadRequest, Err: fmt.Errorf("decoding batch: %w", err)}
+		}
+		f.logger.Info("Cannot decode the cloudevents batch", zap.Error(err))
+		_ = f.reporter.ReportEventCount(&args, ierr.Code)
+		writeIngressError(response, ierr)
+		return
+	}
+
+	headers := utils.PassThroughHeaders(request.Header)
+	body := batchResponseBody{}
+	for i, r := range raw {
+		e := &event.Event{}
+		err := json.Unmarshal(r, e)
+		if err == nil {
+			err = e.Validate()
+		}
+		if err != nil {
+			err = &IngressError{Code: nethttp.StatusBadRequest, Err: fmt.Errorf("decoding event: %w", err)}
+		} else {
+			err = f.receive(request.Context(), binding.ToMessage(e), headers)
+		}
+
+		if err == nil {
+			body.Accepted++
+			continue
+		}
+
+		var ierr *IngressError
+		if !errors.As(err, &ierr) {
+			f.logger.Info("Error in receiver", zap.Error(err))
+			ierr = &IngressError{Code: nethttp.StatusInternalServerError, Err: err}
+		}
+		_ = f.reporter.ReportEventCount(&args, ierr.Code)
+
+		body.Refused++
+		body.Failures = append(body.Failures, batchFailure{
+			Index:            i,
+			ID:               e.ID(),
+			Source:           e.Source(),
+			Code:             ierr.Code,
+			ingressErrorBody: newIngressErrorBody(ierr),
+		})
+	}
+
+	code := nethttp.StatusAccepted
+	if body.Refused > 0 {
+		code = nethttp.StatusMultiStatus
+		f.logger.Debug("Batch events refused", zap.Int("accepted", body.Accepted), zap.Int("refused", body.Refused))
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(code)
+	_ = json.NewEncoder(response).Encode(body)
+}
+
+// decodeBatch reads the events in a batch request without decoding them.
+// Batches larger than maxBatchBytes or with more than maxBatchEvents events
+// are refused with 413 as soon as the limit is exceeded.
+func decodeBatch(request *nethttp.Request) ([]json.RawMessage, error) {
+	if err := limitRequestBody(request, maxBatchBytes); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(request.Body)
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('[') {
+		return nil, errors.New("batch is not an array")
+	}
+
+	var raw []json.RawMessage
+	for dec.More() {
+		if len(raw) == maxBatchEvents {
+			return nil, &IngressError{
+				Code: nethttp.StatusRequestEntityTooLarge,
+				Err:  fmt.Errorf("batch exceeds %d events", maxBatchEvents),
+			}
+		}
+		var r json.RawMessage
+		if err := dec.Decode(&r); err != nil {
+			return nil, err
+		}
+		raw = append(raw, r)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
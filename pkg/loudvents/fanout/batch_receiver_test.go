@@ -0,0 +1,195 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"bytes"
+	"encoding/json"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/budget"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/compression"
+)
+
+// sendBatch posts the batch body to the handler, returning the response.
+func sendBatch(t *testing.T, h nethttp.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(nethttp.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", event.ApplicationCloudEventsBatchJSON)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	return res
+}
+
+// batchOf returns a batch body with the events, which may be raw JSON.
+func batchOf(t *testing.T, events ...interface{}) string {
+	b, err := json.Marshal(events)
+	if err != nil {
+		t.Fatalf("Unexpected error encoding the batch: %v", err)
+	}
+	return string(b)
+}
+
+func TestReceiveBatch(t *testing.T) {
+	// invalid is an event without ID.
+	invalid := json.RawMessage(`{"specversion":"1.0","source":"test","type":"test.type"}`)
+
+	testCases := map[string]struct {
+		body     func(t *testing.T) string
+		code     int
+		want     *batchResponseBody
+		received int
+	}{
+		"valid": {
+			body: func(t *testing.T) string {
+				return batchOf(t, newEvent("1"), newEvent("2"))
+			},
+			code:     nethttp.StatusAccepted,
+			want:     &batchResponseBody{Accepted: 2},
+			received: 2,
+		},
+		"invalid": {
+			body: func(t *testing.T) string {
+				return batchOf(t, invalid)
+			},
+			code: nethttp.StatusMultiStatus,
+			want: &batchResponseBody{Refused: 1, Failures: []batchFailure{
+				{Index: 0, Source: "test", Code: nethttp.StatusBadRequest},
+			}},
+		},
+		"partial failure": {
+			body: func(t *testing.T) string {
+				return batchOf(t, newEvent("1"), invalid, newEvent("2"))
+			},
+			code: nethttp.StatusMultiStatus,
+			want: &batchResponseBody{Accepted: 2, Refused: 1, Failures: []batchFailure{
+				{Index: 1, Source: "test", Code: nethttp.StatusBadRequest},
+			}},
+			received: 2,
+		},
+		"empty array": {
+			body: func(t *testing.T) string { return "[]" },
+			code: nethttp.StatusAccepted,
+			want: &batchResponseBody{},
+		},
+		"malformed JSON": {
+			body: func(t *testing.T) string { return `[{"specversion":` },
+			code: nethttp.StatusBadRequest,
+		},
+		"not an array": {
+			body: func(t *testing.T) string { return batchOf(t, newEvent("1"))[1:] },
+			code: nethttp.StatusBadRequest,
+		},
+		"too many events": {
+			body: func(t *testing.T) string {
+				return "[" + strings.Repeat("{},", maxBatchEvents) + "{}]"
+			},
+			code: nethttp.StatusRequestEntityTooLarge,
+		},
+		"too large": {
+			body: func(t *testing.T) string {
+				return `["` + strings.Repeat("a", maxBatchBytes) + `"]`
+			},
+			code: nethttp.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rec, sub := newSubscriber(t)
+			h := newHandler(t, Config{Subscriptions: []Subscription{sub}})
+
+			res := sendBatch(t, h, tc.body(t))
+			if res.Code != tc.code {
+				t.Fatalf("Expected status %d, got %d: %s", tc.code, res.Code, res.Body)
+			}
+			if tc.want != nil {
+				got := &batchResponseBody{}
+				if err := json.NewDecoder(res.Body).Decode(got); err != nil {
+					t.Fatalf("Unexpected error decoding the response: %v", err)
+				}
+				if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreFields(batchFailure{}, "ingressErrorBody")); diff != "" {
+					t.Errorf("Unexpected response (-want, +got):\n%s", diff)
+				}
+			}
+			if got := rec.received(); got != tc.received {
+				t.Errorf("Expected %d events delivered, got %d", tc.received, got)
+			}
+		})
+	}
+}
+
+func TestReceiveBatchBodyLimit(t *testing.T) {
+	const limit = 1024
+
+	events := make([]interface{}, 0, 20)
+	for i := 0; i < cap(events); i++ {
+		events = append(events, newEvent("1"))
+	}
+	body := batchOf(t, events...)
+	if len(body) <= limit {
+		t.Fatalf("Expected a batch larger than %d bytes, got %d", limit, len(body))
+	}
+
+	testCases := map[string]struct {
+		request func(t *testing.T) *nethttp.Request
+	}{
+		"oversized batch": {
+			request: func(t *testing.T) *nethttp.Request {
+				req := httptest.NewRequest(nethttp.MethodPost, "/", strings.NewReader(body))
+				req.Header.Set("Content-Type", event.ApplicationCloudEventsBatchJSON)
+				return req
+			},
+		},
+		"oversized compressed batch": {
+			request: func(t *testing.T) *nethttp.Request {
+				compressed, _, err := compression.Compress(compression.Gzip, []byte(body))
+				if err != nil {
+					t.Fatalf("Unexpected error compressing the batch: %v", err)
+				}
+				if len(compressed) > limit {
+					t.Fatalf("Expected the compressed batch to fit %d bytes, got %d", limit, len(compressed))
+				}
+				req := httptest.NewRequest(nethttp.MethodPost, "/", bytes.NewReader(compressed))
+				req.Header.Set("Content-Type", event.ApplicationCloudEventsBatchJSON)
+				req.Header.Set("Content-Encoding", compression.Gzip)
+				return req
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rec, sub := newSubscriber(t)
+			h := newHandler(t, Config{Subscriptions: []Subscription{sub}},
+				WithMemoryBudget(budget.New("dispatcher", limit, nil), 10*time.Millisecond))
+
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, tc.request(t))
+			if res.Code != nethttp.StatusRequestEntityTooLarge {
+				t.Errorf("Expected status 413, got %d: %s", res.Code, res.Body)
+			}
+			if got := rec.received(); got != 0 {
+				t.Errorf("Expected no events delivered, got %d", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/go-cmp/cmp"
+
+	knfanout "knative.dev/eventing/pkg/channel/fanout"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/batch"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/budget"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/scheduler"
+)
+
+// batchRecorder is a test subscriber that keeps the size of the batches it
+// receives.
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (r *batchRecorder) ServeHTTP(w nethttp.ResponseWriter, req *nethttp.Request) {
+	var events []event.Event
+	if err := json.NewDecoder(req.Body).Decode(&events); err != nil {
+		w.WriteHeader(nethttp.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.batches = append(r.batches, len(events))
+	r.mu.Unlock()
+	w.WriteHeader(nethttp.StatusAccepted)
+}
+
+func (r *batchRecorder) received() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.batches...)
+}
+
+func newBatchSubscriber(t *testing.T) (*batchRecorder, *url.URL) {
+	rec := &batchRecorder{}
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return rec, u
+}
+
+func TestBatchersBySubscription(t *testing.T) {
+	rec, u := newBatchSubscriber(t)
+	h := newHandler(t, Config{Subscriptions: []Subscription{{
+		Subscription: knfanout.Subscription{Subscriber: u},
+		UID:          "a",
+		Batch:        &batch.Config{MaxSize: 1},
+	}, {
+		Subscription: knfanout.Subscription{Subscriber: u},
+		UID:          "b",
+		Batch:        &batch.Config{MaxSize: 2, MaxLinger: time.Hour},
+	}}})
+
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if diff := cmp.Diff([]int{1}, rec.received()); diff != "" {
+		t.Errorf("Unexpected batches (-want, +got):\n%s", diff)
+	}
+
+	h.configMutex.RLock()
+	pending := h.batchers["b"].Len()
+	h.configMutex.RUnlock()
+	if pending != 1 {
+		t.Errorf("Expected the event to be pending in the second subscription batch, got %d", pending)
+	}
+}
+
+func TestBatchReservation(t *testing.T) {
+	b := budget.New("dispatcher", 1024, nil)
+	rec, u := newBatchSubscriber(t)
+	h := newHandler(t, Config{Subscriptions: []Subscription{{
+		Subscription: knfanout.Subscription{Subscriber: u},
+		Batch:        &batch.Config{MaxSize: 2, MaxLinger: time.Hour},
+	}}}, WithMemoryBudget(b, 10*time.Millisecond))
+
+	e := newEvent("1")
+	if code := send(t, h, e); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if used := b.Used(); used != int64(len(e.Data())) {
+		t.Errorf("Expected the buffered event to be reserved, got %d bytes used", used)
+	}
+
+	if code := send(t, h, newEvent("2")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Used() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if used := b.Used(); used != 0 {
+		t.Errorf("Expected the reservation to be released once flushed, got %d bytes used", used)
+	}
+	if diff := cmp.Diff([]int{2}, rec.received()); diff != "" {
+		t.Errorf("Unexpected batches (-want, +got):\n%s", diff)
+	}
+}
+
+func TestBatchScheduled(t *testing.T) {
+	s := scheduler.New(1)
+	rec, u := newBatchSubscriber(t)
+	h := newHandler(t, Config{Subscriptions: []Subscription{{
+		Subscription: knfanout.Subscription{Subscriber: u},
+		Batch:        &batch.Config{MaxSize: 1},
+	}}}, WithScheduler(s))
+
+	// The only delivery slot is taken by another channel.
+	release, err := s.Acquire(context.Background(), "ns/other")
+	if err != nil {
+		t.Fatalf("Unexpected error acquiring a slot: %v", err)
+	}
+
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := rec.received(); len(got) != 0 {
+		t.Fatalf("Expected the batch to wait for a free slot, got batches %v", got)
+	}
+
+	release()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if diff := cmp.Diff([]int{1}, rec.received()); diff != "" {
+		t.Errorf("Unexpected batches (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+	"net/url"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+	knfanout "knative.dev/eventing/pkg/channel/fanout"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/bridge"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+)
+
+// bridge forwards the event to the channels of the bridges whose filter it
+// matches. Events are never forwarded to channels they already went through,
+// and each forward counts as a hop. Bridges have no dead letter sink, events
+// that exceed the hop limit are kept at the local dead letter store when the
+// hop limit dead letters them and the handler has one, and dropped otherwise.
+func (f *MessageHandler) bridge(ctx context.Context, bridges []bridge.Config, e *event.Event, additionalHeaders nethttp.Header) {
+	if len(bridges) == 0 {
+		return
+	}
+
+	current := f.ref.Namespace + "/" + f.ref.Name
+	limit := f.hopLimit()
+	for i := range bridges {
+		b := &bridges[i]
+		if !b.Matches(ctx, e) {
+			continue
+		}
+
+		logger := f.logger.With(zap.String("channel", current), zap.String("bridge", b.Channel),
+			zap.String("source", e.Source()), zap.String("id", e.ID()), zap.String("type", e.Type()))
+
+		if bridge.Visited(e, current, b.Channel) {
+			logger.Debug("Not bridging event to a channel it already went through",
+				zap.Strings("path", bridge.Path(e)))
+			continue
+		}
+
+		out := stampHops(e, limit)
+		if out == nil {
+			f.bridgeHopsExceeded(e, b, additionalHeaders, limit, logger)
+			continue
+		}
+		bridge.AppendPath(out, current)
+
+		target := f.bridgeTarget(b.HostName)
+		if target == nil {
+			logger.Warn("Bridge target channel not found at the dispatcher")
+			continue
+		}
+		if err := target.receiveBridged(ctx, out, additionalHeaders); err != nil {
+			logger.Error("Bridge target channel refused the event", zap.Error(err))
+		}
+	}
+}
+
+// bridgeHopsExceeded logs and reports an event that was not bridged because it
+// exceeded the hop limit, keeping it at the local dead letter store when
+// configured.
+func (f *MessageHandler) bridgeHopsExceeded(e *event.Event, b *bridge.Config, additionalHeaders nethttp.Header, limit delivery.HopLimit, logger *zap.Logger) {
+	hops := delivery.HopCount(e) + 1
+	action := hopsDropped
+	if limit.DeadLetter && f.deadLetters != nil {
+		dl := e.Clone()
+		dl.SetExtension(delivery.DeadLetterReasonExtension, delivery.ReasonHopsExceeded)
+		sub := Subscription{Subscription: knfanout.Subscription{Subscriber: &url.URL{Scheme: "http", Host: b.HostName}}}
+		err := fmt.Errorf("hop limit of %d exceeded bridging to %s", limit.Max, b.Channel)
+		if f.storeDeadLetter(&dl, additionalHeaders, sub, &delivery.Result{Hops: hops}, err) {
+			action = hopsDeadLettered
+		}
+	}
+
+	logger.Error("Event exceeded the hop limit, it is probably looping",
+		zap.Int("hops", hops), zap.Int("maxHops", limit.Max),
+		zap.Strings("path", bridge.Path(e)), zap.String("action", action))
+	if f.metricsReporter != nil {
+		_ = f.metricsReporter.ReportHopsExceeded(&metrics.ReportArgs{
+			Ns:        f.ref.Namespace,
+			Channel:   f.ref.Name,
+			EventType: e.Type(),
+		}, "", b.Channel, action)
+	}
+}
+
+// bridgeTarget returns the handler of the channel with the given address host.
+func (f *MessageHandler) bridgeTarget(host string) *MessageHandler {
+	if f.channels == nil {
+		return nil
+	}
+	target, _ := f.channels.GetChannelHandler(host).(*MessageHandler)
+	return target
+}
+
+// receiveBridged handles an event forwarded by a bridge from another channel.
+func (f *MessageHandler) receiveBridged(ctx context.Context, e *event.Event, additionalHeaders nethttp.Header) error {
+	config := f.GetConfig(ctx)
+	return f.accept(ctx, config, e, additionalHeaders)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	nethttp "net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel"
+	"knative.dev/eventing/pkg/channel/multichannelfanout"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/bridge"
+)
+
+const otherHost = "other.ns.svc.cluster.local"
+
+func newMultiChannelHandler() *multichannelfanout.MessageHandler {
+	return multichannelfanout.NewMessageHandler(context.Background(), zap.NewNop(), channel.NewMessageDispatcher(zap.NewNop()), nopReporter{})
+}
+
+func TestBridgeForward(t *testing.T) {
+	mh := newMultiChannelHandler()
+
+	otherRec, otherSub := newSubscriber(t)
+	mh.SetChannelHandler(otherHost, newChannelHandler(t, "other", Config{Subscriptions: []Subscription{otherSub}}))
+
+	rec, sub := newSubscriber(t)
+	h := newHandler(t, Config{
+		Subscriptions: []Subscription{sub},
+		Bridges:       []bridge.Config{{Channel: "ns/other", HostName: otherHost}},
+	}, WithChannelHandlers(mh))
+
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+
+	if got := rec.received(); got != 1 {
+		t.Errorf("Expected the event delivered to the channel subscriber, got %d events", got)
+	}
+	otherRec.mu.Lock()
+	defer otherRec.mu.Unlock()
+	if len(otherRec.events) != 1 {
+		t.Fatalf("Expected the event delivered to the target channel subscriber, got %d events", len(otherRec.events))
+	}
+	if diff := cmp.Diff([]string{"ns/channel"}, bridge.Path(otherRec.events[0])); diff != "" {
+		t.Errorf("Unexpected bridge path (-want, +got):\n%s", diff)
+	}
+}
+
+func TestBridgeMissingTarget(t *testing.T) {
+	rec, sub := newSubscriber(t)
+	h := newHandler(t, Config{
+		Subscriptions: []Subscription{sub},
+		Bridges:       []bridge.Config{{Channel: "ns/other", HostName: otherHost}},
+	}, WithChannelHandlers(newMultiChannelHandler()))
+
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if got := rec.received(); got != 1 {
+		t.Errorf("Expected the event delivered to the channel subscriber, got %d events", got)
+	}
+}
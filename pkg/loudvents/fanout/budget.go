@@ -0,0 +1,203 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/budget"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+)
+
+type reservationKey struct{}
+
+// reservation is the memory reserved for an event, released once all of its
+// holders are done with the event. Besides the dispatch, batches hold the
+// reservation of the events they buffer until they are flushed.
+type reservation struct {
+	holders int32
+	release func()
+}
+
+// hold adds a holder to the reservation, returning the function that drops it.
+func (r *reservation) hold() func() {
+	atomic.AddInt32(&r.holders, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if atomic.AddInt32(&r.holders, -1) == 0 {
+				r.release()
+			}
+		})
+	}
+}
+
+// withReservation stores the function that releases the memory reserved for
+// the event, which is released once the event is dispatched.
+func withReservation(ctx context.Context, release func()) context.Context {
+	return context.WithValue(ctx, reservationKey{}, &reservation{release: release})
+}
+
+// withReservationOf stores in ctx the memory reserved for the event in from.
+func withReservationOf(ctx, from context.Context) context.Context {
+	if r, ok := from.Value(reservationKey{}).(*reservation); ok {
+		return context.WithValue(ctx, reservationKey{}, r)
+	}
+	return ctx
+}
+
+// holdReservation holds the memory reserved for the event, returning the
+// function that drops the hold, which does nothing when there is no
+// reservation.
+func holdReservation(ctx context.Context) func() {
+	if r, ok := ctx.Value(reservationKey{}).(*reservation); ok {
+		return r.hold()
+	}
+	return func() {}
+}
+
+// setBudget sets the channel memory budget, which is a share of the
+// dispatcher budget. It must be called with the config lock held.
+func (f *MessageHandler) setBudget(limit int64) {
+	if limit <= 0 {
+		f.budget = f.globalBudget
+		return
+	}
+	if f.budget != nil && f.budget != f.globalBudget && f.budget.Limit() == limit {
+		return
+	}
+	f.budget = budget.New(f.ref.Namespace+"/"+f.ref.Name, limit, f.globalBudget)
+}
+
+// reserve reserves memory for the event payload, waiting for the budget
+// for a while. Exhausting the channel budget is reported to clients as
+// 429, and exhausting the dispatcher budget as 503.
+func (f *MessageHandler) reserve(ctx context.Context, e *event.Event) (func(), error) {
+	f.configMutex.RLock()
+	b := f.budget
+	f.configMutex.RUnlock()
+	if b == nil {
+		return func() {}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.budgetWait)
+	defer cancel()
+	release, err := b.Acquire(ctx, int64(len(e.Data())))
+	if err != nil {
+		code := nethttp.StatusServiceUnavailable
+		var eerr *budget.ExhaustedError
+		switch {
+		case errors.Is(err, budget.ErrTooLarge):
+			code = nethttp.StatusRequestEntityTooLarge
+		case errors.As(err, &eerr) && eerr.Budget != f.globalBudget:
+			code = nethttp.StatusTooManyRequests
+		}
+		return nil, &IngressError{Code: code, Err: err}
+	}
+
+	f.reportBudget(b)
+	return func() {
+		release()
+		f.reportBudget(b)
+	}, nil
+}
+
+// bodyLimit returns the size of the largest request body that fits the
+// channel and dispatcher budgets, not bounded when not positive.
+func (f *MessageHandler) bodyLimit() int64 {
+	f.configMutex.RLock()
+	b := f.budget
+	f.configMutex.RUnlock()
+
+	var limit int64
+	for ; b != nil; b = b.Parent() {
+		if l := b.Limit(); l > 0 && (limit <= 0 || l < limit) {
+			limit = l
+		}
+	}
+	return limit
+}
+
+// limitBody refuses requests whose body does not fit the memory budgets
+// before reading it, since it is held in memory while the event is decoded.
+// Bodies of unknown length fail with 413 once they are read past the limit.
+func (f *MessageHandler) limitBody(request *nethttp.Request) error {
+	return limitRequestBody(request, f.bodyLimit())
+}
+
+// limitRequestBody refuses requests whose body is larger than the limit, not
+// bounded when not positive.
+func limitRequestBody(request *nethttp.Request, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	if request.ContentLength > limit {
+		return &IngressError{Code: nethttp.StatusRequestEntityTooLarge, Err: budget.ErrTooLarge}
+	}
+	request.Body = &limitedBody{ReadCloser: request.Body, left: limit}
+	return nil
+}
+
+// limitedBody fails reads past the limit with an IngressError.
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.left < 0 {
+		return 0, l.err()
+	}
+	// Read one byte over the limit to tell bodies of exactly the limit
+	// apart from larger ones.
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return n + int(l.left), l.err()
+	}
+	return n, err
+}
+
+func (l *limitedBody) err() error {
+	return &IngressError{
+		Code: nethttp.StatusRequestEntityTooLarge,
+		Err:  fmt.Errorf("request body: %w", budget.ErrTooLarge),
+	}
+}
+
+func (f *MessageHandler) reportBudget(b *budget.Budget) {
+	if f.metricsReporter == nil {
+		return
+	}
+	if b != f.globalBudget {
+		_ = f.metricsReporter.ReportBudgetUsed(&metrics.ReportArgs{
+			Ns:      f.ref.Namespace,
+			Channel: f.ref.Name,
+		}, metrics.BudgetChannel, b.Used())
+	}
+	if f.globalBudget != nil {
+		_ = f.metricsReporter.ReportBudgetUsed(&metrics.ReportArgs{}, metrics.BudgetDispatcher, f.globalBudget.Used())
+	}
+}
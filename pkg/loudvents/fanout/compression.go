@@ -0,0 +1,60 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"fmt"
+	nethttp "net/http"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/compression"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+)
+
+// decompressRequest replaces the body of compressed requests with a reader
+// that decompresses it. The returned Decompressor is nil for requests that
+// are not compressed.
+func decompressRequest(request *nethttp.Request) (*compression.Decompressor, error) {
+	encoding := request.Header.Get("Content-Encoding")
+	if encoding == "" || encoding == "identity" {
+		return nil, nil
+	}
+	if !compression.Supported(encoding) {
+		return nil, &IngressError{
+			Code: nethttp.StatusUnsupportedMediaType,
+			Err:  fmt.Errorf("unsupported content encoding %q", encoding),
+		}
+	}
+
+	d, err := compression.NewDecompressor(encoding, request.Body)
+	if err != nil {
+		return nil, &IngressError{Code: nethttp.StatusBadRequest, Err: err}
+	}
+	request.Body = d
+	request.ContentLength = -1
+	request.Header.Del("Content-Encoding")
+	request.Header.Del("Content-Length")
+	return d, nil
+}
+
+// reportCompression reports the compression ratio and CPU time of a request body.
+func (f *MessageHandler) reportCompression(direction, eventType string, stats *compression.Stats) {
+	if f.metricsReporter == nil || stats == nil || stats.Compressed == 0 {
+		return
+	}
+	_ = f.metricsReporter.ReportCompression(&metrics.ReportArgs{
+		Ns:        f.ref.Namespace,
+		Channel:   f.ref.Name,
+		EventType: eventType,
+	}, direction, stats.Encoding, stats.Ratio(), stats.Duration)
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+)
+
+type receivedEncodingKey struct{}
+
+// withReceivedEncoding stores the encoding the event was received with.
+func withReceivedEncoding(ctx context.Context, enc binding.Encoding) context.Context {
+	return context.WithValue(ctx, receivedEncodingKey{}, enc)
+}
+
+// receivedEncoding returns the encoding the event was received with.
+func receivedEncoding(ctx context.Context) binding.Encoding {
+	enc, _ := ctx.Value(receivedEncodingKey{}).(binding.Encoding)
+	return enc
+}
+
+// eventContentMode returns the content mode to send events with. Events are
+// decoded on ingress, so passing them through means using the content mode
+// they were received with, or binary when it is not known.
+func eventContentMode(ctx context.Context, mode delivery.ContentMode) delivery.ContentMode {
+	if mode == delivery.ContentModeBinary || mode == delivery.ContentModeStructured {
+		return mode
+	}
+	if receivedEncoding(ctx) == binding.EncodingStructured {
+		return delivery.ContentModeStructured
+	}
+	return delivery.ContentModeBinary
+}
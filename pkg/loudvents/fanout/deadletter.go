@@ -0,0 +1,53 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	nethttp "net/http"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/dlq"
+)
+
+// storeDeadLetter keeps an event that could not be delivered at the local
+// dead letter store, returning whether it was stored.
+func (f *MessageHandler) storeDeadLetter(e *event.Event, additionalHeaders nethttp.Header, sub Subscription, res *delivery.Result, deliveryErr error) bool {
+	entry := &dlq.Entry{
+		Namespace:  f.ref.Namespace,
+		Channel:    f.ref.Name,
+		Subscriber: urlString(sub.Subscriber),
+		Attempts:   res.Attempts,
+		Error:      deliveryErr.Error(),
+		Event:      e,
+		Headers:    additionalHeaders,
+	}
+	if res.Info != nil {
+		entry.ResponseCode = res.Info.ResponseCode
+		entry.ResponseBody = string(res.Info.ResponseBody)
+	}
+
+	if err := f.deadLetters.Add(entry); err != nil {
+		f.logger.Error("Failed to store dead lettered event",
+			zap.String("source", e.Source()), zap.String("id", e.ID()), zap.Error(err))
+		return false
+	}
+
+	f.logger.Warn("Stored undeliverable event at the local dead letter store",
+		zap.String("subscriber", entry.Subscriber), zap.String("entry", entry.ID),
+		zap.String("source", e.Source()), zap.String("id", e.ID()), zap.Error(deliveryErr))
+	return true
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"net/url"
+	"sort"
+	"time"
+)
+
+// DebugInfo is a snapshot of the handler state for troubleshooting.
+type DebugInfo struct {
+	AsyncHandler  bool                `json:"asyncHandler"`
+	Subscriptions []DebugSubscription `json:"subscriptions"`
+	// LaneDepths is the number of dispatches queued at each priority lane.
+	LaneDepths []int `json:"laneDepths,omitempty"`
+	// Delayed is the number of events waiting for their delivery time.
+	Delayed int `json:"delayed"`
+	// Buffered is the number of events kept for replay.
+	Buffered int `json:"buffered,omitempty"`
+	// Groups lists the delivery groups with their unhealthy members.
+	Groups []DebugGroup `json:"groups,omitempty"`
+	// MemoryUsed and MemoryLimit are the bytes reserved from the channel
+	// memory budget and its size, when the channel has its own budget.
+	MemoryUsed  int64 `json:"memoryUsed,omitempty"`
+	MemoryLimit int64 `json:"memoryLimit,omitempty"`
+}
+
+// DebugSubscription describes a subscription the handler delivers to.
+type DebugSubscription struct {
+	Subscriber string      `json:"subscriber,omitempty"`
+	Reply      string      `json:"reply,omitempty"`
+	DeadLetter string      `json:"deadLetter,omitempty"`
+	Group      string      `json:"group,omitempty"`
+	Retry      *DebugRetry `json:"retry,omitempty"`
+	// Batched is the number of events waiting in the subscription batch.
+	Batched *int `json:"batched,omitempty"`
+}
+
+// DebugRetry describes the retry configuration of a subscription.
+type DebugRetry struct {
+	RetryMax       int     `json:"retryMax"`
+	BackoffPolicy  *string `json:"backoffPolicy,omitempty"`
+	BackoffDelay   *string `json:"backoffDelay,omitempty"`
+	RequestTimeout string  `json:"requestTimeout,omitempty"`
+}
+
+// DebugGroup describes the health of a delivery group members. Members that
+// recently failed are tried last until the time they are listed with.
+type DebugGroup struct {
+	Name string `json:"name"`
+	// Unhealthy are the members flagged as unhealthy, by subscription UID.
+	Unhealthy map[string]time.Time `json:"unhealthy"`
+}
+
+// Debug returns a snapshot of the handler state.
+func (f *MessageHandler) Debug() DebugInfo {
+	f.configMutex.RLock()
+	defer f.configMutex.RUnlock()
+
+	info := DebugInfo{
+		AsyncHandler:  f.config.AsyncHandler,
+		Subscriptions: make([]DebugSubscription, 0, len(f.config.Subscriptions)),
+		Delayed:       f.delayed.Len(),
+	}
+
+	for _, sub := range f.config.Subscriptions {
+		ds := DebugSubscription{
+			Subscriber: urlString(sub.Subscriber),
+			Reply:      urlString(sub.Reply),
+			DeadLetter: urlString(sub.DeadLetter),
+			Group:      sub.Group,
+		}
+		if rc := sub.RetryConfig; rc != nil {
+			ds.Retry = &DebugRetry{
+				RetryMax:     rc.RetryMax,
+				BackoffDelay: rc.BackoffDelay,
+			}
+			if rc.BackoffPolicy != nil {
+				policy := string(*rc.BackoffPolicy)
+				ds.Retry.BackoffPolicy = &policy
+			}
+			if rc.RequestTimeout > 0 {
+				ds.Retry.RequestTimeout = rc.RequestTimeout.String()
+			}
+		}
+		if b, ok := f.batchers[ds.Subscriber]; ok {
+			n := b.Len()
+			ds.Batched = &n
+		}
+		info.Subscriptions = append(info.Subscriptions, ds)
+	}
+
+	if f.lanes != nil {
+		lanes := f.lanes.Config().Lanes
+		info.LaneDepths = make([]int, lanes)
+		for lane := 0; lane < lanes; lane++ {
+			info.LaneDepths[lane] = f.lanes.Depth(lane)
+		}
+	}
+
+	if f.buffer != nil {
+		info.Buffered = f.buffer.Len()
+	}
+
+	for name, b := range f.balancers {
+		info.Groups = append(info.Groups, DebugGroup{
+			Name:      name,
+			Unhealthy: b.Unhealthy(),
+		})
+	}
+
+	sort.Slice(info.Groups, func(i, j int) bool {
+		return info.Groups[i].Name < info.Groups[j].Name
+	})
+
+	if f.budget != nil && f.budget != f.globalBudget {
+		info.MemoryUsed = f.budget.Used()
+		info.MemoryLimit = f.budget.Limit()
+	}
+
+	return info
+}
+
+func urlString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
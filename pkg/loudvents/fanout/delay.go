@@ -0,0 +1,131 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	"errors"
+	nethttp "net/http"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/budget"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delay"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+)
+
+// delayRetryPeriod is how long a due event is held again when there is no
+// memory budget to dispatch it.
+const delayRetryPeriod = 5 * time.Second
+
+// delay holds the event when it requests delayed delivery, returning whether
+// it was held. Events requesting a delay over the channel maximum are rejected.
+// Held events keep their memory reservation, freed by release, until due.
+func (f *MessageHandler) delay(cfg *delay.Config, e *event.Event, additionalHeaders nethttp.Header, release func()) (bool, error) {
+	if cfg == nil {
+		return false, nil
+	}
+
+	due, delayed, err := delay.DueTime(e, time.Now(), *cfg)
+	if err != nil {
+		return false, &IngressError{Code: nethttp.StatusBadRequest, Err: err}
+	}
+	if !delayed {
+		return false, nil
+	}
+
+	if err := f.delayed.Push(due, e, additionalHeaders, release); err != nil {
+		return false, &IngressError{Code: nethttp.StatusTooManyRequests, Err: err}
+	}
+	f.reportPendingDelayed()
+	f.logger.Debug("Delaying event delivery",
+		zap.String("source", e.Source()), zap.String("id", e.ID()), zap.Time("due", due))
+	return true, nil
+}
+
+// releaseDelayed fans out a delayed event once it is due, using the
+// subscriptions configured at that time. Events restored from a previous run
+// hold no memory reservation, and are held again while the budget has no
+// room for them.
+func (f *MessageHandler) releaseDelayed(it delay.Item) {
+	f.reportPendingDelayed()
+
+	ctx := context.Background()
+	release := it.Release
+	if release == nil {
+		var err error
+		if release, err = f.reserve(ctx, it.Event); err != nil {
+			f.holdDelayed(it, err)
+			return
+		}
+	}
+
+	config := f.GetConfig(ctx)
+	if !hasTargets(config) {
+		release()
+		return
+	}
+	// Dispatch asynchronously so that slow subscribers do not hold back
+	// other delayed events.
+	config.AsyncHandler = true
+	// Any returned error is already logged in f.dispatch().
+	_ = f.fanout(withReservation(ctx, release), config, it.Event, it.Headers)
+}
+
+// holdDelayed pushes back a due event that could not be reserved from the
+// memory budget, dropping it when it can never fit.
+func (f *MessageHandler) holdDelayed(it delay.Item, err error) {
+	logger := f.logger.With(zap.String("source", it.Event.Source()), zap.String("id", it.Event.ID()))
+	if errors.Is(err, budget.ErrTooLarge) {
+		logger.Error("Dropping delayed event larger than the memory budget", zap.Error(err))
+		return
+	}
+	if err := f.delayed.Push(time.Now().Add(delayRetryPeriod), it.Event, it.Headers, nil); err != nil {
+		logger.Error("Dropping delayed event", zap.Error(err))
+		return
+	}
+	f.reportPendingDelayed()
+	logger.Debug("Holding due delayed event until there is memory budget", zap.Error(err))
+}
+
+// restoreDelayed loads the delayed events saved by a previous run.
+func (f *MessageHandler) restoreDelayed() {
+	if f.store == nil {
+		return
+	}
+
+	var items []delay.Item
+	if _, err := f.store.Load(f.delayedStateKey(), &items); err != nil {
+		f.logger.Error("Failed to load delayed events", zap.Error(err))
+		return
+	}
+	f.delayed.Restore(items)
+	f.reportPendingDelayed()
+}
+
+func (f *MessageHandler) reportPendingDelayed() {
+	if f.metricsReporter == nil {
+		return
+	}
+	_ = f.metricsReporter.ReportPendingDelayedEvents(&metrics.ReportArgs{
+		Ns:      f.ref.Namespace,
+		Channel: f.ref.Name,
+	}, f.delayed.Len())
+}
+
+func (f *MessageHandler) delayedStateKey() string {
+	return "delayed/" + f.ref.Namespace + "/" + f.ref.Name
+}
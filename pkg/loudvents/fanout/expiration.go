@@ -0,0 +1,84 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+)
+
+const (
+	expiredDropped      = "drop"
+	expiredDeadLettered = "dead_letter"
+)
+
+type receiveTimeKey struct{}
+
+// withReceiveTime stores the time the event was received by the channel.
+func withReceiveTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, receiveTimeKey{}, t)
+}
+
+// expiration returns the time the event expires at for the given TTL, or
+// zero when it does not expire. The TTL counts from the event time
+// attribute, or from the time it was received when not present.
+func expiration(ctx context.Context, e *event.Event, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	start := e.Time()
+	if start.IsZero() {
+		start, _ = ctx.Value(receiveTimeKey{}).(time.Time)
+	}
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return start.Add(ttl)
+}
+
+// reportExpired logs and reports an event that expired before being
+// delivered to the subscription.
+func (f *MessageHandler) reportExpired(e *event.Event, sub Subscription) {
+	action := expiredDropped
+	if sub.DeadLetterExpired && sub.DeadLetter != nil {
+		action = expiredDeadLettered
+	}
+
+	var subscriber, reply string
+	if sub.Subscriber != nil {
+		subscriber = sub.Subscriber.String()
+	}
+	if sub.Reply != nil {
+		reply = sub.Reply.String()
+	}
+
+	f.logger.Info("Event expired before delivery",
+		zap.String("subscriber", subscriber), zap.String("reply", reply),
+		zap.String("source", e.Source()), zap.String("id", e.ID()),
+		zap.Duration("ttl", sub.TTL), zap.String("action", action))
+
+	if f.metricsReporter != nil {
+		_ = f.metricsReporter.ReportExpiredEvent(&metrics.ReportArgs{
+			Ns:        f.ref.Namespace,
+			Channel:   f.ref.Name,
+			EventType: e.Type(),
+		}, action)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	nethttp "net/http"
+	"testing"
+	"time"
+
+	knfanout "knative.dev/eventing/pkg/channel/fanout"
+)
+
+func TestExpiredReplyOnly(t *testing.T) {
+	testCases := map[string]struct {
+		deadLetterExpired bool
+		wantDeadLettered  int
+	}{
+		"dropped": {
+			deadLetterExpired: false,
+			wantDeadLettered:  0,
+		},
+		"dead lettered": {
+			deadLetterExpired: true,
+			wantDeadLettered:  1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			reply, replySub := newSubscriber(t)
+			deadLetter, deadLetterSub := newSubscriber(t)
+
+			h := newHandler(t, Config{Subscriptions: []Subscription{{
+				Subscription: knfanout.Subscription{
+					Reply:      replySub.Subscriber,
+					DeadLetter: deadLetterSub.Subscriber,
+				},
+				TTL:               time.Minute,
+				DeadLetterExpired: tc.deadLetterExpired,
+			}}})
+			defer h.Close()
+
+			e := newEvent("1")
+			e.SetTime(time.Now().Add(-time.Hour))
+			if code := send(t, h, e); code != nethttp.StatusAccepted {
+				t.Fatalf("Expected status 202, got %d", code)
+			}
+
+			if n := reply.received(); n != 0 {
+				t.Errorf("Expected no events at the reply, got %d", n)
+			}
+			if n := deadLetter.received(); n != tc.wantDeadLettered {
+				t.Errorf("Expected %d dead lettered events, got %d", tc.wantDeadLettered, n)
+			}
+		})
+	}
+}
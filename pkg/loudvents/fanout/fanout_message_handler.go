@@ -0,0 +1,698 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fanout provides the http.Handler for a single LoudVentsChannel. It
+// fans out incoming events to the channel subscriptions like the Knative
+// fanout.FanoutMessageHandler does, adding the channel level features that
+// LoudVentsChannel supports on top of it.
+package fanout
+
+import (
+	"context"
+	"errors"
+	nethttp "net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel"
+	knfanout "knative.dev/eventing/pkg/channel/fanout"
+	"knative.dev/eventing/pkg/channel/multichannelfanout"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/archive"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/batch"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/bridge"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/budget"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/dedup"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delay"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/dlq"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/group"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/priority"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/replay"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/scheduler"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/schema"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/state"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/webhook"
+)
+
+const (
+	defaultTimeout = 15 * time.Minute
+
+	// persistInterval is the period at which state is saved when
+	// running in persistent mode.
+	persistInterval = 10 * time.Second
+)
+
+// Config for a fanout MessageHandler.
+type Config struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+	// AsyncHandler controls whether the Subscriptions are called synchronous or asynchronously.
+	AsyncHandler bool `json:"asyncHandler,omitempty"`
+	// Dedup configures dropping of duplicated events, disabled when nil.
+	Dedup *dedup.Config `json:"dedup,omitempty"`
+	// Validation configures validation of events data, disabled when nil.
+	Validation *schema.Config `json:"validation,omitempty"`
+	// Webhook wraps requests that are not CloudEvents into events, disabled when nil.
+	Webhook *webhook.Config `json:"webhook,omitempty"`
+	// Delay configures delayed delivery, disabled when nil.
+	Delay *delay.Config `json:"delay,omitempty"`
+	// DeadLetterEnrichment adds failure metadata to dead lettered events,
+	// disabled when nil.
+	DeadLetterEnrichment *delivery.Enrichment `json:"deadLetterEnrichment,omitempty"`
+	// Replay keeps recent events to redeliver them to subscribers, disabled when nil.
+	Replay *replay.Config `json:"replay,omitempty"`
+	// Archive writes the channel events to files, disabled when nil or when
+	// the handler has no archive directory.
+	Archive *archive.Config `json:"archive,omitempty"`
+	// Groups configures the delivery groups subscriptions refer to.
+	Groups []group.Config `json:"groups,omitempty"`
+	// Hops configures loop detection, using the default hop limit when nil.
+	Hops *delivery.HopLimit `json:"hops,omitempty"`
+	// Bridges forward events to other channels handled by the same dispatcher.
+	Bridges []bridge.Config `json:"bridges,omitempty"`
+	// Priority queues the asynchronous dispatch of events in priority lanes,
+	// disabled when nil.
+	Priority *priority.Config `json:"priority,omitempty"`
+	// Weight is the share of the dispatcher delivery concurrency the channel
+	// gets relative to other channels when the scheduler is saturated.
+	Weight int `json:"weight,omitempty"`
+	// MemoryBudget bounds the bytes of payloads the channel holds in memory
+	// while dispatching, within the dispatcher budget. Not bounded when zero.
+	MemoryBudget int64 `json:"memoryBudget,omitempty"`
+}
+
+// Option customizes a MessageHandler.
+type Option func(*MessageHandler)
+
+// WithStateStore makes the handler persist its state in the given store.
+func WithStateStore(s *state.Store) Option {
+	return func(f *MessageHandler) {
+		f.store = s
+	}
+}
+
+// WithDeadLetterStore keeps the events that cannot be delivered to
+// subscriptions without a dead letter sink at the given store.
+func WithDeadLetterStore(s *dlq.Store) Option {
+	return func(f *MessageHandler) {
+		f.deadLetters = s
+	}
+}
+
+// WithArchiveDir makes channels that enable archiving write their events
+// under the given directory.
+func WithArchiveDir(dir string) Option {
+	return func(f *MessageHandler) {
+		f.archiveDir = dir
+	}
+}
+
+// WithChannelHandlers lets the handler forward events to the handlers of
+// other channels, which bridges require.
+func WithChannelHandlers(h multichannelfanout.MultiChannelMessageHandler) Option {
+	return func(f *MessageHandler) {
+		f.channels = h
+	}
+}
+
+// WithScheduler makes deliveries take a slot from the scheduler shared by
+// the dispatcher channels.
+func WithScheduler(s *scheduler.Scheduler) Option {
+	return func(f *MessageHandler) {
+		f.scheduler = s
+	}
+}
+
+// WithMemoryBudget makes the handler reserve the payload of events from the
+// dispatcher memory budget until they are dispatched, waiting up to wait
+// for room before refusing them.
+func WithMemoryBudget(b *budget.Budget, wait time.Duration) Option {
+	return func(f *MessageHandler) {
+		f.globalBudget = b
+		f.budgetWait = wait
+	}
+}
+
+// WithStatsReporter sets the reporter for loudvents metrics.
+func WithStatsReporter(r metrics.StatsReporter) Option {
+	return func(f *MessageHandler) {
+		f.metricsReporter = r
+	}
+}
+
+// MessageHandler is a http.Handler that takes a single request in and fans it out to N other servers.
+// It implements the Knative fanout.MessageHandler interface so it can be registered
+// in a multichannelfanout.MultiChannelMessageHandler.
+type MessageHandler struct {
+	ref channel.ChannelReference
+
+	configMutex sync.RWMutex
+	config      Config
+	dedup       *dedup.Cache
+	validator   *schema.Validator
+	webhook     *webhook.Wrapper
+	balancers   map[string]*group.Balancer
+	delayed     *delay.Queue
+	buffer      *replay.Buffer
+	replayed    map[string]replay.Position
+	archive     *archive.Writer
+	batchers    map[string]*batch.Batcher
+	lanes       *priority.Queue
+
+	dispatcher *delivery.Dispatcher
+
+	timeout time.Duration
+
+	reporter        channel.StatsReporter
+	metricsReporter metrics.StatsReporter
+	store           *state.Store
+	deadLetters     *dlq.Store
+	archiveDir      string
+	channels        multichannelfanout.MultiChannelMessageHandler
+	scheduler       *scheduler.Scheduler
+	globalBudget    *budget.Budget
+	budget          *budget.Budget
+	budgetWait      time.Duration
+	logger          *zap.Logger
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	doneCh   chan struct{}
+}
+
+var _ knfanout.MessageHandler = (*MessageHandler)(nil)
+
+// NewMessageHandler creates a new fanout MessageHandler for the referenced channel.
+// Background work started by the handler lasts until ctx is done or Close is called.
+func NewMessageHandler(ctx context.Context, logger *zap.Logger, messageDispatcher *delivery.Dispatcher,
+	ref channel.ChannelReference, config Config, reporter channel.StatsReporter, opts ...Option) (*MessageHandler, error) {
+	handler := &MessageHandler{
+		ref:        ref,
+		logger:     logger,
+		dispatcher: messageDispatcher,
+		timeout:    defaultTimeout,
+		reporter:   reporter,
+		delayed:    delay.NewQueue(),
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+
+	if err := handler.SetConfig(ctx, config); err != nil {
+		return nil, err
+	}
+	handler.restoreDelayed()
+
+	go handler.run(ctx)
+
+	return handler, nil
+}
+
+// SetConfig replaces the handler configuration. The current configuration
+// is kept when the new one is not valid.
+func (f *MessageHandler) SetConfig(ctx context.Context, config Config) error {
+	f.configMutex.Lock()
+	defer f.configMutex.Unlock()
+
+	var validator *schema.Validator
+	if config.Validation != nil {
+		var err error
+		if validator, err = schema.NewValidator(config.Validation.Schemas); err != nil {
+			return err
+		}
+	}
+
+	var wrapper *webhook.Wrapper
+	if config.Webhook != nil {
+		var err error
+		if wrapper, err = webhook.NewWrapper(*config.Webhook); err != nil {
+			return err
+		}
+	}
+
+	f.validator = validator
+	f.webhook = wrapper
+
+	subs := make([]Subscription, len(config.Subscriptions))
+	copy(subs, config.Subscriptions)
+	config.Subscriptions = subs
+
+	f.setDedup(config.Dedup)
+	f.setBalancers(config)
+	f.setReplay(config)
+	f.setBatchers(config)
+	f.setArchive(config.Archive)
+	f.setLanes(config.Priority)
+	f.setBudget(config.MemoryBudget)
+	if config.Delay != nil {
+		f.delayed.SetMaxPending(config.Delay.MaxPending)
+	}
+	if f.scheduler != nil {
+		f.scheduler.SetWeight(f.schedulerKey(), config.Weight)
+	}
+	f.config = config
+	return nil
+}
+
+// deadLetterEnrichment returns the configured dead letter enrichment.
+func (f *MessageHandler) deadLetterEnrichment() *delivery.Enrichment {
+	f.configMutex.RLock()
+	defer f.configMutex.RUnlock()
+	return f.config.DeadLetterEnrichment
+}
+
+// GetConfig returns a copy of the handler configuration.
+func (f *MessageHandler) GetConfig(ctx context.Context) Config {
+	f.configMutex.RLock()
+	defer f.configMutex.RUnlock()
+
+	config := f.config
+	config.Subscriptions = make([]Subscription, len(f.config.Subscriptions))
+	copy(config.Subscriptions, f.config.Subscriptions)
+	return config
+}
+
+// SetSubscriptions implements Knative's fanout.MessageHandler.
+// Subscriptions set this way have no loudvents delivery options.
+func (f *MessageHandler) SetSubscriptions(ctx context.Context, subs []knfanout.Subscription) {
+	config := f.GetConfig(ctx)
+	config.Subscriptions = make([]Subscription, len(subs))
+	for i := range subs {
+		config.Subscriptions[i] = Subscription{Subscription: subs[i]}
+	}
+	// Only the subscriptions change, which cannot make the config invalid.
+	_ = f.SetConfig(ctx, config)
+}
+
+// GetSubscriptions implements Knative's fanout.MessageHandler.
+func (f *MessageHandler) GetSubscriptions(ctx context.Context) []knfanout.Subscription {
+	subs := f.GetConfig(ctx).Subscriptions
+	ret := make([]knfanout.Subscription, len(subs))
+	for i := range subs {
+		ret[i] = subs[i].Subscription
+	}
+	return ret
+}
+
+// Close stops the handler background work, persisting its state.
+func (f *MessageHandler) Close() {
+	f.stopOnce.Do(func() {
+		close(f.stopCh)
+	})
+	<-f.doneCh
+}
+
+// Delete stops the handler background work and removes its persisted
+// state, so that a channel created later with the same name does not
+// inherit it.
+func (f *MessageHandler) Delete() {
+	f.Close()
+	if f.store == nil {
+		return
+	}
+	for _, key := range []string{f.dedupStateKey(), f.delayedStateKey()} {
+		if err := f.store.Delete(key); err != nil {
+			f.logger.Error("Failed to delete handler state", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// setDedup creates, updates or removes the dedup cache. Must be called with
+// the config lock held.
+func (f *MessageHandler) setDedup(cfg *dedup.Config) {
+	switch {
+	case cfg == nil:
+		f.dedup = nil
+		return
+	case f.dedup != nil && f.config.Dedup != nil && *f.config.Dedup == *cfg:
+		return
+	}
+
+	cache := dedup.NewCache(*cfg)
+	if f.dedup != nil {
+		cache.Restore(f.dedup.Entries())
+	} else if f.store != nil {
+		var entries []dedup.Entry
+		if _, err := f.store.Load(f.dedupStateKey(), &entries); err != nil {
+			f.logger.Error("Failed to load dedup state", zap.Error(err))
+		}
+		cache.Restore(entries)
+	}
+	f.dedup = cache
+}
+
+// isDuplicate returns whether the event has already been received by the channel.
+func (f *MessageHandler) isDuplicate(e *event.Event) bool {
+	f.configMutex.RLock()
+	cache := f.dedup
+	f.configMutex.RUnlock()
+
+	if cache == nil || !cache.Seen(e.Source(), e.ID()) {
+		return false
+	}
+
+	if f.metricsReporter != nil {
+		_ = f.metricsReporter.ReportDuplicateEvent(&metrics.ReportArgs{
+			Ns:        f.ref.Namespace,
+			Channel:   f.ref.Name,
+			EventType: e.Type(),
+		})
+	}
+	f.logger.Debug("Dropping duplicated event",
+		zap.String("source", e.Source()), zap.String("id", e.ID()))
+	return true
+}
+
+// forgetDuplicate removes the event from the dedup cache.
+func (f *MessageHandler) forgetDuplicate(e *event.Event) {
+	f.configMutex.RLock()
+	cache := f.dedup
+	f.configMutex.RUnlock()
+
+	if cache != nil {
+		cache.Forget(e.Source(), e.ID())
+	}
+}
+
+// run performs the handler background work until stopped.
+func (f *MessageHandler) run(ctx context.Context) {
+	defer close(f.doneCh)
+
+	queueStop := make(chan struct{})
+	queueDone := make(chan struct{})
+	go func() {
+		defer close(queueDone)
+		f.delayed.Run(queueStop, f.releaseDelayed)
+	}()
+
+	stop := func() {
+		close(queueStop)
+		<-queueDone
+		f.closeBatchers()
+		f.configMutex.Lock()
+		f.closeArchive()
+		f.closeLanes()
+		f.configMutex.Unlock()
+		if f.scheduler != nil {
+			f.scheduler.Remove(f.schedulerKey())
+		}
+		if f.store != nil {
+			f.persist()
+		}
+		// Pending delayed events are persisted, free their reservations.
+		f.delayed.Clear()
+	}
+
+	var tick <-chan time.Time
+	if f.store != nil {
+		ticker := time.NewTicker(persistInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			f.persist()
+		case <-ctx.Done():
+			stop()
+			return
+		case <-f.stopCh:
+			stop()
+			return
+		}
+	}
+}
+
+// persist saves the handler state when it has changed.
+func (f *MessageHandler) persist() {
+	f.configMutex.RLock()
+	cache := f.dedup
+	f.configMutex.RUnlock()
+
+	if cache != nil && cache.Dirty() {
+		if err := f.store.Save(f.dedupStateKey(), cache.Entries()); err != nil {
+			f.logger.Error("Failed to persist dedup state", zap.Error(err))
+		}
+	}
+
+	if f.delayed.Dirty() {
+		if err := f.store.Save(f.delayedStateKey(), f.delayed.Items()); err != nil {
+			f.logger.Error("Failed to persist delayed events", zap.Error(err))
+		}
+	}
+}
+
+func (f *MessageHandler) schedulerKey() string {
+	return f.ref.Namespace + "/" + f.ref.Name
+}
+
+// acquire returns the function delivery attempts take a scheduler slot
+// with, or nil when deliveries are not scheduled.
+func (f *MessageHandler) acquire() delivery.AcquireFunc {
+	if f.scheduler == nil {
+		return nil
+	}
+	key := f.schedulerKey()
+	return func(ctx context.Context) (func(), error) {
+		return f.scheduler.Acquire(ctx, key)
+	}
+}
+
+func (f *MessageHandler) dedupStateKey() string {
+	return "dedup/" + f.ref.Namespace + "/" + f.ref.Name
+}
+
+// receive handles a message received by the channel. It is responsible for invoking message.Finish().
+func (f *MessageHandler) receive(ctx context.Context, message binding.Message, additionalHeaders nethttp.Header) error {
+	config := f.GetConfig(ctx)
+
+	// The event is read once and kept in memory to send it several times.
+	ctx = withReceivedEncoding(ctx, message.ReadEncoding())
+	e, err := binding.ToEvent(ctx, message)
+	// We don't need the original message anymore
+	_ = message.Finish(nil)
+	if err != nil {
+		var ierr *IngressError
+		if errors.As(err, &ierr) {
+			return ierr
+		}
+		return &IngressError{Code: nethttp.StatusBadRequest, Err: err}
+	}
+
+	ctx, span := f.startIngressSpan(ctx, e)
+	err = f.accept(ctx, config, e, additionalHeaders)
+	endIngressSpan(span, err)
+	return err
+}
+
+// accept runs a decoded event through the channel deduplication, validation
+// and delay before fanning it out. Events are reserved from the memory budget
+// while they are delayed and dispatched.
+func (f *MessageHandler) accept(ctx context.Context, config Config, e *event.Event, additionalHeaders nethttp.Header) (err error) {
+	if f.isDuplicate(e) {
+		return nil
+	}
+	// Refused events are forgotten, so that they are not dropped as
+	// duplicates when the sender retries them.
+	defer func() {
+		if err != nil {
+			f.forgetDuplicate(e)
+		}
+	}()
+
+	if forwarded, err := f.validate(ctx, config.Validation, e, additionalHeaders); err != nil || forwarded {
+		return err
+	}
+
+	if !hasTargets(config) {
+		// Nothing to deliver the event to.
+		return nil
+	}
+
+	release, err := f.reserve(ctx, e)
+	if err != nil {
+		return err
+	}
+
+	delayed, err := f.delay(config.Delay, e, additionalHeaders, release)
+	if err != nil || delayed {
+		if err != nil {
+			release()
+		}
+		return err
+	}
+	return f.fanout(withReservation(ctx, release), config, e, additionalHeaders)
+}
+
+// hasTargets returns whether the configuration has anything events are
+// delivered to, either subscriptions, the replay buffer or bridges.
+func hasTargets(config Config) bool {
+	return len(config.Subscriptions) > 0 || config.Replay != nil || len(config.Bridges) > 0
+}
+
+// fanout dispatches the event to the configured subscriptions.
+func (f *MessageHandler) fanout(ctx context.Context, config Config, e *event.Event, additionalHeaders nethttp.Header) error {
+	f.bufferEvent(e, additionalHeaders)
+	f.archiveEvent(e)
+	f.bridge(ctx, config.Bridges, e, additionalHeaders)
+
+	subs := config.Subscriptions
+	reportArgs := channel.ReportArgs{
+		Ns:        f.ref.Namespace,
+		EventType: e.Type(),
+	}
+	received := time.Now()
+	ctx = withReceiveTime(ctx, received)
+	release := holdReservation(ctx)
+
+	if config.AsyncHandler {
+		parentSpan := trace.FromContext(ctx)
+		encoding := receivedEncoding(ctx)
+		reserved := ctx
+		dispatch := func() {
+			defer release()
+			// Run async dispatch with background context.
+			ctx := withReceiveTime(trace.NewContext(context.Background(), parentSpan), received)
+			ctx = withReceivedEncoding(ctx, encoding)
+			ctx = withReservationOf(ctx, reserved)
+			// Any returned error is already logged in f.dispatch().
+			_ = knfanout.ParseDispatchResultAndReportMetrics(f.dispatch(ctx, subs, e, additionalHeaders), f.reporter, reportArgs)
+		}
+		if !f.enqueue(e, dispatch) {
+			go dispatch()
+		}
+		return nil
+	}
+	defer release()
+
+	return knfanout.ParseDispatchResultAndReportMetrics(f.dispatch(ctx, subs, e, additionalHeaders), f.reporter, reportArgs)
+}
+
+// dispatch takes the event, fans it out to each subscription in subs, or to a
+// single member of each delivery group. If all the fanned out
+// events return successfully, then return nil. Else, return an error.
+func (f *MessageHandler) dispatch(ctx context.Context, subs []Subscription, e *event.Event, additionalHeaders nethttp.Header) knfanout.DispatchResult {
+	targets := f.deliveryTargets(subs)
+	errorCh := make(chan knfanout.DispatchResult, len(targets))
+	for _, target := range targets {
+		go func(deliver deliveryFunc) {
+			info, err := deliver(ctx, e, additionalHeaders)
+			errorCh <- knfanout.NewDispatchResult(err, info)
+		}(target)
+	}
+
+	var totalDispatchTimeForFanout time.Duration = channel.NoDuration
+	info := &channel.DispatchExecutionInfo{
+		Time:         channel.NoDuration,
+		ResponseCode: channel.NoResponse,
+	}
+	for range targets {
+		select {
+		case dispatchResult := <-errorCh:
+			if dispatchResult.Info() != nil {
+				if dispatchResult.Info().Time > channel.NoDuration {
+					if totalDispatchTimeForFanout > channel.NoDuration {
+						totalDispatchTimeForFanout += dispatchResult.Info().Time
+					} else {
+						totalDispatchTimeForFanout = dispatchResult.Info().Time
+					}
+				}
+				info.Time = totalDispatchTimeForFanout
+				info.ResponseCode = dispatchResult.Info().ResponseCode
+			}
+			if err := dispatchResult.Error(); err != nil {
+				f.logger.Error("Fanout had an error", zap.Error(err))
+				return knfanout.NewDispatchResult(err, info)
+			}
+		case <-time.After(f.timeout):
+			f.logger.Error("Fanout timed out")
+			return knfanout.NewDispatchResult(errors.New("fanout timed out"), info)
+		}
+	}
+	// All Subscriptions returned err = nil.
+	return knfanout.NewDispatchResult(nil, info)
+}
+
+// makeFanoutRequest sends the event to exactly one subscription. It handles both the `call` and
+// the `sink` portions of the subscription.
+func (f *MessageHandler) makeFanoutRequest(ctx context.Context, e *event.Event, additionalHeaders nethttp.Header, sub Subscription) (*channel.DispatchExecutionInfo, error) {
+	return f.deliver(ctx, e, additionalHeaders, sub, true)
+}
+
+// deliver sends the event to the subscription. When localDeadLetter is set,
+// events that cannot be delivered to subscriptions without a dead letter sink
+// are kept at the local dead letter store, if any.
+func (f *MessageHandler) deliver(ctx context.Context, e *event.Event, additionalHeaders nethttp.Header, sub Subscription, localDeadLetter bool) (*channel.DispatchExecutionInfo, error) {
+	out, info, err := f.transform(ctx, e, additionalHeaders, sub)
+	if out == nil {
+		return info, err
+	}
+
+	hops := f.hopLimit()
+	if sub.Batch != nil && sub.Subscriber != nil {
+		// Batched events are stamped before being added to the batch, those
+		// exceeding the hop limit are handled by the dispatcher below.
+		if stamped := stampHops(out, hops); stamped != nil {
+			if info, batched, err := f.batchEvent(ctx, stamped, additionalHeaders, sub); batched {
+				return info, err
+			}
+		}
+	}
+
+	res, err := f.dispatcher.Dispatch(ctx, &delivery.Request{
+		Message:           binding.ToMessage(out),
+		Headers:           additionalHeaders,
+		Destination:       sub.Subscriber,
+		Reply:             sub.Reply,
+		DeadLetter:        sub.DeadLetter,
+		Retry:             sub.RetryConfig,
+		Expires:           expiration(ctx, e, sub.TTL),
+		DeadLetterExpired: sub.DeadLetterExpired,
+		Channel:           f.ref.Namespace + "/" + f.ref.Name,
+		Enrichment:        f.deadLetterEnrichment(),
+
+		ContentMode:           eventContentMode(ctx, sub.ContentMode),
+		ReplyContentMode:      sub.ReplyContentMode,
+		DeadLetterContentMode: eventContentMode(ctx, sub.DeadLetterContentMode),
+
+		Compression: sub.Compression,
+
+		HopCount:               delivery.HopCount(out),
+		MaxHops:                hops.Max,
+		DeadLetterHopsExceeded: hops.DeadLetter,
+
+		Acquire: f.acquire(),
+	})
+	f.reportCompression(metrics.DirectionEgress, e.Type(), res.Compression)
+	if res.Expired {
+		f.reportExpired(e, sub)
+	}
+	if res.HopsExceeded {
+		f.reportHopsExceeded(e, sub, res, hops)
+	}
+	if err != nil && localDeadLetter && sub.DeadLetter == nil && f.deadLetters != nil {
+		if f.storeDeadLetter(out, additionalHeaders, sub, res, err) {
+			return res.Info, nil
+		}
+	}
+	return res.Info, err
+}
@@ -0,0 +1,599 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"bytes"
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/event"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/google/go-cmp/cmp"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	"knative.dev/eventing/pkg/channel"
+	knfanout "knative.dev/eventing/pkg/channel/fanout"
+	"knative.dev/eventing/pkg/kncloudevents"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/batch"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/bridge"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/budget"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/dedup"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delay"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/dlq"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/group"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/priority"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/replay"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/schema"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/state"
+)
+
+type nopReporter struct{}
+
+func (nopReporter) ReportEventCount(*channel.ReportArgs, int) error { return nil }
+func (nopReporter) ReportEventDispatchTime(*channel.ReportArgs, int, time.Duration) error {
+	return nil
+}
+
+// recorder is a test subscriber that keeps the events it receives.
+type recorder struct {
+	mu     sync.Mutex
+	events []*event.Event
+}
+
+func (r *recorder) ServeHTTP(w nethttp.ResponseWriter, req *nethttp.Request) {
+	e, err := binding.ToEvent(req.Context(), cehttp.NewMessageFromHttpRequest(req))
+	if err != nil {
+		w.WriteHeader(nethttp.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+	w.WriteHeader(nethttp.StatusAccepted)
+}
+
+func (r *recorder) received() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+func newSubscriber(t *testing.T) (*recorder, Subscription) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return rec, Subscription{Subscription: knfanout.Subscription{Subscriber: u}}
+}
+
+func newHandler(t *testing.T, config Config, opts ...Option) *MessageHandler {
+	return newChannelHandler(t, "channel", config, opts...)
+}
+
+// newChannelHandler creates the handler of the named channel in the ns namespace.
+func newChannelHandler(t *testing.T, name string, config Config, opts ...Option) *MessageHandler {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	logger := zap.NewNop()
+	h, err := NewMessageHandler(ctx, logger, delivery.NewDispatcher(logger),
+		channel.ChannelReference{Namespace: "ns", Name: name}, config, nopReporter{}, opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the handler: %v", err)
+	}
+	return h
+}
+
+func newEvent(id string) *event.Event {
+	e := event.New()
+	e.SetID(id)
+	e.SetType("test.type")
+	e.SetSource("test")
+	_ = e.SetData(event.ApplicationJSON, map[string]string{"hello": "world"})
+	return &e
+}
+
+// newEventRequest returns a request posting the event to the path in binary mode.
+func newEventRequest(t *testing.T, path string, e *event.Event) *nethttp.Request {
+	req := httptest.NewRequest(nethttp.MethodPost, path, bytes.NewReader(e.Data()))
+	if err := cehttp.WriteRequest(context.Background(), binding.ToMessage(e), req); err != nil {
+		t.Fatalf("Unexpected error writing the request: %v", err)
+	}
+	return req
+}
+
+// send posts the event to the handler in binary mode, returning the response status code.
+func send(t *testing.T, h nethttp.Handler, e *event.Event) int {
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, newEventRequest(t, "/", e))
+	return res.Code
+}
+
+func TestDedupStatePersistence(t *testing.T) {
+	store, err := state.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rec, sub := newSubscriber(t)
+	config := Config{
+		Subscriptions: []Subscription{sub},
+		Dedup:         &dedup.Config{Window: time.Hour},
+	}
+
+	h := newHandler(t, config, WithStateStore(store))
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	h.Close()
+
+	// the restored state keeps dropping the duplicated event
+	h = newHandler(t, config, WithStateStore(store))
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if n := rec.received(); n != 1 {
+		t.Errorf("Expected the duplicated event to be dropped, got %d deliveries", n)
+	}
+	h.Delete()
+
+	// a channel created after the deletion starts afresh
+	h = newHandler(t, config, WithStateStore(store))
+	defer h.Close()
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if n := rec.received(); n != 2 {
+		t.Errorf("Expected the event to be delivered after the deletion, got %d deliveries", n)
+	}
+}
+
+func TestDedupWithoutTargets(t *testing.T) {
+	h := newHandler(t, Config{Dedup: &dedup.Config{Window: time.Hour}})
+	defer h.Close()
+
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if !h.isDuplicate(newEvent("1")) {
+		t.Error("Expected the event received by a channel without targets to be remembered")
+	}
+}
+
+func TestValidationWithoutTargets(t *testing.T) {
+	testCases := map[string]struct {
+		mode     schema.Mode
+		wantCode int
+	}{
+		"enforce refuses invalid events": {mode: schema.ModeEnforce, wantCode: nethttp.StatusBadRequest},
+		"audit accepts invalid events":   {mode: schema.ModeAudit, wantCode: nethttp.StatusAccepted},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			h := newHandler(t, Config{Validation: &schema.Config{
+				Mode:    tc.mode,
+				Schemas: []schema.Schema{{Document: `{"required": ["id"]}`}},
+			}})
+			defer h.Close()
+
+			if code := send(t, h, newEvent("1")); code != tc.wantCode {
+				t.Errorf("Expected status %d, got %d", tc.wantCode, code)
+			}
+		})
+	}
+}
+
+func newDelayedEvent(id, after string) *event.Event {
+	e := newEvent(id)
+	e.SetExtension(delay.DeliverAfterExtension, after)
+	return e
+}
+
+func TestDelayedReleaseWithoutSubscriptions(t *testing.T) {
+	h := newHandler(t, Config{
+		Replay: &replay.Config{MaxBytes: replay.DefaultMaxBytes},
+		Delay:  &delay.Config{MaxDelay: time.Hour, MaxPending: 1},
+	})
+	defer h.Close()
+
+	if code := send(t, h, newDelayedEvent("1", "10ms")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if code := send(t, h, newDelayedEvent("2", "10ms")); code != nethttp.StatusTooManyRequests {
+		t.Errorf("Expected status 429 while the delay queue is full, got %d", code)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		records, _ := h.Buffered()
+		if len(records) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the released event to be buffered for replay")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDelayedStateDeletion(t *testing.T) {
+	store, err := state.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, sub := newSubscriber(t)
+	config := Config{
+		Subscriptions: []Subscription{sub},
+		Delay:         &delay.Config{MaxDelay: time.Hour},
+	}
+
+	h := newHandler(t, config, WithStateStore(store))
+	if code := send(t, h, newDelayedEvent("1", "1h")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	h.Close()
+
+	var items []delay.Item
+	if found, _ := store.Load(h.delayedStateKey(), &items); !found || len(items) != 1 {
+		t.Fatalf("Expected the delayed event to be persisted, got %d items", len(items))
+	}
+
+	h = newHandler(t, config, WithStateStore(store))
+	if n := h.delayed.Len(); n != 1 {
+		t.Errorf("Expected the delayed event to be restored, got %d", n)
+	}
+	h.Delete()
+
+	if found, _ := store.Load(h.delayedStateKey(), &items); found {
+		t.Error("Expected the delayed events state to be deleted with the channel")
+	}
+}
+
+func TestBridgeHopsExceeded(t *testing.T) {
+	testCases := map[string]struct {
+		deadLetter bool
+		expected   int
+	}{
+		"dropped": {
+			deadLetter: false,
+			expected:   0,
+		},
+		"dead lettered": {
+			deadLetter: true,
+			expected:   1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			store, err := dlq.NewStore(t.TempDir(), 0)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			h := newHandler(t, Config{
+				Hops:    &delivery.HopLimit{Max: 1, DeadLetter: tc.deadLetter},
+				Bridges: []bridge.Config{{Channel: "ns/other", HostName: "other.ns.svc.cluster.local"}},
+			}, WithDeadLetterStore(store))
+
+			e := newEvent("1")
+			e.SetExtension(delivery.HopCountExtension, 1)
+			if code := send(t, h, e); code != nethttp.StatusAccepted {
+				t.Fatalf("Expected status 202, got %d", code)
+			}
+
+			entries := store.List(dlq.Filter{})
+			if len(entries) != tc.expected {
+				t.Fatalf("Expected %d dead lettered events, got %d", tc.expected, len(entries))
+			}
+			for _, entry := range entries {
+				stored, err := store.Get(entry.ID)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if reason := stored.Event.Extensions()[delivery.DeadLetterReasonExtension]; reason != delivery.ReasonHopsExceeded {
+					t.Errorf("Expected dead letter reason %q, got %v", delivery.ReasonHopsExceeded, reason)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupRetryAfterRefusal(t *testing.T) {
+	b := budget.New("dispatcher", 1024, nil)
+	rec, sub := newSubscriber(t)
+	h := newHandler(t, Config{
+		Subscriptions: []Subscription{sub},
+		Dedup:         &dedup.Config{Window: time.Hour},
+	}, WithMemoryBudget(b, 10*time.Millisecond))
+	defer h.Close()
+
+	// exhaust the budget so that the event reservation is refused
+	release, err := b.Acquire(context.Background(), b.Limit())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503 while the budget is exhausted, got %d", code)
+	}
+	release()
+
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202 for the retry, got %d", code)
+	}
+	if n := rec.received(); n != 1 {
+		t.Errorf("Expected the retried event to be delivered, got %d deliveries", n)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	testCases := map[string]struct {
+		contentLength bool
+		limit         int64
+		wantCode      int
+	}{
+		"fits the budget": {
+			contentLength: true,
+			limit:         1024,
+			wantCode:      nethttp.StatusAccepted,
+		},
+		"content length over the budget": {
+			contentLength: true,
+			limit:         8,
+			wantCode:      nethttp.StatusRequestEntityTooLarge,
+		},
+		"unknown length over the budget": {
+			contentLength: false,
+			limit:         8,
+			wantCode:      nethttp.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, sub := newSubscriber(t)
+			h := newHandler(t, Config{Subscriptions: []Subscription{sub}},
+				WithMemoryBudget(budget.New("dispatcher", tc.limit, nil), 10*time.Millisecond))
+			defer h.Close()
+
+			e := newEvent("1")
+			req := httptest.NewRequest(nethttp.MethodPost, "/", nil)
+			if err := cehttp.WriteRequest(context.Background(), binding.ToMessage(e), req); err != nil {
+				t.Fatalf("Unexpected error writing the request: %v", err)
+			}
+			if !tc.contentLength {
+				req.ContentLength = -1
+			}
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			if res.Code != tc.wantCode {
+				t.Errorf("Expected status %d, got %d", tc.wantCode, res.Code)
+			}
+		})
+	}
+}
+
+func TestDelayedReservation(t *testing.T) {
+	b := budget.New("dispatcher", 1024, nil)
+	_, sub := newSubscriber(t)
+	h := newHandler(t, Config{
+		Subscriptions: []Subscription{sub},
+		Delay:         &delay.Config{MaxDelay: time.Hour},
+	}, WithMemoryBudget(b, 10*time.Millisecond))
+
+	e := newDelayedEvent("1", "1h")
+	if code := send(t, h, e); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if used := b.Used(); used != int64(len(e.Data())) {
+		t.Errorf("Expected the pending delayed event to be reserved, got %d bytes used", used)
+	}
+
+	h.Close()
+	if used := b.Used(); used != 0 {
+		t.Errorf("Expected the reservation to be released when closing, got %d bytes used", used)
+	}
+}
+
+// spanRecorder is a trace exporter that keeps the spans it is given.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *spanRecorder) named(name string) []*trace.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var spans []*trace.SpanData
+	for _, s := range r.spans {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func TestIngressSpanParent(t *testing.T) {
+	const (
+		eventTraceParent  = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+		headerTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	)
+	eventParent, _ := (&tracecontext.HTTPFormat{}).SpanContextFromHeaders(eventTraceParent, "")
+	headerParent, _ := (&tracecontext.HTTPFormat{}).SpanContextFromHeaders(headerTraceParent, "")
+
+	testCases := map[string]struct {
+		header     string
+		wantParent trace.SpanContext
+		wantLink   bool
+	}{
+		"event extension without header": {
+			wantParent: eventParent,
+		},
+		"header and event extension": {
+			header:     headerTraceParent,
+			wantParent: headerParent,
+			wantLink:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			exporter := &spanRecorder{}
+			trace.RegisterExporter(exporter)
+			defer trace.UnregisterExporter(exporter)
+
+			_, sub := newSubscriber(t)
+			h := newHandler(t, Config{Subscriptions: []Subscription{sub}})
+			defer h.Close()
+			srv := httptest.NewServer(kncloudevents.CreateHandler(h))
+			defer srv.Close()
+
+			e := newEvent("1")
+			e.SetExtension(delivery.TraceParentExtension, eventTraceParent)
+			req, err := nethttp.NewRequest(nethttp.MethodPost, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := cehttp.WriteRequest(context.Background(), binding.ToMessage(e), req); err != nil {
+				t.Fatalf("Unexpected error writing the request: %v", err)
+			}
+			if tc.header != "" {
+				req.Header.Set("traceparent", tc.header)
+			}
+			res, err := nethttp.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != nethttp.StatusAccepted {
+				t.Fatalf("Expected status 202, got %d", res.StatusCode)
+			}
+
+			spans := exporter.named(ingressSpanName)
+			if len(spans) != 1 {
+				t.Fatalf("Expected an ingress span, got %d", len(spans))
+			}
+			span := spans[0]
+			if span.TraceID != tc.wantParent.TraceID {
+				t.Errorf("Expected trace %s, got %s", tc.wantParent.TraceID, span.TraceID)
+			}
+			if tc.header == "" && span.ParentSpanID != eventParent.SpanID {
+				t.Errorf("Expected the event span %s as parent, got %s", eventParent.SpanID, span.ParentSpanID)
+			}
+			if linked := len(span.Links) == 1 && span.Links[0].SpanID == eventParent.SpanID; linked != tc.wantLink {
+				t.Errorf("Expected the event span to be linked: %t, got links %v", tc.wantLink, span.Links)
+			}
+		})
+	}
+}
+
+func TestDebug(t *testing.T) {
+	subscriber, _ := url.Parse("http://subscriber.ns.svc.cluster.local")
+	deadLetter, _ := url.Parse("http://dls.ns.svc.cluster.local")
+	linear := eventingduckv1.BackoffPolicyLinear
+	delayISO := "PT1S"
+	zero := 0
+
+	testCases := map[string]struct {
+		config Config
+		opts   []Option
+		want   DebugInfo
+	}{
+		"no subscriptions": {
+			config: Config{AsyncHandler: true},
+			want: DebugInfo{
+				AsyncHandler:  true,
+				Subscriptions: []DebugSubscription{},
+			},
+		},
+		"subscription with retries and batching": {
+			config: Config{Subscriptions: []Subscription{{
+				Subscription: knfanout.Subscription{
+					Subscriber: subscriber,
+					DeadLetter: deadLetter,
+					RetryConfig: &kncloudevents.RetryConfig{
+						RetryMax:       3,
+						BackoffPolicy:  &linear,
+						BackoffDelay:   &delayISO,
+						RequestTimeout: 5 * time.Second,
+					},
+				},
+				Batch: &batch.Config{MaxSize: 10, MaxLinger: time.Hour},
+			}}},
+			want: DebugInfo{
+				Subscriptions: []DebugSubscription{{
+					Subscriber: subscriber.String(),
+					DeadLetter: deadLetter.String(),
+					Retry: &DebugRetry{
+						RetryMax:       3,
+						BackoffPolicy:  (*string)(&linear),
+						BackoffDelay:   &delayISO,
+						RequestTimeout: "5s",
+					},
+					Batched: &zero,
+				}},
+			},
+		},
+		"groups, lanes, replay and budget": {
+			config: Config{
+				Subscriptions: []Subscription{{
+					Subscription: knfanout.Subscription{Subscriber: subscriber},
+					Group:        "workers",
+				}},
+				Groups:       []group.Config{{Name: "workers", Strategy: group.StrategyRoundRobin}},
+				Priority:     &priority.Config{Lanes: 2, Concurrency: 1},
+				Replay:       &replay.Config{MaxBytes: replay.DefaultMaxBytes},
+				MemoryBudget: 1024,
+			},
+			opts: []Option{WithMemoryBudget(budget.New("dispatcher", 4096, nil), time.Millisecond)},
+			want: DebugInfo{
+				Subscriptions: []DebugSubscription{{
+					Subscriber: subscriber.String(),
+					Group:      "workers",
+				}},
+				LaneDepths:  []int{0, 0},
+				Groups:      []DebugGroup{{Name: "workers", Unhealthy: map[string]time.Time{}}},
+				MemoryLimit: 1024,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			h := newHandler(t, tc.config, tc.opts...)
+			defer h.Close()
+
+			if diff := cmp.Diff(tc.want, h.Debug()); diff != "" {
+				t.Errorf("Unexpected debug info (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
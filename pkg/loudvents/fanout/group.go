@@ -0,0 +1,150 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	nethttp "net/http"
+	"sort"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/group"
+)
+
+// deliveryFunc delivers an event to a fanout target, which is either a
+// single subscription or a delivery group.
+type deliveryFunc func(ctx context.Context, e *event.Event, additionalHeaders nethttp.Header) (*channel.DispatchExecutionInfo, error)
+
+// setBalancers creates the balancers for the configured groups, keeping the
+// existing ones for groups whose configuration did not change. Must be
+// called with the config lock held.
+func (f *MessageHandler) setBalancers(config Config) {
+	groups := make(map[string]group.Config, len(config.Groups))
+	for _, g := range config.Groups {
+		groups[g.Name] = g
+	}
+
+	balancers := make(map[string]*group.Balancer)
+	for _, sub := range config.Subscriptions {
+		if sub.Group == "" {
+			continue
+		}
+		if _, ok := balancers[sub.Group]; ok {
+			continue
+		}
+
+		cfg, ok := groups[sub.Group]
+		if !ok {
+			cfg = group.Config{Name: sub.Group, Strategy: group.StrategyRoundRobin}
+		}
+		if b, ok := f.balancers[sub.Group]; ok && f.groupConfig(sub.Group) == cfg {
+			balancers[sub.Group] = b
+			continue
+		}
+		balancers[sub.Group] = group.NewBalancer(cfg)
+	}
+	f.balancers = balancers
+}
+
+// groupConfig returns the current configuration for a group, which is the
+// default round robin when not declared. Must be called with the config lock held.
+func (f *MessageHandler) groupConfig(name string) group.Config {
+	for _, g := range f.config.Groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return group.Config{Name: name, Strategy: group.StrategyRoundRobin}
+}
+
+// deliveryTargets returns the delivery functions the event needs to be fanned
+// out to. Subscriptions without a group are delivered individually, while each
+// group receives the event once.
+func (f *MessageHandler) deliveryTargets(subs []Subscription) []deliveryFunc {
+	f.configMutex.RLock()
+	balancers := f.balancers
+	f.configMutex.RUnlock()
+
+	targets := make([]deliveryFunc, 0, len(subs))
+	members := make(map[string][]Subscription)
+	for _, sub := range subs {
+		b, ok := balancers[sub.Group]
+		if sub.Group == "" || !ok || sub.Subscriber == nil {
+			sub := sub
+			targets = append(targets, func(ctx context.Context, e *event.Event, h nethttp.Header) (*channel.DispatchExecutionInfo, error) {
+				return f.makeFanoutRequest(ctx, e, h, sub)
+			})
+			continue
+		}
+
+		if _, ok := members[sub.Group]; !ok {
+			name := sub.Group
+			targets = append(targets, func(ctx context.Context, e *event.Event, h nethttp.Header) (*channel.DispatchExecutionInfo, error) {
+				return f.makeGroupRequest(ctx, e, h, name, b, members[name])
+			})
+		}
+		members[sub.Group] = append(members[sub.Group], sub)
+	}
+
+	// Members are sorted so that partition keys hash to the same subscription
+	// regardless of the order subscriptions are listed in.
+	for _, m := range members {
+		sort.Slice(m, func(i, j int) bool {
+			return m[i].key() < m[j].key()
+		})
+	}
+
+	return targets
+}
+
+// makeGroupRequest delivers the event to a single member of the group, trying
+// the remaining members when delivery fails. The dead letter sink is only used
+// once all members have failed.
+func (f *MessageHandler) makeGroupRequest(ctx context.Context, e *event.Event, additionalHeaders nethttp.Header,
+	name string, b *group.Balancer, members []Subscription) (*channel.DispatchExecutionInfo, error) {
+	byKey := make(map[string]Subscription, len(members))
+	keys := make([]string, 0, len(members))
+	for _, m := range members {
+		key := m.key()
+		byKey[key] = m
+		keys = append(keys, key)
+	}
+
+	var info *channel.DispatchExecutionInfo
+	var err error
+	order := b.Order(e, keys)
+	for i, key := range order {
+		sub := byKey[key]
+		if i < len(order)-1 {
+			sub.DeadLetter = nil
+		}
+
+		info, err = f.deliver(ctx, e, additionalHeaders, sub, i == len(order)-1)
+		if err == nil {
+			b.MarkSucceeded(key)
+			return info, nil
+		}
+
+		b.MarkFailed(key)
+		f.logger.Warn("Delivery to group member failed",
+			zap.String("group", name), zap.String("member", key),
+			zap.String("subscriber", sub.Subscriber.String()),
+			zap.Int("remainingMembers", len(order)-i-1), zap.Error(err))
+	}
+	return info, err
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/group"
+)
+
+// failingSubscriber is a test subscriber that refuses every event.
+type failingSubscriber struct {
+	attempts int32
+}
+
+func (s *failingSubscriber) ServeHTTP(w nethttp.ResponseWriter, _ *nethttp.Request) {
+	atomic.AddInt32(&s.attempts, 1)
+	w.WriteHeader(nethttp.StatusInternalServerError)
+}
+
+func newFailingSubscriber(t *testing.T) (*failingSubscriber, *url.URL) {
+	s := &failingSubscriber{}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return s, u
+}
+
+// member returns a subscription to the subscriber in the group.
+func member(uid, groupName string, subscriber, deadLetter *url.URL) Subscription {
+	sub := Subscription{UID: types.UID(uid), Group: groupName}
+	sub.Subscriber = subscriber
+	sub.DeadLetter = deadLetter
+	return sub
+}
+
+func TestGroupFailover(t *testing.T) {
+	failing, failingURL := newFailingSubscriber(t)
+	healthy, healthySub := newSubscriber(t)
+
+	h := newHandler(t, Config{Subscriptions: []Subscription{
+		member("a", "workers", failingURL, nil),
+		member("b", "workers", healthySub.Subscriber, nil),
+	}})
+	defer h.Close()
+
+	for _, id := range []string{"1", "2", "3"} {
+		if code := send(t, h, newEvent(id)); code != nethttp.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", code)
+		}
+	}
+
+	if n := healthy.received(); n != 3 {
+		t.Errorf("Expected the healthy member to receive 3 events, got %d", n)
+	}
+	// The first event is tried at the failing member first, which is then
+	// tried last while unhealthy.
+	if n := atomic.LoadInt32(&failing.attempts); n != 1 {
+		t.Errorf("Expected 1 attempt at the failing member, got %d", n)
+	}
+}
+
+func TestGroupDeadLetter(t *testing.T) {
+	first, firstURL := newFailingSubscriber(t)
+	second, secondURL := newFailingSubscriber(t)
+	firstDL, firstDLSub := newSubscriber(t)
+	secondDL, secondDLSub := newSubscriber(t)
+
+	h := newHandler(t, Config{Subscriptions: []Subscription{
+		member("a", "workers", firstURL, firstDLSub.Subscriber),
+		member("b", "workers", secondURL, secondDLSub.Subscriber),
+	}})
+	defer h.Close()
+
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+
+	if a, b := atomic.LoadInt32(&first.attempts), atomic.LoadInt32(&second.attempts); a != 1 || b != 1 {
+		t.Errorf("Expected 1 attempt at each member, got %d and %d", a, b)
+	}
+	// Round robin starts at the first member, so the second one is last.
+	if n := firstDL.received(); n != 0 {
+		t.Errorf("Expected no events at the dead letter sink of the first member, got %d", n)
+	}
+	if n := secondDL.received(); n != 1 {
+		t.Errorf("Expected 1 event at the dead letter sink of the last member, got %d", n)
+	}
+}
+
+func TestGroupMembersSharingSubscriber(t *testing.T) {
+	_, failingURL := newFailingSubscriber(t)
+	firstDL, firstDLSub := newSubscriber(t)
+	secondDL, secondDLSub := newSubscriber(t)
+
+	h := newHandler(t, Config{Subscriptions: []Subscription{
+		member("a", "workers", failingURL, firstDLSub.Subscriber),
+		member("b", "workers", failingURL, secondDLSub.Subscriber),
+	}})
+	defer h.Close()
+
+	for _, id := range []string{"1", "2"} {
+		if code := send(t, h, newEvent(id)); code != nethttp.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", code)
+		}
+	}
+
+	// Each member is last once, so each dead letter sink gets one event.
+	if a, b := firstDL.received(), secondDL.received(); a != 1 || b != 1 {
+		t.Errorf("Expected 1 event at each member dead letter sink, got %d and %d", a, b)
+	}
+}
+
+func TestGroupPartitionKey(t *testing.T) {
+	recorders := make([]*recorder, 3)
+	members := make([]Subscription, 3)
+	for i, uid := range []string{"a", "b", "c"} {
+		rec, sub := newSubscriber(t)
+		recorders[i] = rec
+		members[i] = member(uid, "workers", sub.Subscriber, nil)
+	}
+	groups := []group.Config{{Name: "workers", Strategy: group.StrategyPartitionKey}}
+
+	// receivers returns the member each event was received by.
+	receivers := func(subs []Subscription) map[string]int {
+		for _, rec := range recorders {
+			rec.mu.Lock()
+			rec.events = nil
+			rec.mu.Unlock()
+		}
+
+		h := newHandler(t, Config{Subscriptions: subs, Groups: groups})
+		defer h.Close()
+
+		for id, key := range map[string]string{"1": "k1", "2": "k1", "3": "k2", "4": "k1"} {
+			e := newEvent(id)
+			e.SetExtension(group.DefaultPartitionKey, key)
+			if code := send(t, h, e); code != nethttp.StatusAccepted {
+				t.Fatalf("Expected status 202, got %d", code)
+			}
+		}
+
+		got := make(map[string]int)
+		for i, rec := range recorders {
+			for _, e := range rec.events {
+				got[e.ID()] = i
+			}
+		}
+		return got
+	}
+
+	got := receivers(members)
+	if len(got) != 4 {
+		t.Fatalf("Expected 4 events received, got %d", len(got))
+	}
+	if got["1"] != got["2"] || got["1"] != got["4"] {
+		t.Errorf("Expected the events with the same partition key at the same member, got %v", got)
+	}
+
+	reversed := []Subscription{members[2], members[1], members[0]}
+	if diff := cmp.Diff(got, receivers(reversed)); diff != "" {
+		t.Errorf("Expected the same members regardless of the subscriptions order (-first, +reversed):\n%s", diff)
+	}
+}
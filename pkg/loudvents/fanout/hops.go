@@ -0,0 +1,85 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+)
+
+const (
+	hopsDropped      = "drop"
+	hopsDeadLettered = "dead_letter"
+)
+
+// hopLimit returns the configured hop limit, or the default one when not
+// configured.
+func (f *MessageHandler) hopLimit() delivery.HopLimit {
+	f.configMutex.RLock()
+	defer f.configMutex.RUnlock()
+	if f.config.Hops == nil {
+		return delivery.HopLimit{Max: delivery.DefaultMaxHops}
+	}
+	return *f.config.Hops
+}
+
+// stampHops returns a copy of the event with the hop count of its delivery to
+// the subscription, or nil when it exceeds the hop limit.
+func stampHops(e *event.Event, limit delivery.HopLimit) *event.Event {
+	hops := delivery.HopCount(e) + 1
+	if limit.Max > 0 && hops > limit.Max {
+		return nil
+	}
+	stamped := e.Clone()
+	stamped.SetExtension(delivery.HopCountExtension, hops)
+	return &stamped
+}
+
+// reportHopsExceeded logs and reports an event that was not sent because it
+// exceeded the hop limit, which usually means that it is looping between
+// channels and subscribers.
+func (f *MessageHandler) reportHopsExceeded(e *event.Event, sub Subscription, res *delivery.Result, limit delivery.HopLimit) {
+	action := hopsDropped
+	if limit.DeadLetter && sub.DeadLetter != nil {
+		action = hopsDeadLettered
+	}
+
+	var subscriber, reply string
+	if sub.Subscriber != nil {
+		subscriber = sub.Subscriber.String()
+	}
+	if sub.Reply != nil {
+		reply = sub.Reply.String()
+	}
+	target := res.HopsExceededAt.String()
+
+	f.logger.Error("Event exceeded the hop limit, it is probably looping",
+		zap.String("channel", f.ref.Namespace+"/"+f.ref.Name),
+		zap.String("subscriber", subscriber), zap.String("reply", reply),
+		zap.String("target", target),
+		zap.Int("hops", res.Hops), zap.Int("maxHops", limit.Max),
+		zap.String("source", e.Source()), zap.String("id", e.ID()), zap.String("type", e.Type()),
+		zap.String("action", action))
+
+	if f.metricsReporter != nil {
+		_ = f.metricsReporter.ReportHopsExceeded(&metrics.ReportArgs{
+			Ns:        f.ref.Namespace,
+			Channel:   f.ref.Name,
+			EventType: e.Type(),
+		}, subscriber, target, action)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"reflect"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/priority"
+)
+
+// setLanes replaces the priority lanes when their configuration changes.
+// Events queued at replaced lanes are still dispatched. It must be called
+// with the config lock held.
+func (f *MessageHandler) setLanes(cfg *priority.Config) {
+	if f.lanes != nil && cfg != nil && reflect.DeepEqual(f.lanes.Config(), *cfg) {
+		return
+	}
+
+	f.closeLanes()
+	if cfg == nil {
+		return
+	}
+
+	q := priority.NewQueue(*cfg)
+	for i := 0; i < q.Config().Concurrency; i++ {
+		go f.serveLanes(q)
+	}
+	f.lanes = q
+}
+
+// closeLanes stops queueing events at the priority lanes. It must be called
+// with the config lock held.
+func (f *MessageHandler) closeLanes() {
+	if f.lanes != nil {
+		f.lanes.Close()
+		f.lanes = nil
+	}
+}
+
+// serveLanes dispatches the events queued at the priority lanes until the
+// queue is closed and empty.
+func (f *MessageHandler) serveLanes(q *priority.Queue) {
+	for {
+		task, lane, ok := q.Pop()
+		if !ok {
+			return
+		}
+		f.reportLaneDepth(q, lane)
+		task()
+	}
+}
+
+// enqueue queues the dispatch of the event at its priority lane, returning
+// false when priority lanes are not enabled.
+func (f *MessageHandler) enqueue(e *event.Event, dispatch func()) bool {
+	f.configMutex.RLock()
+	q := f.lanes
+	f.configMutex.RUnlock()
+	if q == nil {
+		return false
+	}
+
+	cfg := q.Config()
+	lane := cfg.Lane(e)
+	if !q.Push(lane, dispatch) {
+		return false
+	}
+	f.reportLaneDepth(q, lane)
+	return true
+}
+
+func (f *MessageHandler) reportLaneDepth(q *priority.Queue, lane int) {
+	if f.metricsReporter == nil {
+		return
+	}
+	_ = f.metricsReporter.ReportLaneDepth(&metrics.ReportArgs{
+		Ns:      f.ref.Namespace,
+		Channel: f.ref.Name,
+	}, lane, q.Depth(lane))
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	knfanout "knative.dev/eventing/pkg/channel/fanout"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/priority"
+)
+
+// gatedSubscriber is a test subscriber that keeps the IDs of the events it
+// receives, in order, holding the first request until the gate is opened.
+type gatedSubscriber struct {
+	first chan struct{}
+	gate  chan struct{}
+
+	mu  sync.Mutex
+	ids []string
+}
+
+func (s *gatedSubscriber) ServeHTTP(w nethttp.ResponseWriter, req *nethttp.Request) {
+	s.mu.Lock()
+	s.ids = append(s.ids, req.Header.Get("Ce-Id"))
+	first := len(s.ids) == 1
+	s.mu.Unlock()
+
+	if first {
+		close(s.first)
+		<-s.gate
+	}
+	w.WriteHeader(nethttp.StatusAccepted)
+}
+
+func (s *gatedSubscriber) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ids...)
+}
+
+func newGatedSubscriber(t *testing.T) (*gatedSubscriber, Subscription) {
+	s := &gatedSubscriber{first: make(chan struct{}), gate: make(chan struct{})}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return s, Subscription{Subscription: knfanout.Subscription{Subscriber: u}}
+}
+
+// sendPrioritized posts events with the given IDs at the lane.
+func sendPrioritized(t *testing.T, h nethttp.Handler, lane int, ids ...string) {
+	for _, id := range ids {
+		e := newEvent(id)
+		e.SetExtension(priority.Extension, lane)
+		if code := send(t, h, e); code != nethttp.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", code)
+		}
+	}
+}
+
+func TestPriorityLanes(t *testing.T) {
+	testCases := map[string]struct {
+		// replace is the configuration the lanes are replaced with while
+		// events are queued, none when nil.
+		replace *priority.Config
+		want    []string
+	}{
+		"high priority first": {
+			want: []string{"blocker", "high", "low-1", "low-2"},
+		},
+		"replaced lanes are drained": {
+			replace: &priority.Config{Lanes: 3, Concurrency: 1},
+			want:    []string{"blocker", "high", "low-1", "low-2"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, sub := newGatedSubscriber(t)
+			config := Config{
+				Subscriptions: []Subscription{sub},
+				AsyncHandler:  true,
+				Priority:      &priority.Config{Lanes: 2, Concurrency: 1},
+			}
+			h := newHandler(t, config)
+
+			// The only dispatch slot is held by the blocker while the other
+			// events are queued.
+			sendPrioritized(t, h, 0, "blocker")
+			select {
+			case <-s.first:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for the first event")
+			}
+			sendPrioritized(t, h, 0, "low-1", "low-2")
+			sendPrioritized(t, h, 1, "high")
+
+			if tc.replace != nil {
+				config.Priority = tc.replace
+				if err := h.SetConfig(context.Background(), config); err != nil {
+					t.Fatalf("Unexpected error setting the config: %v", err)
+				}
+			}
+			close(s.gate)
+
+			deadline := time.Now().Add(5 * time.Second)
+			for len(s.received()) < len(tc.want) && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if diff := cmp.Diff(tc.want, s.received()); diff != "" {
+				t.Errorf("Unexpected dispatch order (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
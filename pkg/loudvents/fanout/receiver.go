@@ -0,0 +1,156 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"encoding/json"
+	"errors"
+	nethttp "net/http"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/protocol/http"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel"
+	"knative.dev/eventing/pkg/utils"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/schema"
+)
+
+// IngressError is returned when the channel refuses an incoming event.
+// Code is the HTTP status code returned to the sender.
+type IngressError struct {
+	Code int
+	Err  error
+}
+
+func (e *IngressError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *IngressError) Unwrap() error {
+	return e.Err
+}
+
+// ingressErrorBody is the response body for refused events.
+type ingressErrorBody struct {
+	Error   string   `json:"error"`
+	Details []string `json:"details,omitempty"`
+}
+
+// ServeHTTP receives events sent to the channel.
+//
+// The response status codes:
+//   202 - the event was accepted by the channel
+//   207 - some events in a batch were refused, the body describes them
+//   4xx - the event was refused by the channel, the body describes the reason
+//   500 - an error occurred processing the request
+func (f *MessageHandler) ServeHTTP(response nethttp.ResponseWriter, request *nethttp.Request) {
+	response.Header().Set("Allow", "POST, OPTIONS")
+	if request.Method == nethttp.MethodOptions {
+		response.Header().Set("WebHook-Allowed-Origin", "*") // Accept from any Origin:
+		response.Header().Set("WebHook-Allowed-Rate", "*")   // Unlimited requests/minute
+		response.WriteHeader(nethttp.StatusOK)
+		return
+	}
+	if request.Method != nethttp.MethodPost {
+		response.WriteHeader(nethttp.StatusMethodNotAllowed)
+		return
+	}
+	// Webhooks can be sent to any path, which the wrapped event attributes
+	// might be built from.
+	wrapper := f.webhookWrapper()
+	if request.URL.Path != "/" && wrapper == nil {
+		response.WriteHeader(nethttp.StatusNotFound)
+		return
+	}
+
+	args := channel.ReportArgs{Ns: f.ref.Namespace}
+	request = request.WithContext(withTraceHeader(request.Context(), request.Header))
+
+	decompressor, err := decompressRequest(request)
+	if err != nil {
+		f.handleReceiveError(response, &args, err)
+		return
+	}
+	if decompressor != nil {
+		defer func() {
+			stats := decompressor.Stats()
+			f.reportCompression(metrics.DirectionIngress, "", &stats)
+		}()
+	}
+
+	if err := f.limitBody(request); err != nil {
+		f.handleReceiveError(response, &args, err)
+		return
+	}
+
+	if isBatch(request) {
+		f.receiveBatch(response, request)
+		return
+	}
+
+	var message binding.Message = http.NewMessageFromHttpRequest(request)
+	if message.ReadEncoding() == binding.EncodingUnknown {
+		if wrapper == nil {
+			f.logger.Info("Cannot determine the cloudevent message encoding")
+			response.WriteHeader(nethttp.StatusBadRequest)
+			_ = f.reporter.ReportEventCount(&args, nethttp.StatusBadRequest)
+			return
+		}
+
+		if message, err = f.wrapRequest(wrapper, request); err != nil {
+			f.handleReceiveError(response, &args, err)
+			return
+		}
+	}
+
+	if err := f.receive(request.Context(), message, utils.PassThroughHeaders(request.Header)); err != nil {
+		f.handleReceiveError(response, &args, err)
+		return
+	}
+	response.WriteHeader(nethttp.StatusAccepted)
+}
+
+// handleReceiveError writes the response for an event that was not accepted.
+func (f *MessageHandler) handleReceiveError(response nethttp.ResponseWriter, args *channel.ReportArgs, err error) {
+	var ierr *IngressError
+	if !errors.As(err, &ierr) {
+		f.logger.Info("Error in receiver", zap.Error(err))
+		response.WriteHeader(nethttp.StatusInternalServerError)
+		return
+	}
+
+	f.logger.Debug("Event refused", zap.Int("code", ierr.Code), zap.Error(ierr.Err))
+	_ = f.reporter.ReportEventCount(args, ierr.Code)
+	writeIngressError(response, ierr)
+}
+
+func writeIngressError(response nethttp.ResponseWriter, ierr *IngressError) {
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(ierr.Code)
+	_ = json.NewEncoder(response).Encode(newIngressErrorBody(ierr))
+}
+
+func newIngressErrorBody(ierr *IngressError) ingressErrorBody {
+	body := ingressErrorBody{Error: ierr.Err.Error()}
+
+	var verr *schema.ValidationError
+	if errors.As(ierr.Err, &verr) {
+		body.Error = "event data does not match its schema"
+		body.Details = verr.Details
+	}
+	return body
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"bytes"
+	"io/ioutil"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/compression"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/webhook"
+)
+
+func TestReceiveWebhook(t *testing.T) {
+	cfg := &webhook.Config{
+		Type:   `com.example.{{ header "X-Event" }}`,
+		Source: `https://example.com/{{ index .Segments 0 }}`,
+		ID:     `{{ header "X-Delivery" }}`,
+	}
+
+	testCases := map[string]struct {
+		webhook *webhook.Config
+		request func(t *testing.T) *nethttp.Request
+		code    int
+		// wantType, wantSource and wantID are the attributes of the delivered
+		// event, none is delivered when empty.
+		wantType, wantSource, wantID string
+	}{
+		"wrapped request": {
+			webhook: cfg,
+			request: func(t *testing.T) *nethttp.Request {
+				req := httptest.NewRequest(nethttp.MethodPost, "/acme/hooks", strings.NewReader(`{"action":"opened"}`))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Event", "opened")
+				req.Header.Set("X-Delivery", "72d3162e")
+				return req
+			},
+			code:       nethttp.StatusAccepted,
+			wantType:   "com.example.opened",
+			wantSource: "https://example.com/acme",
+			wantID:     "72d3162e",
+		},
+		"template error": {
+			webhook: cfg,
+			request: func(t *testing.T) *nethttp.Request {
+				req := httptest.NewRequest(nethttp.MethodPost, "/", strings.NewReader(`{"action":"opened"}`))
+				req.Header.Set("X-Event", "opened")
+				req.Header.Set("X-Delivery", "72d3162e")
+				return req
+			},
+			code: nethttp.StatusBadRequest,
+		},
+		"invalid wrapped event": {
+			webhook: cfg,
+			request: func(t *testing.T) *nethttp.Request {
+				return httptest.NewRequest(nethttp.MethodPost, "/acme", strings.NewReader(`{"action":"opened"}`))
+			},
+			code: nethttp.StatusBadRequest,
+		},
+		"cloudevent with webhook": {
+			webhook: cfg,
+			request: func(t *testing.T) *nethttp.Request {
+				return newEventRequest(t, "/", newEvent("1"))
+			},
+			code:       nethttp.StatusAccepted,
+			wantType:   "test.type",
+			wantSource: "test",
+			wantID:     "1",
+		},
+		"plain request without webhook": {
+			request: func(t *testing.T) *nethttp.Request {
+				return httptest.NewRequest(nethttp.MethodPost, "/", strings.NewReader(`{"action":"opened"}`))
+			},
+			code: nethttp.StatusBadRequest,
+		},
+		"path without webhook": {
+			request: func(t *testing.T) *nethttp.Request {
+				return newEventRequest(t, "/acme", newEvent("1"))
+			},
+			code: nethttp.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rec, sub := newSubscriber(t)
+			h := newHandler(t, Config{Subscriptions: []Subscription{sub}, Webhook: tc.webhook})
+
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, tc.request(t))
+			if res.Code != tc.code {
+				t.Fatalf("Expected status %d, got %d: %s", tc.code, res.Code, res.Body)
+			}
+
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			if tc.wantID == "" {
+				if len(rec.events) != 0 {
+					t.Errorf("Expected no events delivered, got %d", len(rec.events))
+				}
+				return
+			}
+			if len(rec.events) != 1 {
+				t.Fatalf("Expected 1 event delivered, got %d", len(rec.events))
+			}
+			e := rec.events[0]
+			if e.Type() != tc.wantType || e.Source() != tc.wantSource || e.ID() != tc.wantID {
+				t.Errorf("Unexpected event attributes type=%q source=%q id=%q", e.Type(), e.Source(), e.ID())
+			}
+		})
+	}
+}
+
+// newCompressedRequest returns a request posting the event in binary mode
+// with its data compressed using the encoding.
+func newCompressedRequest(t *testing.T, encoding string) *nethttp.Request {
+	req := newEventRequest(t, "/", newEvent("1"))
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("Unexpected error reading the request body: %v", err)
+	}
+	compressed, _, err := compression.Compress(encoding, body)
+	if err != nil {
+		t.Fatalf("Unexpected error compressing the request body: %v", err)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(compressed))
+	req.ContentLength = int64(len(compressed))
+	req.Header.Set("Content-Encoding", encoding)
+	return req
+}
+
+func TestReceiveCompressed(t *testing.T) {
+	testCases := map[string]struct {
+		request   func(t *testing.T) *nethttp.Request
+		code      int
+		delivered bool
+	}{
+		"gzip": {
+			request: func(t *testing.T) *nethttp.Request {
+				return newCompressedRequest(t, compression.Gzip)
+			},
+			code:      nethttp.StatusAccepted,
+			delivered: true,
+		},
+		"deflate": {
+			request: func(t *testing.T) *nethttp.Request {
+				return newCompressedRequest(t, compression.Deflate)
+			},
+			code:      nethttp.StatusAccepted,
+			delivered: true,
+		},
+		"unsupported encoding": {
+			request: func(t *testing.T) *nethttp.Request {
+				req := newEventRequest(t, "/", newEvent("1"))
+				req.Header.Set("Content-Encoding", "br")
+				return req
+			},
+			code: nethttp.StatusUnsupportedMediaType,
+		},
+		"corrupt header": {
+			request: func(t *testing.T) *nethttp.Request {
+				req := newEventRequest(t, "/", newEvent("1"))
+				req.Header.Set("Content-Encoding", compression.Gzip)
+				return req
+			},
+			code: nethttp.StatusBadRequest,
+		},
+		"corrupt stream": {
+			request: func(t *testing.T) *nethttp.Request {
+				req := newCompressedRequest(t, compression.Gzip)
+				body, _ := ioutil.ReadAll(req.Body)
+				body = body[:len(body)/2]
+				req.Body = ioutil.NopCloser(bytes.NewReader(body))
+				req.ContentLength = int64(len(body))
+				return req
+			},
+			code: nethttp.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rec, sub := newSubscriber(t)
+			h := newHandler(t, Config{Subscriptions: []Subscription{sub}})
+
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, tc.request(t))
+			if res.Code != tc.code {
+				t.Fatalf("Expected status %d, got %d: %s", tc.code, res.Code, res.Body)
+			}
+
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			if !tc.delivered {
+				if len(rec.events) != 0 {
+					t.Errorf("Expected no events delivered, got %d", len(rec.events))
+				}
+				return
+			}
+			if len(rec.events) != 1 {
+				t.Fatalf("Expected 1 event delivered, got %d", len(rec.events))
+			}
+			if got, want := string(rec.events[0].Data()), string(newEvent("1").Data()); got != want {
+				t.Errorf("Expected the decompressed data %s, got %s", want, got)
+			}
+		})
+	}
+}
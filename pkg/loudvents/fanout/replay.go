@@ -0,0 +1,149 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	"errors"
+	nethttp "net/http"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/replay"
+)
+
+var (
+	// ErrReplayDisabled is returned when replaying events from a channel
+	// that does not buffer them.
+	ErrReplayDisabled = errors.New("replay is not enabled for the channel")
+	// ErrUnknownSubscriber is returned when replaying events to a
+	// subscriber that is not subscribed to the channel.
+	ErrUnknownSubscriber = errors.New("subscriber not found at the channel")
+	// ErrAmbiguousSubscriber is returned when replaying events to a
+	// subscriber URI that several subscriptions share, which need to be
+	// told apart by their UID.
+	ErrAmbiguousSubscriber = errors.New("several subscriptions share the subscriber, use the subscription UID")
+)
+
+// setReplay creates, resizes or removes the replay buffer, and replays
+// events to subscriptions whose replay position changed. Must be called
+// with the config lock held.
+func (f *MessageHandler) setReplay(config Config) {
+	switch {
+	case config.Replay == nil:
+		f.buffer = nil
+	case f.buffer != nil && f.config.Replay != nil && *f.config.Replay == *config.Replay:
+	default:
+		buffer := replay.NewBuffer(*config.Replay)
+		if f.buffer != nil {
+			buffer.Restore(f.buffer.From(replay.Position{}))
+		}
+		f.buffer = buffer
+	}
+
+	replayed := make(map[string]replay.Position)
+	for _, sub := range config.Subscriptions {
+		if sub.ReplayFrom == nil || sub.Subscriber == nil {
+			continue
+		}
+		key := sub.key()
+		replayed[key] = *sub.ReplayFrom
+		if prev, ok := f.replayed[key]; ok && prev == *sub.ReplayFrom {
+			continue
+		}
+		if f.buffer != nil {
+			go f.replay(sub, f.buffer.From(*sub.ReplayFrom))
+		}
+	}
+	f.replayed = replayed
+}
+
+// bufferEvent keeps the event for replays, if enabled.
+func (f *MessageHandler) bufferEvent(e *event.Event, additionalHeaders nethttp.Header) {
+	f.configMutex.RLock()
+	buffer := f.buffer
+	f.configMutex.RUnlock()
+
+	if buffer != nil {
+		buffer.Add(e, additionalHeaders)
+	}
+}
+
+// Buffered returns the events kept for replays, oldest first.
+func (f *MessageHandler) Buffered() ([]replay.Record, error) {
+	f.configMutex.RLock()
+	buffer := f.buffer
+	f.configMutex.RUnlock()
+
+	if buffer == nil {
+		return nil, ErrReplayDisabled
+	}
+	return buffer.From(replay.Position{}), nil
+}
+
+// Replay redelivers the buffered events from the position to a single
+// subscription, returning the number of events being replayed. The
+// subscription is selected by its UID, or by its subscriber URI when the
+// UID is empty. Events are delivered in the background, in the order they
+// were received.
+func (f *MessageHandler) Replay(ctx context.Context, uid types.UID, subscriberURI string, from replay.Position) (int, error) {
+	f.configMutex.RLock()
+	buffer := f.buffer
+	f.configMutex.RUnlock()
+
+	if buffer == nil {
+		return 0, ErrReplayDisabled
+	}
+
+	var matches []Subscription
+	for _, sub := range f.GetConfig(ctx).Subscriptions {
+		if sub.Subscriber == nil {
+			continue
+		}
+		if (uid != "" && sub.UID == uid) || (uid == "" && sub.Subscriber.String() == subscriberURI) {
+			matches = append(matches, sub)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return 0, ErrUnknownSubscriber
+	case 1:
+		records := buffer.From(from)
+		go f.replay(matches[0], records)
+		return len(records), nil
+	default:
+		return 0, ErrAmbiguousSubscriber
+	}
+}
+
+func (f *MessageHandler) replay(sub Subscription, records []replay.Record) {
+	if len(records) == 0 {
+		return
+	}
+
+	f.logger.Info("Replaying events",
+		zap.String("subscriber", sub.Subscriber.String()),
+		zap.Uint64("fromSequence", records[0].Sequence), zap.Int("count", len(records)))
+
+	ctx := context.Background()
+	for _, r := range records {
+		if _, err := f.makeFanoutRequest(withReceiveTime(ctx, r.Time), r.Event, r.Headers, sub); err != nil {
+			f.logger.Error("Failed to replay event",
+				zap.String("subscriber", sub.Subscriber.String()), zap.Uint64("sequence", r.Sequence),
+				zap.String("source", r.Event.Source()), zap.String("id", r.Event.ID()), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	"errors"
+	nethttp "net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/replay"
+)
+
+// waitReceived waits for the recorder to receive the number of events.
+func waitReceived(t *testing.T, rec *recorder, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for rec.received() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d events received, got %d", n, rec.received())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// reset forgets the events received by the recorder.
+func (r *recorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+func (r *recorder) ids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.events))
+	for _, e := range r.events {
+		ids = append(ids, e.ID())
+	}
+	return ids
+}
+
+func TestReplay(t *testing.T) {
+	single, singleSub := newSubscriber(t)
+	shared, sharedSub := newSubscriber(t)
+
+	subs := []Subscription{singleSub, sharedSub, sharedSub}
+	for i, uid := range []types.UID{"single", "shared-1", "shared-2"} {
+		subs[i].UID = uid
+	}
+	h := newHandler(t, Config{
+		Subscriptions: subs,
+		Replay:        &replay.Config{MaxBytes: replay.DefaultMaxBytes},
+	})
+	defer h.Close()
+
+	if code := send(t, h, newEvent("1")); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	time.Sleep(10 * time.Millisecond)
+	afterFirst := time.Now()
+	for _, id := range []string{"2", "3"} {
+		if code := send(t, h, newEvent(id)); code != nethttp.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", code)
+		}
+	}
+
+	testCases := map[string]struct {
+		uid        types.UID
+		subscriber string
+		from       replay.Position
+		rec        *recorder
+		wantIDs    []string
+		wantErr    error
+	}{
+		"from sequence": {
+			subscriber: singleSub.Subscriber.String(),
+			from:       replay.Position{Sequence: 2},
+			rec:        single,
+			wantIDs:    []string{"2", "3"},
+		},
+		"from time": {
+			subscriber: singleSub.Subscriber.String(),
+			from:       replay.Position{Time: afterFirst},
+			rec:        single,
+			wantIDs:    []string{"2", "3"},
+		},
+		"from the start": {
+			uid:     "single",
+			rec:     single,
+			wantIDs: []string{"1", "2", "3"},
+		},
+		"by UID of a shared subscriber": {
+			uid:     "shared-2",
+			from:    replay.Position{Sequence: 3},
+			rec:     shared,
+			wantIDs: []string{"3"},
+		},
+		"shared subscriber URI": {
+			subscriber: sharedSub.Subscriber.String(),
+			wantErr:    ErrAmbiguousSubscriber,
+		},
+		"unknown UID": {
+			uid:     "unknown",
+			wantErr: ErrUnknownSubscriber,
+		},
+		"unknown subscriber": {
+			subscriber: "http://unknown.ns.svc.cluster.local",
+			wantErr:    ErrUnknownSubscriber,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			single.reset()
+			shared.reset()
+
+			n, err := h.Replay(context.Background(), tc.uid, tc.subscriber, tc.from)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if n != len(tc.wantIDs) {
+				t.Errorf("Expected %d events replayed, got %d", len(tc.wantIDs), n)
+			}
+			waitReceived(t, tc.rec, len(tc.wantIDs))
+			if diff := cmp.Diff(tc.wantIDs, tc.rec.ids()); diff != "" {
+				t.Errorf("Unexpected replayed events (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReplayDisabled(t *testing.T) {
+	_, sub := newSubscriber(t)
+	h := newHandler(t, Config{Subscriptions: []Subscription{sub}})
+	defer h.Close()
+
+	if _, err := h.Replay(context.Background(), "", sub.Subscriber.String(), replay.Position{}); !errors.Is(err, ErrReplayDisabled) {
+		t.Errorf("Expected replay disabled error, got %v", err)
+	}
+}
+
+func TestReplayFromPosition(t *testing.T) {
+	rec, sub := newSubscriber(t)
+	first, second := sub, sub
+	first.UID, first.ReplayFrom = "first", &replay.Position{Sequence: 1}
+	second.UID, second.ReplayFrom = "second", &replay.Position{Sequence: 2}
+
+	h := newHandler(t, Config{Replay: &replay.Config{MaxBytes: replay.DefaultMaxBytes}})
+	defer h.Close()
+	for _, id := range []string{"1", "2"} {
+		if code := send(t, h, newEvent(id)); code != nethttp.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", code)
+		}
+	}
+
+	config := h.GetConfig(context.Background())
+	config.Subscriptions = []Subscription{first, second}
+	if err := h.SetConfig(context.Background(), config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Both subscriptions share the subscriber, which receives events 1 and
+	// 2 for the first one and event 2 for the second one.
+	waitReceived(t, rec, 3)
+
+	// Setting the same positions again does not replay.
+	rec.reset()
+	if err := h.SetConfig(context.Background(), h.GetConfig(context.Background())); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := rec.received(); n != 0 {
+		t.Errorf("Expected no events replayed for unchanged positions, got %d", n)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	nethttp "net/http"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/binding/transformer"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+
+	"knative.dev/eventing/pkg/channel"
+	"knative.dev/eventing/pkg/channel/attributes"
+	knfanout "knative.dev/eventing/pkg/channel/fanout"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/batch"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/compression"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/replay"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/transform"
+)
+
+// Subscription is a channel subscription along with its loudvents delivery options.
+type Subscription struct {
+	knfanout.Subscription
+	// UID of the subscription, which tells apart subscriptions to the same
+	// subscriber.
+	UID types.UID `json:"uid,omitempty"`
+	// Transform modifies events before they are delivered, disabled when nil.
+	Transform *transform.Config `json:"transform,omitempty"`
+	// Group is the delivery group the subscription belongs to, if any.
+	Group string `json:"group,omitempty"`
+	// TTL is the time after which the event is no longer delivered, counted
+	// from the event time attribute, or the time it was received when not
+	// present. Zero disables expiration.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// DeadLetterExpired sends expired events to the dead letter sink
+	// instead of dropping them.
+	DeadLetterExpired bool `json:"deadLetterExpired,omitempty"`
+	// ReplayFrom requests buffered events to be replayed to the subscription
+	// from this position. Events are replayed each time the position changes.
+	ReplayFrom *replay.Position `json:"replayFrom,omitempty"`
+	// Batch delivers events to the subscription in batches, disabled when nil.
+	Batch *batch.Config `json:"batch,omitempty"`
+	// ContentMode, ReplyContentMode and DeadLetterContentMode are the
+	// content modes events are sent with to the subscriber, reply and dead
+	// letter sink. Empty values pass the content mode through.
+	ContentMode           delivery.ContentMode `json:"contentMode,omitempty"`
+	ReplyContentMode      delivery.ContentMode `json:"replyContentMode,omitempty"`
+	DeadLetterContentMode delivery.ContentMode `json:"deadLetterContentMode,omitempty"`
+	// Compression compresses the requests sent to the subscriber, disabled when nil.
+	Compression *compression.Config `json:"compression,omitempty"`
+}
+
+// key identifies the subscription by its UID, or by its subscriber for
+// subscriptions without UID.
+func (s Subscription) key() string {
+	if s.UID != "" {
+		return string(s.UID)
+	}
+	return urlString(s.Subscriber)
+}
+
+// transform returns the event to deliver to the subscription. When the
+// transformation fails the error policy is applied, and a nil event is
+// returned if there is nothing left to deliver.
+func (f *MessageHandler) transform(ctx context.Context, e *event.Event, additionalHeaders nethttp.Header, sub Subscription) (*event.Event, *channel.DispatchExecutionInfo, error) {
+	if sub.Transform == nil {
+		return e, nil, nil
+	}
+
+	out, err := transform.Apply(e, sub.Transform)
+	if err == nil {
+		return out, nil, nil
+	}
+
+	f.logger.Warn("Failed to transform event",
+		zap.String("subscriber", urlString(sub.Subscriber)),
+		zap.String("source", e.Source()), zap.String("id", e.ID()),
+		zap.String("policy", string(sub.Transform.OnError)), zap.Error(err))
+
+	switch sub.Transform.OnError {
+	case transform.PolicyDeliverOriginal:
+		return e, nil, nil
+	case transform.PolicyDeadLetter:
+		if sub.DeadLetter == nil {
+			return nil, nil, nil
+		}
+		data := err.Error()
+		if len(data) > attributes.KnativeErrorDataExtensionMaxLength {
+			data = data[:attributes.KnativeErrorDataExtensionMaxLength]
+		}
+		transformers := []binding.Transformer{
+			transformer.AddExtension(attributes.KnativeErrorDataExtensionKey, data),
+		}
+		if sub.Subscriber != nil {
+			transformers = append(transformers, transformer.AddExtension(attributes.KnativeErrorDestExtensionKey, sub.Subscriber.String()))
+		}
+		if enrichment := f.deadLetterEnrichment(); enrichment != nil {
+			transformers = append(transformers, enrichment.Transformers(f.ref.Namespace+"/"+f.ref.Name, sub.Subscriber, nil))
+		}
+		res, err := f.dispatcher.Dispatch(ctx, &delivery.Request{
+			Message:      binding.ToMessage(e),
+			Headers:      additionalHeaders,
+			Destination:  sub.DeadLetter,
+			Retry:        sub.RetryConfig,
+			Transformers: transformers,
+			ContentMode:  eventContentMode(ctx, sub.DeadLetterContentMode),
+		})
+		return nil, res.Info, err
+	default:
+		return nil, nil, nil
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	nethttp "net/http"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"knative.dev/eventing/pkg/channel/attributes"
+	knfanout "knative.dev/eventing/pkg/channel/fanout"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/transform"
+)
+
+func TestTransformDeadLetterReplyOnly(t *testing.T) {
+	reply, replySub := newSubscriber(t)
+	deadLetter, deadLetterSub := newSubscriber(t)
+
+	h := newHandler(t, Config{Subscriptions: []Subscription{{
+		Subscription: knfanout.Subscription{
+			Reply:      replySub.Subscriber,
+			DeadLetter: deadLetterSub.Subscriber,
+		},
+		Transform: &transform.Config{
+			Data:    []transform.DataOp{{Op: transform.OpSet, Path: "id", Value: []byte(`"1"`)}},
+			OnError: transform.PolicyDeadLetter,
+		},
+	}}})
+	defer h.Close()
+
+	// Data that is not a JSON object cannot be transformed.
+	e := newEvent("1")
+	_ = e.SetData(event.ApplicationJSON, []string{"hello"})
+	if code := send(t, h, e); code != nethttp.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+
+	if n := reply.received(); n != 0 {
+		t.Errorf("Expected no events at the reply, got %d", n)
+	}
+	if n := deadLetter.received(); n != 1 {
+		t.Fatalf("Expected 1 dead lettered event, got %d", n)
+	}
+	ext := deadLetter.events[0].Extensions()
+	if _, ok := ext[attributes.KnativeErrorDataExtensionKey]; !ok {
+		t.Error("Expected the dead lettered event to carry the transformation error")
+	}
+	if dest, ok := ext[attributes.KnativeErrorDestExtensionKey]; ok {
+		t.Errorf("Expected no error destination without a subscriber, got %v", dest)
+	}
+}
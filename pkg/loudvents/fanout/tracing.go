@@ -0,0 +1,88 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	"errors"
+	nethttp "net/http"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.opencensus.io/trace"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+)
+
+const (
+	ingressSpanName = "loudvents.ingress"
+
+	// traceParentHeader is the W3C trace context header.
+	traceParentHeader = "traceparent"
+)
+
+type traceHeaderKey struct{}
+
+// withTraceHeader records whether the request propagated a trace context
+// through the traceparent header. The server span of requests without it
+// starts a new trace.
+func withTraceHeader(ctx context.Context, header nethttp.Header) context.Context {
+	return context.WithValue(ctx, traceHeaderKey{}, header.Get(traceParentHeader) != "")
+}
+
+// hasTraceHeader returns whether the request propagated a trace context
+// through the traceparent header.
+func hasTraceHeader(ctx context.Context) bool {
+	v, _ := ctx.Value(traceHeaderKey{}).(bool)
+	return v
+}
+
+// startIngressSpan starts the span of an event received by the channel. It
+// is a child of the span propagated by the request headers, or else of the
+// one in the event trace context extensions. When both are present and
+// belong to different traces, the event span is linked.
+func (f *MessageHandler) startIngressSpan(ctx context.Context, e *event.Event) (context.Context, *trace.Span) {
+	sc, ok := delivery.SpanContextFromEvent(e)
+
+	var span *trace.Span
+	if ok && !hasTraceHeader(ctx) {
+		ctx, span = trace.StartSpanWithRemoteParent(ctx, ingressSpanName, sc, trace.WithSpanKind(trace.SpanKindServer))
+	} else {
+		ctx, span = trace.StartSpan(ctx, ingressSpanName, trace.WithSpanKind(trace.SpanKindServer))
+		if ok && sc.TraceID != span.SpanContext().TraceID {
+			span.AddLink(trace.Link{TraceID: sc.TraceID, SpanID: sc.SpanID, Type: trace.LinkTypeParent})
+		}
+	}
+
+	span.AddAttributes(trace.StringAttribute(delivery.ChannelAttribute, f.ref.Namespace+"/"+f.ref.Name))
+	span.AddAttributes(delivery.EventAttributes(e)...)
+	return ctx, span
+}
+
+// endIngressSpan ends the span of a received event with the status code the
+// channel answered with.
+func endIngressSpan(span *trace.Span, err error) {
+	code := nethttp.StatusAccepted
+	status := trace.Status{Code: trace.StatusCodeOK}
+	if err != nil {
+		code = nethttp.StatusInternalServerError
+		var ierr *IngressError
+		if errors.As(err, &ierr) {
+			code = ierr.Code
+		}
+		status = trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()}
+	}
+	span.AddAttributes(trace.Int64Attribute(delivery.StatusCodeAttribute, int64(code)))
+	span.SetStatus(status)
+	span.End()
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel/attributes"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/schema"
+)
+
+// ValidationErrorExtension is the extension attribute that describes why an
+// event routed to the invalid events sink failed validation.
+const ValidationErrorExtension = "validationerror"
+
+// validate checks the event data against the channel schemas. It returns true
+// when the event has been routed to the invalid events sink and must not be
+// fanned out.
+func (f *MessageHandler) validate(ctx context.Context, cfg *schema.Config, e *event.Event, additionalHeaders nethttp.Header) (bool, error) {
+	f.configMutex.RLock()
+	validator := f.validator
+	f.configMutex.RUnlock()
+
+	if cfg == nil || validator == nil {
+		return false, nil
+	}
+
+	verr := validator.Validate(e)
+	if verr == nil {
+		return false, nil
+	}
+
+	if f.metricsReporter != nil {
+		_ = f.metricsReporter.ReportInvalidEvent(&metrics.ReportArgs{
+			Ns:        f.ref.Namespace,
+			Channel:   f.ref.Name,
+			EventType: e.Type(),
+		}, string(cfg.Mode))
+	}
+
+	if cfg.Mode == schema.ModeAudit {
+		f.logger.Warn("Event failed validation",
+			zap.String("source", e.Source()), zap.String("id", e.ID()), zap.Error(verr))
+		return false, nil
+	}
+
+	if cfg.InvalidEventsSink == nil {
+		return false, &IngressError{Code: nethttp.StatusBadRequest, Err: verr}
+	}
+
+	reason := verr.Error()
+	if len(reason) > attributes.KnativeErrorDataExtensionMaxLength {
+		reason = reason[:attributes.KnativeErrorDataExtensionMaxLength]
+	}
+	invalid := e.Clone()
+	invalid.SetExtension(ValidationErrorExtension, reason)
+
+	if _, err := f.dispatcher.DispatchMessage(ctx, binding.ToMessage(&invalid), additionalHeaders, cfg.InvalidEventsSink, nil, nil); err != nil {
+		return false, fmt.Errorf("sending invalid event to %s: %w", cfg.InvalidEventsSink, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"fmt"
+	"io/ioutil"
+	nethttp "net/http"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"go.uber.org/zap"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/webhook"
+)
+
+// webhookWrapper returns the wrapper for plain requests, nil when the
+// channel only accepts CloudEvents.
+func (f *MessageHandler) webhookWrapper() *webhook.Wrapper {
+	f.configMutex.RLock()
+	defer f.configMutex.RUnlock()
+	return f.webhook
+}
+
+// wrapRequest creates a message from a request that does not contain a CloudEvent.
+func (f *MessageHandler) wrapRequest(w *webhook.Wrapper, request *nethttp.Request) (binding.Message, error) {
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading request body: %w", err)
+	}
+
+	e, err := w.Wrap(request, body)
+	if err != nil {
+		return nil, &IngressError{Code: nethttp.StatusBadRequest, Err: err}
+	}
+
+	f.logger.Debug("Wrapped webhook request into an event",
+		zap.String("path", request.URL.Path), zap.String("source", e.Source()),
+		zap.String("id", e.ID()), zap.String("type", e.Type()))
+	return binding.ToMessage(e), nil
+}
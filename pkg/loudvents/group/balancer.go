@@ -0,0 +1,146 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package group implements competing consumer delivery, where each event is
+// delivered to exactly one member of a group of subscribers.
+package group
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+// Strategy selects the group member an event is delivered to.
+type Strategy string
+
+const (
+	// StrategyRoundRobin rotates events across members.
+	StrategyRoundRobin Strategy = "RoundRobin"
+	// StrategyPartitionKey delivers events with the same partition key to
+	// the same member, as long as it is healthy.
+	StrategyPartitionKey Strategy = "PartitionKey"
+)
+
+const (
+	// DefaultPartitionKey is the extension attribute used as partition key
+	// when none is configured.
+	DefaultPartitionKey = "partitionkey"
+
+	// unhealthyPeriod is the time a member is considered unhealthy after a
+	// failed delivery. Unhealthy members are only used for failover.
+	unhealthyPeriod = 30 * time.Second
+)
+
+// Config for a delivery group.
+type Config struct {
+	Name     string   `json:"name"`
+	Strategy Strategy `json:"strategy"`
+	// PartitionKey is the extension attribute hashed by the PartitionKey strategy.
+	PartitionKey string `json:"partitionKey,omitempty"`
+}
+
+// Balancer chooses the order in which group members are tried for each event.
+type Balancer struct {
+	cfg Config
+
+	mu        sync.Mutex
+	next      int
+	unhealthy map[string]time.Time
+
+	// overridable for testing
+	now func() time.Time
+}
+
+// NewBalancer creates a Balancer for the group.
+func NewBalancer(cfg Config) *Balancer {
+	if cfg.PartitionKey == "" {
+		cfg.PartitionKey = DefaultPartitionKey
+	}
+	return &Balancer{
+		cfg:       cfg,
+		unhealthy: make(map[string]time.Time),
+		now:       time.Now,
+	}
+}
+
+// Order returns the members in the order they should be tried for the event.
+// The preferred member comes first, followed by the rest as failover
+// candidates. Unhealthy members are moved to the end.
+func (b *Balancer) Order(e *event.Event, members []string) []string {
+	if len(members) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	start := -1
+	if b.cfg.Strategy == StrategyPartitionKey {
+		if key, err := types.ToString(e.Extensions()[b.cfg.PartitionKey]); err == nil && key != "" {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(key))
+			start = int(h.Sum32() % uint32(len(members)))
+		}
+	}
+	if start < 0 {
+		start = b.next % len(members)
+		b.next++
+	}
+
+	now := b.now()
+	healthy := make([]string, 0, len(members))
+	var unhealthy []string
+	for i := range members {
+		m := members[(start+i)%len(members)]
+		if until, ok := b.unhealthy[m]; ok && now.Before(until) {
+			unhealthy = append(unhealthy, m)
+			continue
+		}
+		healthy = append(healthy, m)
+	}
+	return append(healthy, unhealthy...)
+}
+
+// MarkFailed flags the member as unhealthy.
+func (b *Balancer) MarkFailed(member string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unhealthy[member] = b.now().Add(unhealthyPeriod)
+}
+
+// MarkSucceeded flags the member as healthy.
+func (b *Balancer) MarkSucceeded(member string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.unhealthy, member)
+}
+
+// Unhealthy returns the members currently flagged as unhealthy along with
+// the time they will be tried first again.
+func (b *Balancer) Unhealthy() map[string]time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	unhealthy := make(map[string]time.Time, len(b.unhealthy))
+	for m, until := range b.unhealthy {
+		if now.Before(until) {
+			unhealthy[m] = until
+		}
+	}
+	return unhealthy
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package group
+
+import (
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/go-cmp/cmp"
+)
+
+var members = []string{"a", "b", "c"}
+
+func TestRoundRobin(t *testing.T) {
+	b := NewBalancer(Config{Name: "workers", Strategy: StrategyRoundRobin})
+	e := event.New()
+
+	for _, want := range [][]string{
+		{"a", "b", "c"},
+		{"b", "c", "a"},
+		{"c", "a", "b"},
+		{"a", "b", "c"},
+	} {
+		if diff := cmp.Diff(want, b.Order(&e, members)); diff != "" {
+			t.Errorf("Unexpected order (-want, +got): %s", diff)
+		}
+	}
+}
+
+func TestPartitionKey(t *testing.T) {
+	b := NewBalancer(Config{Name: "workers", Strategy: StrategyPartitionKey})
+	e := event.New()
+	e.SetExtension(DefaultPartitionKey, "customer-1")
+
+	first := b.Order(&e, members)
+	for i := 0; i < 5; i++ {
+		if diff := cmp.Diff(first, b.Order(&e, members)); diff != "" {
+			t.Errorf("Same partition key delivered to a different member (-want, +got): %s", diff)
+		}
+	}
+}
+
+func TestUnhealthyMembersLast(t *testing.T) {
+	b := NewBalancer(Config{Name: "workers", Strategy: StrategyRoundRobin})
+	e := event.New()
+
+	b.MarkFailed("a")
+	if diff := cmp.Diff([]string{"b", "c", "a"}, b.Order(&e, members)); diff != "" {
+		t.Errorf("Unexpected order (-want, +got): %s", diff)
+	}
+
+	b.MarkSucceeded("a")
+	if diff := cmp.Diff([]string{"b", "c", "a"}, b.Order(&e, members)); diff != "" {
+		t.Errorf("Unexpected order (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,350 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics reports the loudvents specific dispatcher metrics, which
+// complement the ones reported by knative.dev/eventing/pkg/channel.
+package metrics
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	"knative.dev/eventing/pkg/channel"
+	eventingmetrics "knative.dev/eventing/pkg/metrics"
+	"knative.dev/pkg/metrics"
+)
+
+var (
+	// duplicateCountM is a counter which records the number of events
+	// dropped by the channel because they were duplicated.
+	duplicateCountM = stats.Int64(
+		"duplicate_event_count",
+		"Number of duplicated events dropped by the channel",
+		stats.UnitDimensionless,
+	)
+
+	// invalidCountM is a counter which records the number of events
+	// that failed data validation.
+	invalidCountM = stats.Int64(
+		"invalid_event_count",
+		"Number of events that failed data validation",
+		stats.UnitDimensionless,
+	)
+
+	// pendingDelayedM is a gauge which records the number of events held
+	// by the channel until their delivery time.
+	pendingDelayedM = stats.Int64(
+		"pending_delayed_event_count",
+		"Number of events held by the channel for delayed delivery",
+		stats.UnitDimensionless,
+	)
+
+	// laneDepthM is a gauge which records the number of events waiting for
+	// dispatch at each priority lane.
+	laneDepthM = stats.Int64(
+		"priority_lane_depth",
+		"Number of events waiting for dispatch at a priority lane",
+		stats.UnitDimensionless,
+	)
+
+	// budgetUsedM is a gauge which records the bytes of event payloads held
+	// in memory against the memory budget.
+	budgetUsedM = stats.Int64(
+		"memory_budget_used",
+		"Bytes of in-flight event payloads reserved from the memory budget",
+		stats.UnitBytes,
+	)
+
+	// expiredCountM is a counter which records the number of events
+	// whose TTL elapsed before they could be delivered.
+	expiredCountM = stats.Int64(
+		"expired_event_count",
+		"Number of events that expired before being delivered",
+		stats.UnitDimensionless,
+	)
+
+	// hopsExceededCountM is a counter which records the number of events
+	// not sent because they exceeded the hop limit.
+	hopsExceededCountM = stats.Int64(
+		"hops_exceeded_event_count",
+		"Number of events not sent because they exceeded the hop limit",
+		stats.UnitDimensionless,
+	)
+
+	// compressionRatioM is a distribution of the uncompressed to compressed
+	// size ratio of request bodies.
+	compressionRatioM = stats.Float64(
+		"compression_ratio",
+		"Ratio between the uncompressed and compressed size of request bodies",
+		stats.UnitDimensionless,
+	)
+
+	// compressionTimeM is a distribution of the CPU time spent compressing
+	// or decompressing request bodies.
+	compressionTimeM = stats.Float64(
+		"compression_cpu_time",
+		"Time spent compressing or decompressing request bodies",
+		stats.UnitMilliseconds,
+	)
+
+	namespaceKey  = tag.MustNewKey(eventingmetrics.LabelNamespaceName)
+	channelKey    = tag.MustNewKey(eventingmetrics.LabelName)
+	eventTypeKey  = tag.MustNewKey(eventingmetrics.LabelEventType)
+	modeKey       = tag.MustNewKey("validation_mode")
+	actionKey     = tag.MustNewKey("expired_action")
+	directionKey  = tag.MustNewKey("direction")
+	encodingKey   = tag.MustNewKey("content_encoding")
+	subscriberKey = tag.MustNewKey("subscriber_uri")
+	targetKey     = tag.MustNewKey("target_uri")
+	hopsActionKey = tag.MustNewKey("hops_action")
+	laneKey       = tag.MustNewKey("priority_lane")
+	budgetKey     = tag.MustNewKey("memory_budget")
+)
+
+// Memory budget scopes.
+const (
+	BudgetDispatcher = "dispatcher"
+	BudgetChannel    = "channel"
+)
+
+// Compression directions.
+const (
+	DirectionIngress = "ingress"
+	DirectionEgress  = "egress"
+)
+
+// ReportArgs identifies the channel and event a measurement refers to.
+type ReportArgs struct {
+	Ns        string
+	Channel   string
+	EventType string
+}
+
+func init() {
+	register()
+}
+
+// StatsReporter reports loudvents dispatcher metrics.
+type StatsReporter interface {
+	ReportDuplicateEvent(args *ReportArgs) error
+	ReportInvalidEvent(args *ReportArgs, mode string) error
+	ReportPendingDelayedEvents(args *ReportArgs, count int) error
+	ReportLaneDepth(args *ReportArgs, lane, depth int) error
+	ReportBudgetUsed(args *ReportArgs, scope string, used int64) error
+	ReportExpiredEvent(args *ReportArgs, action string) error
+	ReportHopsExceeded(args *ReportArgs, subscriber, target, action string) error
+	ReportCompression(args *ReportArgs, direction, encoding string, ratio float64, cpuTime time.Duration) error
+}
+
+var _ StatsReporter = (*reporter)(nil)
+var emptyContext = context.Background()
+
+// reporter holds cached metric objects to report loudvents metrics.
+type reporter struct {
+	container  string
+	uniqueName string
+}
+
+// NewStatsReporter creates a reporter that collects and reports loudvents metrics.
+func NewStatsReporter(container, uniqueName string) StatsReporter {
+	return &reporter{
+		container:  container,
+		uniqueName: uniqueName,
+	}
+}
+
+func register() {
+	tagKeys := []tag.Key{
+		namespaceKey,
+		channelKey,
+		eventTypeKey,
+		channel.UniqueTagKey,
+		channel.ContainerTagKey,
+	}
+	// Gauges are reported per channel, not per event type.
+	channelTagKeys := []tag.Key{
+		namespaceKey,
+		channelKey,
+		channel.UniqueTagKey,
+		channel.ContainerTagKey,
+	}
+
+	err := metrics.RegisterResourceView(
+		&view.View{
+			Description: duplicateCountM.Description(),
+			Measure:     duplicateCountM,
+			Aggregation: view.Count(),
+			TagKeys:     tagKeys,
+		},
+		&view.View{
+			Description: invalidCountM.Description(),
+			Measure:     invalidCountM,
+			Aggregation: view.Count(),
+			TagKeys:     append(tagKeys, modeKey),
+		},
+		&view.View{
+			Description: expiredCountM.Description(),
+			Measure:     expiredCountM,
+			Aggregation: view.Count(),
+			TagKeys:     append(tagKeys, actionKey),
+		},
+		&view.View{
+			Description: hopsExceededCountM.Description(),
+			Measure:     hopsExceededCountM,
+			Aggregation: view.Count(),
+			TagKeys:     append(tagKeys, subscriberKey, targetKey, hopsActionKey),
+		},
+		&view.View{
+			Description: compressionRatioM.Description(),
+			Measure:     compressionRatioM,
+			Aggregation: view.Distribution(1, 1.5, 2, 3, 5, 10, 20, 50),
+			TagKeys:     append(channelTagKeys, directionKey, encodingKey),
+		},
+		&view.View{
+			Description: compressionTimeM.Description(),
+			Measure:     compressionTimeM,
+			Aggregation: view.Distribution(0.1, 0.5, 1, 5, 10, 50, 100, 500),
+			TagKeys:     append(channelTagKeys, directionKey, encodingKey),
+		},
+		&view.View{
+			Description: pendingDelayedM.Description(),
+			Measure:     pendingDelayedM,
+			Aggregation: view.LastValue(),
+			TagKeys:     channelTagKeys,
+		},
+		&view.View{
+			Description: laneDepthM.Description(),
+			Measure:     laneDepthM,
+			Aggregation: view.LastValue(),
+			TagKeys:     append(channelTagKeys, laneKey),
+		},
+		&view.View{
+			Description: budgetUsedM.Description(),
+			Measure:     budgetUsedM,
+			Aggregation: view.LastValue(),
+			TagKeys:     append(channelTagKeys, budgetKey),
+		},
+	)
+	if err != nil {
+		log.Print("failed to register opencensus views, " + err.Error())
+	}
+}
+
+// ReportDuplicateEvent captures a dropped duplicated event.
+func (r *reporter) ReportDuplicateEvent(args *ReportArgs) error {
+	ctx, err := r.generateTag(args)
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, duplicateCountM.M(1))
+	return nil
+}
+
+// ReportInvalidEvent captures an event that failed validation.
+func (r *reporter) ReportInvalidEvent(args *ReportArgs, mode string) error {
+	ctx, err := r.generateTag(args, tag.Insert(modeKey, mode))
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, invalidCountM.M(1))
+	return nil
+}
+
+// ReportPendingDelayedEvents captures the number of events waiting for
+// delayed delivery.
+func (r *reporter) ReportPendingDelayedEvents(args *ReportArgs, count int) error {
+	ctx, err := r.generateTag(args)
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, pendingDelayedM.M(int64(count)))
+	return nil
+}
+
+// ReportLaneDepth captures the number of events waiting for dispatch at a
+// priority lane.
+func (r *reporter) ReportLaneDepth(args *ReportArgs, lane, depth int) error {
+	ctx, err := r.generateTag(args, tag.Insert(laneKey, strconv.Itoa(lane)))
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, laneDepthM.M(int64(depth)))
+	return nil
+}
+
+// ReportBudgetUsed captures the bytes reserved from a memory budget. The
+// dispatcher budget is reported without namespace and channel.
+func (r *reporter) ReportBudgetUsed(args *ReportArgs, scope string, used int64) error {
+	ctx, err := r.generateTag(args, tag.Insert(budgetKey, scope))
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, budgetUsedM.M(used))
+	return nil
+}
+
+// ReportExpiredEvent captures an event that expired before delivery, and
+// whether it was dropped or dead lettered.
+func (r *reporter) ReportExpiredEvent(args *ReportArgs, action string) error {
+	ctx, err := r.generateTag(args, tag.Insert(actionKey, action))
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, expiredCountM.M(1))
+	return nil
+}
+
+// ReportHopsExceeded captures an event that exceeded the hop limit when
+// being sent to the target on behalf of the subscriber, and whether it was
+// dropped or dead lettered.
+func (r *reporter) ReportHopsExceeded(args *ReportArgs, subscriber, target, action string) error {
+	ctx, err := r.generateTag(args,
+		tag.Insert(subscriberKey, subscriber),
+		tag.Insert(targetKey, target),
+		tag.Insert(hopsActionKey, action))
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, hopsExceededCountM.M(1))
+	return nil
+}
+
+// ReportCompression captures the compression ratio and CPU time of a request
+// body compressed for delivery or decompressed on ingress.
+func (r *reporter) ReportCompression(args *ReportArgs, direction, encoding string, ratio float64, cpuTime time.Duration) error {
+	ctx, err := r.generateTag(args, tag.Insert(directionKey, direction), tag.Insert(encodingKey, encoding))
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, compressionRatioM.M(ratio))
+	metrics.Record(ctx, compressionTimeM.M(float64(cpuTime)/float64(time.Millisecond)))
+	return nil
+}
+
+func (r *reporter) generateTag(args *ReportArgs, extra ...tag.Mutator) (context.Context, error) {
+	return tag.New(
+		emptyContext,
+		append([]tag.Mutator{
+			tag.Insert(namespaceKey, args.Ns),
+			tag.Insert(channelKey, args.Channel),
+			tag.Insert(eventTypeKey, args.EventType),
+			tag.Insert(channel.ContainerTagKey, r.container),
+			tag.Insert(channel.UniqueTagKey, r.uniqueName),
+		}, extra...)...)
+}
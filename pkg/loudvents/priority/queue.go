@@ -0,0 +1,188 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package priority queues the dispatch of events in lanes chosen by their
+// priority extension. Lanes are served by weighted round robin, starting at
+// the highest lane, so that lower lanes are never starved.
+package priority
+
+import (
+	"sync"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+// Extension is the event extension holding the lane of the event, as an
+// integer where 0 is the lowest priority.
+const Extension = "priority"
+
+const (
+	// DefaultLanes is the number of lanes used when not configured.
+	DefaultLanes = 3
+	// MaxLanes is the highest number of lanes.
+	MaxLanes = 10
+	// DefaultConcurrency is the number of events dispatched at the same time
+	// when not configured.
+	DefaultConcurrency = 100
+)
+
+// Config for the priority lanes of a channel.
+type Config struct {
+	// Lanes is the number of lanes.
+	Lanes int `json:"lanes"`
+	// Weights is the number of events served from each lane per round,
+	// starting at the lowest lane. Lanes without a weight use 2^lane.
+	Weights []int `json:"weights,omitempty"`
+	// DefaultLane is the lane of events without a valid priority.
+	DefaultLane int `json:"defaultLane,omitempty"`
+	// Concurrency is the number of events dispatched at the same time.
+	Concurrency int `json:"concurrency"`
+}
+
+// normalize returns the configuration with defaults applied.
+func (c Config) normalize() Config {
+	if c.Lanes <= 0 {
+		c.Lanes = DefaultLanes
+	}
+	if c.Lanes > MaxLanes {
+		c.Lanes = MaxLanes
+	}
+	weights := make([]int, c.Lanes)
+	for i := range weights {
+		weights[i] = 1 << i
+		if i < len(c.Weights) && c.Weights[i] > 0 {
+			weights[i] = c.Weights[i]
+		}
+	}
+	c.Weights = weights
+	if c.DefaultLane < 0 || c.DefaultLane >= c.Lanes {
+		c.DefaultLane = 0
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = DefaultConcurrency
+	}
+	return c
+}
+
+// Lane returns the lane of the event, the default lane when its priority
+// extension is missing or not an integer. Priorities over the highest lane
+// use the highest lane.
+func (c *Config) Lane(e *event.Event) int {
+	v, ok := e.Extensions()[Extension]
+	if !ok {
+		return c.DefaultLane
+	}
+	p, err := types.ToInteger(v)
+	if err != nil || p < 0 {
+		return c.DefaultLane
+	}
+	if int(p) >= c.Lanes {
+		return c.Lanes - 1
+	}
+	return int(p)
+}
+
+// Queue holds tasks in lanes until they are popped.
+type Queue struct {
+	cfg Config
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	lanes  [][]func()
+	total  int
+	closed bool
+
+	// lane is the lane being served, and served the number of tasks popped
+	// from it in the current round.
+	lane   int
+	served int
+}
+
+// NewQueue creates a queue for the configuration.
+func NewQueue(cfg Config) *Queue {
+	cfg = cfg.normalize()
+	q := &Queue{
+		cfg:   cfg,
+		lanes: make([][]func(), cfg.Lanes),
+		lane:  cfg.Lanes - 1,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Config returns the queue configuration, with defaults applied.
+func (q *Queue) Config() Config {
+	return q.cfg
+}
+
+// Push adds a task to the lane, returning false when the queue is closed.
+func (q *Queue) Push(lane int, task func()) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+	q.lanes[lane] = append(q.lanes[lane], task)
+	q.total++
+	q.cond.Signal()
+	return true
+}
+
+// Pop blocks until there is a task, and returns it along with its lane. It
+// returns false once the queue is closed and empty.
+func (q *Queue) Pop() (func(), int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.total == 0 {
+		if q.closed {
+			return nil, 0, false
+		}
+		q.cond.Wait()
+	}
+
+	// Serve up to the lane weight before moving to the next lower lane,
+	// wrapping around to the highest one.
+	for len(q.lanes[q.lane]) == 0 || q.served >= q.cfg.Weights[q.lane] {
+		q.served = 0
+		q.lane--
+		if q.lane < 0 {
+			q.lane = q.cfg.Lanes - 1
+		}
+	}
+
+	lane := q.lane
+	task := q.lanes[lane][0]
+	q.lanes[lane][0] = nil
+	q.lanes[lane] = q.lanes[lane][1:]
+	q.total--
+	q.served++
+	return task, lane, true
+}
+
+// Depth returns the number of tasks waiting at the lane.
+func (q *Queue) Depth(lane int) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.lanes[lane])
+}
+
+// Close stops accepting tasks. Tasks already queued can still be popped.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
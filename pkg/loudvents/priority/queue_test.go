@@ -0,0 +1,113 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package priority
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLane(t *testing.T) {
+	cfg := NewQueue(Config{Lanes: 3, DefaultLane: 1}).Config()
+
+	testCases := map[string]struct {
+		priority interface{}
+		want     int
+	}{
+		"Missing":        {want: 1},
+		"Integer":        {priority: 2, want: 2},
+		"String":         {priority: "0", want: 0},
+		"Over highest":   {priority: 7, want: 2},
+		"Negative":       {priority: -1, want: 1},
+		"Not an integer": {priority: "high", want: 1},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			e := event.New()
+			if tc.priority != nil {
+				e.SetExtension(Extension, tc.priority)
+			}
+			if got := cfg.Lane(&e); got != tc.want {
+				t.Errorf("Expected lane %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestQueueWeightedRoundRobin(t *testing.T) {
+	q := NewQueue(Config{Lanes: 3, Weights: []int{1, 2, 3}})
+	for lane := 0; lane < 3; lane++ {
+		for i := 0; i < 4; i++ {
+			q.Push(lane, func() {})
+		}
+	}
+	q.Close()
+
+	var got []int
+	for {
+		_, lane, ok := q.Pop()
+		if !ok {
+			break
+		}
+		got = append(got, lane)
+	}
+
+	want := []int{2, 2, 2, 1, 1, 0, 2, 1, 1, 0, 0, 0}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected lane order (-want, +got): %s", diff)
+	}
+}
+
+func TestQueueDepth(t *testing.T) {
+	q := NewQueue(Config{Lanes: 2})
+	q.Push(1, func() {})
+	q.Push(1, func() {})
+	q.Push(0, func() {})
+
+	if d := q.Depth(1); d != 2 {
+		t.Errorf("Expected depth 2 at lane 1, got %d", d)
+	}
+	q.Pop()
+	if d := q.Depth(1); d != 1 {
+		t.Errorf("Expected depth 1 at lane 1, got %d", d)
+	}
+}
+
+func TestQueueClose(t *testing.T) {
+	q := NewQueue(Config{})
+
+	done := make(chan bool)
+	go func() {
+		_, _, ok := q.Pop()
+		done <- ok
+	}()
+
+	q.Close()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("Expected no task from a closed queue")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Pop did not return after closing the queue")
+	}
+
+	if q.Push(0, func() {}) {
+		t.Error("Expected a closed queue to refuse tasks")
+	}
+}
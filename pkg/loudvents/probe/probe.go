@@ -0,0 +1,159 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package probe lets the controller confirm that dispatcher pods have loaded
+// a channel, at the generation the controller has observed.
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	nethttp "net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/network"
+)
+
+const (
+	// PathPrefix is the path dispatchers serve channel status probes at.
+	PathPrefix = "/channels/"
+
+	// DefaultPortName is the name of the dispatcher service port probes
+	// are sent to when not configured.
+	DefaultPortName = "http-dispatcher"
+)
+
+// ErrNotLoaded is returned when the dispatcher has not loaded the channel.
+var ErrNotLoaded = errors.New("channel not loaded")
+
+// ChannelStatus is the status of a channel loaded by a dispatcher.
+type ChannelStatus struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	HostName  string `json:"hostName"`
+	// Generation is the channel generation the dispatcher has loaded.
+	Generation int64 `json:"generation"`
+	// FailedGeneration is the channel generation the dispatcher cannot
+	// load, because of Error, if any.
+	FailedGeneration int64  `json:"failedGeneration,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+// Path returns the probe path for the channel.
+func Path(namespace, name string) string {
+	return PathPrefix + namespace + "/" + name
+}
+
+// ParsePath returns the channel a probe path refers to.
+func ParsePath(path string) (namespace, name string, ok bool) {
+	if !strings.HasPrefix(path, PathPrefix) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, PathPrefix), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Probe asks the dispatcher listening at addr, as host:port, for the status
+// of the channel. Probes are flagged as kubelet probes, which dispatchers
+// answer regardless of the channel host the request is addressed to.
+func Probe(ctx context.Context, client *nethttp.Client, addr, namespace, name string) (*ChannelStatus, error) {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, "http://"+addr+Path(namespace, name), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating probe request: %w", err)
+	}
+	req.Header.Set(network.KubeletProbeHeaderName, "loudvents-controller")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("probing dispatcher %s: %w", addr, err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case nethttp.StatusOK:
+	case nethttp.StatusNotFound:
+		return nil, ErrNotLoaded
+	default:
+		return nil, fmt.Errorf("probing dispatcher %s: unexpected status code %d", addr, res.StatusCode)
+	}
+
+	status := &ChannelStatus{}
+	if err := json.NewDecoder(res.Body).Decode(status); err != nil {
+		return nil, fmt.Errorf("decoding probe response from %s: %w", addr, err)
+	}
+	return status, nil
+}
+
+// Result is the outcome of probing a dispatcher.
+type Result struct {
+	Addr   string
+	Status *ChannelStatus
+	Err    error
+}
+
+// ProbeAll probes the dispatchers listening at addrs in parallel, returning
+// the results in the same order. Probes still running when the context is
+// done fail.
+func ProbeAll(ctx context.Context, client *nethttp.Client, addrs []string, namespace, name string) []Result {
+	results := make([]Result, len(addrs))
+
+	var wg sync.WaitGroup
+	for i := range addrs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			status, err := Probe(ctx, client, addrs[i], namespace, name)
+			results[i] = Result{Addr: addrs[i], Status: status, Err: err}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// Addresses returns the host:port addresses of the ready dispatchers behind
+// the endpoints, at the port with the given name. Subsets with a single
+// unnamed port use it.
+func Addresses(eps *corev1.Endpoints, portName string) []string {
+	var addrs []string
+	for _, subset := range eps.Subsets {
+		port, ok := subsetPort(subset, portName)
+		if !ok {
+			continue
+		}
+		for _, a := range subset.Addresses {
+			addrs = append(addrs, net.JoinHostPort(a.IP, strconv.Itoa(int(port))))
+		}
+	}
+	return addrs
+}
+
+func subsetPort(subset corev1.EndpointSubset, portName string) (int32, bool) {
+	if len(subset.Ports) == 1 && subset.Ports[0].Name == "" {
+		return subset.Ports[0].Port, true
+	}
+	for _, p := range subset.Ports {
+		if p.Name == portName {
+			return p.Port, true
+		}
+	}
+	return 0, false
+}
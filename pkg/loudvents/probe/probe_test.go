@@ -0,0 +1,158 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	nethttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/network"
+)
+
+func TestParsePath(t *testing.T) {
+	testCases := map[string]struct {
+		path      string
+		namespace string
+		name      string
+		ok        bool
+	}{
+		"channel":           {path: "/channels/ns/name", namespace: "ns", name: "name", ok: true},
+		"trailing slash":    {path: "/channels/ns/name/", namespace: "ns", name: "name", ok: true},
+		"missing name":      {path: "/channels/ns"},
+		"too many segments": {path: "/channels/ns/name/extra"},
+		"other path":        {path: "/readyz"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			namespace, channel, ok := ParsePath(tc.path)
+			if ok != tc.ok || namespace != tc.namespace || channel != tc.name {
+				t.Errorf("Expected (%q, %q, %t), got (%q, %q, %t)", tc.namespace, tc.name, tc.ok, namespace, channel, ok)
+			}
+		})
+	}
+}
+
+func TestProbe(t *testing.T) {
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.Header.Get(network.KubeletProbeHeaderName) == "" {
+			w.WriteHeader(nethttp.StatusBadRequest)
+			return
+		}
+		namespace, name, ok := ParsePath(r.URL.Path)
+		if !ok || name != "loaded" {
+			w.WriteHeader(nethttp.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&ChannelStatus{Namespace: namespace, Name: name, Generation: 3})
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	status, err := Probe(context.Background(), srv.Client(), addr, "ns", "loaded")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status.Namespace != "ns" || status.Name != "loaded" || status.Generation != 3 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	if _, err := Probe(context.Background(), srv.Client(), addr, "ns", "missing"); !errors.Is(err, ErrNotLoaded) {
+		t.Errorf("Expected the channel not to be loaded, got %v", err)
+	}
+}
+
+func TestProbeAll(t *testing.T) {
+	loaded := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		namespace, name, _ := ParsePath(r.URL.Path)
+		_ = json.NewEncoder(w).Encode(&ChannelStatus{Namespace: namespace, Name: name, Generation: 1})
+	}))
+	defer loaded.Close()
+	block := make(chan struct{})
+	hung := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		<-block
+	}))
+	defer hung.Close()
+	defer close(block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	addrs := []string{strings.TrimPrefix(hung.URL, "http://"), strings.TrimPrefix(loaded.URL, "http://")}
+	results := ProbeAll(ctx, nethttp.DefaultClient, addrs, "ns", "name")
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].Addr != addrs[0] || results[0].Err == nil {
+		t.Errorf("Expected the probe of the hung dispatcher to fail, got %+v", results[0])
+	}
+	if results[1].Addr != addrs[1] || results[1].Err != nil || results[1].Status.Generation != 1 {
+		t.Errorf("Expected the probe of the loaded dispatcher to succeed, got %+v", results[1])
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	testCases := map[string]struct {
+		subsets []corev1.EndpointSubset
+		want    []string
+	}{
+		"no subsets": {},
+		"named port": {
+			subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+				Ports: []corev1.EndpointPort{
+					{Name: "http-metrics", Port: 9090},
+					{Name: DefaultPortName, Port: 8080},
+				},
+			}},
+			want: []string{"10.0.0.1:8080", "10.0.0.2:8080"},
+		},
+		"single unnamed port": {
+			subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				Ports:     []corev1.EndpointPort{{Port: 8080}},
+			}},
+			want: []string{"10.0.0.1:8080"},
+		},
+		"port not found": {
+			subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				Ports:     []corev1.EndpointPort{{Name: "http-metrics", Port: 9090}},
+			}},
+		},
+		"not ready addresses": {
+			subsets: []corev1.EndpointSubset{{
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				Ports:             []corev1.EndpointPort{{Name: DefaultPortName, Port: 8080}},
+			}},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := Addresses(&corev1.Endpoints{Subsets: tc.subsets}, DefaultPortName)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected addresses %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
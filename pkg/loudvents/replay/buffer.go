@@ -0,0 +1,159 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package replay keeps the most recent events received by a channel in
+// memory so that they can be redelivered to a subscriber.
+package replay
+
+import (
+	nethttp "net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// DefaultMaxBytes is the memory cap used when not configured.
+const DefaultMaxBytes = 64 << 20
+
+// Config for a replay buffer. Events are evicted when any limit is reached.
+type Config struct {
+	// MaxEvents is the number of events kept, unlimited when zero.
+	MaxEvents int `json:"maxEvents,omitempty"`
+	// Retention is the time events are kept for, unlimited when zero.
+	Retention time.Duration `json:"retention,omitempty"`
+	// MaxBytes caps the size of the buffered events data.
+	MaxBytes int64 `json:"maxBytes"`
+}
+
+// Position is the point replays start from. Events with a sequence number
+// equal or greater than Sequence, and received at or after Time, are replayed.
+type Position struct {
+	Time     time.Time `json:"time,omitempty"`
+	Sequence uint64    `json:"sequence,omitempty"`
+}
+
+// Record is a buffered event.
+type Record struct {
+	Sequence uint64         `json:"sequence"`
+	Time     time.Time      `json:"time"`
+	Event    *event.Event   `json:"event"`
+	Headers  nethttp.Header `json:"-"`
+
+	size int64
+}
+
+// Buffer is a bounded buffer of the most recent events, in arrival order.
+type Buffer struct {
+	cfg Config
+
+	mu      sync.Mutex
+	records []Record
+	seq     uint64
+	bytes   int64
+
+	// overridable for testing
+	now func() time.Time
+}
+
+// NewBuffer creates an empty buffer.
+func NewBuffer(cfg Config) *Buffer {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBytes
+	}
+	return &Buffer{
+		cfg: cfg,
+		now: time.Now,
+	}
+}
+
+// Add buffers the event and returns its sequence number.
+func (b *Buffer) Add(e *event.Event, headers nethttp.Header) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	r := Record{
+		Sequence: b.seq,
+		Time:     b.now(),
+		Event:    e,
+		Headers:  headers,
+		size:     int64(len(e.Data()) + len(e.ID()) + len(e.Source()) + len(e.Type())),
+	}
+	b.records = append(b.records, r)
+	b.bytes += r.size
+	b.evict()
+	return r.Sequence
+}
+
+// From returns the buffered events at or after the position, oldest first.
+func (b *Buffer) From(pos Position) []Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.evict()
+	var ret []Record
+	for _, r := range b.records {
+		if r.Sequence >= pos.Sequence && !r.Time.Before(pos.Time) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// Len returns the number of buffered events.
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.records)
+}
+
+// Restore adds the records of a previous buffer, keeping their sequence numbers.
+func (b *Buffer) Restore(records []Record) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, r := range records {
+		b.records = append(b.records, r)
+		b.bytes += r.size
+		if r.Sequence > b.seq {
+			b.seq = r.Sequence
+		}
+	}
+	b.evict()
+}
+
+// evict drops the oldest records that exceed the buffer limits. Must be
+// called with the lock held.
+func (b *Buffer) evict() {
+	n := 0
+	for n < len(b.records) {
+		r := b.records[n]
+		count := len(b.records) - n
+		expired := b.cfg.Retention > 0 && b.now().Sub(r.Time) > b.cfg.Retention
+		overCount := b.cfg.MaxEvents > 0 && count > b.cfg.MaxEvents
+		// The newest record is always kept, even if over the memory cap.
+		overBytes := b.bytes > b.cfg.MaxBytes && count > 1
+		if !expired && !overCount && !overBytes {
+			break
+		}
+		b.bytes -= r.size
+		n++
+	}
+	// Clear evicted records so their events can be garbage collected before
+	// the underlying array is reallocated by append.
+	for i := 0; i < n; i++ {
+		b.records[i] = Record{}
+	}
+	b.records = b.records[n:]
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replay
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newEvent(id int) *event.Event {
+	e := event.New()
+	e.SetID(strconv.Itoa(id))
+	e.SetType("test.type")
+	e.SetSource("test")
+	return &e
+}
+
+func sequences(records []Record) []uint64 {
+	var ret []uint64
+	for _, r := range records {
+		ret = append(ret, r.Sequence)
+	}
+	return ret
+}
+
+func TestBufferLimits(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		cfg  Config
+		want []uint64
+	}{
+		"Max events": {
+			cfg:  Config{MaxEvents: 2},
+			want: []uint64{4, 5},
+		},
+		"Retention": {
+			cfg:  Config{Retention: 150 * time.Second},
+			want: []uint64{3, 4, 5},
+		},
+		"Max bytes": {
+			// Each test event accounts for 14 bytes.
+			cfg:  Config{MaxBytes: 42},
+			want: []uint64{3, 4, 5},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b := NewBuffer(tc.cfg)
+			clock := now
+			b.now = func() time.Time { return clock }
+
+			for i := 1; i <= 5; i++ {
+				b.Add(newEvent(i), nil)
+				clock = clock.Add(time.Minute)
+			}
+			clock = clock.Add(-time.Minute)
+
+			if diff := cmp.Diff(tc.want, sequences(b.From(Position{}))); diff != "" {
+				t.Errorf("Unexpected buffered events (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestBufferFrom(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBuffer(Config{})
+	clock := now
+	b.now = func() time.Time { return clock }
+
+	for i := 1; i <= 5; i++ {
+		b.Add(newEvent(i), nil)
+		clock = clock.Add(time.Minute)
+	}
+
+	if diff := cmp.Diff([]uint64{4, 5}, sequences(b.From(Position{Sequence: 4}))); diff != "" {
+		t.Errorf("Unexpected events from sequence (-want, +got): %s", diff)
+	}
+	if diff := cmp.Diff([]uint64{3, 4, 5}, sequences(b.From(Position{Time: now.Add(2 * time.Minute)}))); diff != "" {
+		t.Errorf("Unexpected events from time (-want, +got): %s", diff)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scheduler shares the delivery concurrency of a dispatcher among
+// its channels. Deliveries take a slot from a bounded pool, and when the pool
+// is exhausted freed slots are granted to the waiting channels by stride
+// scheduling, so that each channel gets a share proportional to its weight.
+package scheduler
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	// DefaultWeight is the weight of channels without one.
+	DefaultWeight = 1
+
+	// stride1 is the pass increment of a channel of weight 1. Channels of
+	// weight w advance stride1/w per slot granted.
+	stride1 = 1 << 20
+)
+
+// Scheduler grants delivery slots to channels.
+type Scheduler struct {
+	capacity int
+
+	mu       sync.Mutex
+	inFlight int
+	channels map[string]*channelQueue
+}
+
+// channelQueue holds the deliveries of a channel waiting for a slot.
+type channelQueue struct {
+	weight int
+	// pass is the virtual time of the channel, the one with the lowest pass
+	// being granted the next slot.
+	pass    int64
+	waiters []chan struct{}
+}
+
+func (c *channelQueue) stride() int64 {
+	return stride1 / int64(c.weight)
+}
+
+// New creates a scheduler that allows up to capacity deliveries in flight.
+func New(capacity int) *Scheduler {
+	return &Scheduler{
+		capacity: capacity,
+		channels: make(map[string]*channelQueue),
+	}
+}
+
+// SetWeight sets the weight of the channel, DefaultWeight when not positive.
+func (s *Scheduler) SetWeight(channel string, weight int) {
+	if weight <= 0 {
+		weight = DefaultWeight
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channel(channel).weight = weight
+}
+
+// Remove forgets the channel. Deliveries waiting for a slot are still granted one.
+func (s *Scheduler) Remove(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.channels[channel]; ok && len(c.waiters) == 0 {
+		delete(s.channels, channel)
+	}
+}
+
+// Acquire blocks until a delivery slot is granted to the channel, returning
+// the function that frees it, or until the context is done.
+func (s *Scheduler) Acquire(ctx context.Context, channel string) (func(), error) {
+	s.mu.Lock()
+	c := s.channel(channel)
+	if s.inFlight < s.capacity && !s.waiting() {
+		s.grant(c)
+		s.mu.Unlock()
+		return s.release, nil
+	}
+
+	// Channels starting to wait join at the pass of the other waiting
+	// channels, so that the credit or debt accumulated while the dispatcher
+	// was not saturated does not count.
+	if len(c.waiters) == 0 {
+		if min, ok := s.minPass(); ok {
+			c.pass = min
+		}
+	}
+	ready := make(chan struct{})
+	c.waiters = append(c.waiters, ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return s.release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, w := range c.waiters {
+			if w == ready {
+				c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+				return nil, ctx.Err()
+			}
+		}
+		// The slot was granted while giving up.
+		s.releaseLocked()
+		return nil, ctx.Err()
+	}
+}
+
+// InFlight returns the number of slots in use.
+func (s *Scheduler) InFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inFlight
+}
+
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked()
+}
+
+// releaseLocked frees a slot and grants it to the waiting channel with the
+// lowest pass.
+func (s *Scheduler) releaseLocked() {
+	s.inFlight--
+
+	for s.inFlight < s.capacity {
+		var next *channelQueue
+		var nextName string
+		for name, c := range s.channels {
+			if len(c.waiters) == 0 {
+				continue
+			}
+			if next == nil || c.pass < next.pass || (c.pass == next.pass && name < nextName) {
+				next, nextName = c, name
+			}
+		}
+		if next == nil {
+			return
+		}
+
+		ready := next.waiters[0]
+		next.waiters = next.waiters[1:]
+		s.grant(next)
+		close(ready)
+	}
+}
+
+func (s *Scheduler) grant(c *channelQueue) {
+	s.inFlight++
+	c.pass += c.stride()
+}
+
+// waiting returns whether any channel is waiting for a slot.
+func (s *Scheduler) waiting() bool {
+	for _, c := range s.channels {
+		if len(c.waiters) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// minPass returns the lowest pass of the channels waiting for a slot.
+func (s *Scheduler) minPass() (int64, bool) {
+	var min int64
+	found := false
+	for _, c := range s.channels {
+		if len(c.waiters) > 0 && (!found || c.pass < min) {
+			min, found = c.pass, true
+		}
+	}
+	return min, found
+}
+
+func (s *Scheduler) channel(name string) *channelQueue {
+	c, ok := s.channels[name]
+	if !ok {
+		c = &channelQueue{weight: DefaultWeight}
+		s.channels[name] = c
+	}
+	return c
+}
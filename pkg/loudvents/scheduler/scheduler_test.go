@@ -0,0 +1,121 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type grant struct {
+	channel string
+	release func()
+}
+
+// waitFor waits until the number of deliveries waiting for a slot is n.
+func waitFor(t *testing.T, s *Scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		waiting := 0
+		for _, c := range s.channels {
+			waiting += len(c.waiters)
+		}
+		s.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Expected %d waiting deliveries", n)
+}
+
+func TestAcquireWeightedShare(t *testing.T) {
+	s := New(2)
+	s.SetWeight("a", 3)
+	s.SetWeight("b", 1)
+
+	var held []func()
+	for i := 0; i < 2; i++ {
+		release, err := s.Acquire(context.Background(), "other")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		held = append(held, release)
+	}
+
+	grants := make(chan grant)
+	for _, ch := range []string{"a", "b"} {
+		for i := 0; i < 8; i++ {
+			ch := ch
+			go func() {
+				release, err := s.Acquire(context.Background(), ch)
+				if err == nil {
+					grants <- grant{channel: ch, release: release}
+				}
+			}()
+		}
+	}
+	waitFor(t, s, 16)
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		held[0]()
+		held = held[1:]
+		g := <-grants
+		counts[g.channel]++
+		held = append(held, g.release)
+	}
+
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Errorf("Expected a 3:1 share of slots, got %v", counts)
+	}
+	if n := s.InFlight(); n != 2 {
+		t.Errorf("Expected 2 slots in use, got %d", n)
+	}
+}
+
+func TestAcquireNotSaturated(t *testing.T) {
+	s := New(2)
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Acquire(context.Background(), "a"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if n := s.InFlight(); n != 2 {
+		t.Errorf("Expected 2 slots in use, got %d", n)
+	}
+}
+
+func TestAcquireCanceled(t *testing.T) {
+	s := New(1)
+	release, err := s.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, "b"); err == nil {
+		t.Fatal("Expected an error waiting for a slot")
+	}
+
+	release()
+	if n := s.InFlight(); n != 0 {
+		t.Errorf("Expected no slots in use, got %d", n)
+	}
+}
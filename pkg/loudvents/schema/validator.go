@@ -0,0 +1,183 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schema validates CloudEvents data against JSON schemas keyed by
+// the CloudEvent type and dataschema attributes.
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Mode defines what happens to events that fail validation.
+type Mode string
+
+const (
+	// ModeEnforce rejects invalid events.
+	ModeEnforce Mode = "Enforce"
+	// ModeAudit reports invalid events and lets them through.
+	ModeAudit Mode = "Audit"
+)
+
+// Config for channel events validation.
+type Config struct {
+	Mode    Mode     `json:"mode"`
+	Schemas []Schema `json:"schemas"`
+	// InvalidEventsSink receives invalid events in Enforce mode. When nil
+	// invalid events are rejected.
+	InvalidEventsSink *url.URL `json:"invalidEventsSink,omitempty"`
+}
+
+// Schema is a JSON schema document for events matching its type and
+// dataschema. Empty Type or DataSchema match any value.
+type Schema struct {
+	Type       string `json:"type,omitempty"`
+	DataSchema string `json:"dataschema,omitempty"`
+	Document   string `json:"document"`
+}
+
+// ErrRemoteReference is returned for schemas referencing documents other
+// than themselves, which are not loaded.
+var ErrRemoteReference = errors.New("remote schema references are not supported")
+
+// ValidationError is returned for events whose data does not match its schema.
+type ValidationError struct {
+	Type       string
+	DataSchema string
+	Details    []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("event data does not match the schema for type %q and dataschema %q: %s",
+		e.Type, e.DataSchema, strings.Join(e.Details, "; "))
+}
+
+// Validate checks that the schemas compile, so that a wrong configuration
+// is refused up front.
+func (c *Config) Validate() error {
+	_, err := NewValidator(c.Schemas)
+	return err
+}
+
+type key struct {
+	typ        string
+	dataSchema string
+}
+
+// Validator validates events data against a set of compiled schemas.
+type Validator struct {
+	schemas map[key]*gojsonschema.Schema
+}
+
+// NewValidator compiles the schemas into a Validator.
+func NewValidator(schemas []Schema) (*Validator, error) {
+	v := &Validator{
+		schemas: make(map[key]*gojsonschema.Schema, len(schemas)),
+	}
+	for _, s := range schemas {
+		compiled, err := gojsonschema.NewSchema(localLoader{gojsonschema.NewStringLoader(s.Document)})
+		if err != nil {
+			return nil, fmt.Errorf("compiling schema for type %q and dataschema %q: %w", s.Type, s.DataSchema, err)
+		}
+		v.schemas[key{typ: s.Type, dataSchema: s.DataSchema}] = compiled
+	}
+	return v, nil
+}
+
+// localLoader loads a schema document without loading the documents it
+// references, which would be fetched from the network or the filesystem.
+type localLoader struct {
+	gojsonschema.JSONLoader
+}
+
+// LoaderFactory implements gojsonschema.JSONLoader.
+func (localLoader) LoaderFactory() gojsonschema.JSONLoaderFactory {
+	return remoteLoaderFactory{}
+}
+
+// remoteLoaderFactory creates the loaders of referenced documents, which
+// refuse to load them.
+type remoteLoaderFactory struct{}
+
+// New implements gojsonschema.JSONLoaderFactory.
+func (remoteLoaderFactory) New(source string) gojsonschema.JSONLoader {
+	return remoteLoader{gojsonschema.NewReferenceLoader(source)}
+}
+
+type remoteLoader struct {
+	gojsonschema.JSONLoader
+}
+
+// LoadJSON implements gojsonschema.JSONLoader.
+func (l remoteLoader) LoadJSON() (interface{}, error) {
+	return nil, fmt.Errorf("%w: %s", ErrRemoteReference, l.JsonSource())
+}
+
+// LoaderFactory implements gojsonschema.JSONLoader.
+func (remoteLoader) LoaderFactory() gojsonschema.JSONLoaderFactory {
+	return remoteLoaderFactory{}
+}
+
+// Validate checks the event data against the most specific schema for the
+// event. Events without a matching schema are considered valid.
+func (v *Validator) Validate(e *event.Event) error {
+	s := v.lookup(e.Type(), e.DataSchema())
+	if s == nil {
+		return nil
+	}
+
+	invalid := &ValidationError{
+		Type:       e.Type(),
+		DataSchema: e.DataSchema(),
+	}
+
+	if ct := e.DataMediaType(); ct != "" && ct != event.ApplicationJSON && !strings.HasSuffix(ct, "+json") {
+		invalid.Details = []string{fmt.Sprintf("data content type %q is not JSON", ct)}
+		return invalid
+	}
+
+	result, err := s.Validate(gojsonschema.NewBytesLoader(e.Data()))
+	if err != nil {
+		invalid.Details = []string{fmt.Sprintf("data is not valid JSON: %v", err)}
+		return invalid
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	for _, re := range result.Errors() {
+		invalid.Details = append(invalid.Details, re.String())
+	}
+	return invalid
+}
+
+// lookup returns the schema for the type and dataschema, trying exact matches first.
+func (v *Validator) lookup(typ, dataSchema string) *gojsonschema.Schema {
+	for _, k := range []key{
+		{typ: typ, dataSchema: dataSchema},
+		{typ: typ},
+		{dataSchema: dataSchema},
+		{},
+	} {
+		if s, ok := v.schemas[k]; ok {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["id"],
+	"properties": {"id": {"type": "string"}}
+}`
+
+func TestValidate(t *testing.T) {
+	v, err := NewValidator([]Schema{
+		{Type: "order.created", Document: orderSchema},
+		{Type: "order.created", DataSchema: "v2", Document: `{"type": "array"}`},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating validator: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		typ        string
+		dataSchema string
+		data       string
+		valid      bool
+	}{
+		{
+			name:  "Valid data",
+			typ:   "order.created",
+			data:  `{"id": "1234"}`,
+			valid: true,
+		},
+		{
+			name: "Missing required field",
+			typ:  "order.created",
+			data: `{"name": "1234"}`,
+		},
+		{
+			name: "Not JSON",
+			typ:  "order.created",
+			data: `id=1234`,
+		},
+		{
+			name:       "Most specific schema wins",
+			typ:        "order.created",
+			dataSchema: "v2",
+			data:       `{"id": "1234"}`,
+		},
+		{
+			name:  "No matching schema",
+			typ:   "order.deleted",
+			data:  `[]`,
+			valid: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := event.New()
+			e.SetType(tt.typ)
+			e.SetSource("test")
+			e.SetID("1")
+			if tt.dataSchema != "" {
+				e.SetDataSchema(tt.dataSchema)
+			}
+			e.DataEncoded = []byte(tt.data)
+			e.SetDataContentType(event.ApplicationJSON)
+
+			err := v.Validate(&e)
+			if tt.valid && err != nil {
+				t.Errorf("Expected valid event, got: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected invalid event")
+			}
+		})
+	}
+}
+
+func TestSchemaReferences(t *testing.T) {
+	var fetched bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+		_, _ = w.Write([]byte(orderSchema))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name     string
+		document string
+		remote   bool
+	}{
+		{
+			name:     "Local reference",
+			document: `{"definitions": {"id": {"type": "string"}}, "properties": {"id": {"$ref": "#/definitions/id"}}}`,
+		},
+		{
+			name:     "Remote reference",
+			document: `{"properties": {"order": {"$ref": "` + srv.URL + `/order.json"}}}`,
+			remote:   true,
+		},
+		{
+			name:     "File reference",
+			document: `{"properties": {"order": {"$ref": "file:///etc/passwd"}}}`,
+			remote:   true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Schemas: []Schema{{Type: "order.created", Document: tt.document}}}
+			err := cfg.Validate()
+			if tt.remote && !errors.Is(err, ErrRemoteReference) {
+				t.Errorf("Expected remote reference error, got: %v", err)
+			}
+			if !tt.remote && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	if fetched {
+		t.Error("Expected remote schema not to be fetched")
+	}
+}
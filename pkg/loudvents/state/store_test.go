@@ -0,0 +1,56 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+)
+
+type document struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestStore(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got document
+	if found, err := s.Load("ns/name", &got); err != nil || found {
+		t.Fatalf("Expected nothing stored, got found=%t err=%v", found, err)
+	}
+
+	want := document{Name: "a", Count: 2}
+	if err := s.Save("ns/name", want); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found, err := s.Load("ns/name", &got); err != nil || !found {
+		t.Fatalf("Expected the document to be stored, got found=%t err=%v", found, err)
+	}
+	if got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	if err := s.Delete("ns/name"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found, err := s.Load("ns/name", &got); err != nil || found {
+		t.Errorf("Expected the document to be deleted, got found=%t err=%v", found, err)
+	}
+	if err := s.Delete("ns/name"); err != nil {
+		t.Errorf("Deleting a missing document failed: %v", err)
+	}
+}
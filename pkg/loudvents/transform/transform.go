@@ -0,0 +1,308 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package transform modifies CloudEvents attributes and JSON payloads
+// before they are delivered to a subscriber.
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+// Operation names, shared by attribute and data operations.
+const (
+	OpSet    = "Set"
+	OpRemove = "Remove"
+	OpRename = "Rename"
+	OpDelete = "Delete"
+	OpMove   = "Move"
+)
+
+// Policy defines what happens to an event that cannot be transformed.
+type Policy string
+
+const (
+	// PolicySkip does not deliver the event.
+	PolicySkip Policy = "Skip"
+	// PolicyDeadLetter sends the original event to the dead letter sink.
+	PolicyDeadLetter Policy = "DeadLetter"
+	// PolicyDeliverOriginal delivers the original event.
+	PolicyDeliverOriginal Policy = "DeliverOriginal"
+)
+
+// Config for a transformation.
+type Config struct {
+	Attributes []AttributeOp `json:"attributes,omitempty"`
+	Data       []DataOp      `json:"data,omitempty"`
+	OnError    Policy        `json:"onError"`
+}
+
+// AttributeOp is an operation on a CloudEvent attribute or extension.
+type AttributeOp struct {
+	Op    string `json:"op"`
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+	To    string `json:"to,omitempty"`
+}
+
+// DataOp is an operation on a JSON payload field.
+type DataOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+	To    string          `json:"to,omitempty"`
+}
+
+// Validate checks that the operations are known and have the fields they
+// need, so that a wrong configuration is refused up front instead of failing
+// every event.
+func (c *Config) Validate() error {
+	for i, op := range c.Attributes {
+		switch op.Op {
+		case OpSet, OpRemove:
+		case OpRename:
+			if op.To == "" {
+				return fmt.Errorf("attribute operation %d: %s requires a target attribute", i, op.Op)
+			}
+		default:
+			return fmt.Errorf("attribute operation %d: unknown operation %q", i, op.Op)
+		}
+		if op.Name == "" {
+			return fmt.Errorf("attribute operation %d: %s requires an attribute name", i, op.Op)
+		}
+	}
+
+	for i, op := range c.Data {
+		switch op.Op {
+		case OpSet:
+			if !json.Valid(op.Value) {
+				return fmt.Errorf("data operation %d: %s value is not valid JSON", i, op.Op)
+			}
+		case OpDelete:
+		case OpMove:
+			if op.To == "" {
+				return fmt.Errorf("data operation %d: %s requires a target path", i, op.Op)
+			}
+		default:
+			return fmt.Errorf("data operation %d: unknown operation %q", i, op.Op)
+		}
+		if op.Path == "" {
+			return fmt.Errorf("data operation %d: %s requires a path", i, op.Op)
+		}
+	}
+	return nil
+}
+
+// Apply returns a transformed copy of the event. The original event is not modified.
+func Apply(e *event.Event, cfg *Config) (*event.Event, error) {
+	out := e.Clone()
+
+	for _, op := range cfg.Attributes {
+		if err := applyAttributeOp(&out, op); err != nil {
+			return nil, fmt.Errorf("attribute %s %q: %w", op.Op, op.Name, err)
+		}
+	}
+
+	if len(cfg.Data) == 0 {
+		return &out, nil
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(out.Data(), &data); err != nil {
+		return nil, fmt.Errorf("event data is not a JSON object: %w", err)
+	}
+	for _, op := range cfg.Data {
+		if err := applyDataOp(data, op); err != nil {
+			return nil, fmt.Errorf("data %s %q: %w", op.Op, op.Path, err)
+		}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("encoding event data: %w", err)
+	}
+	out.DataEncoded = b
+	out.DataBase64 = false
+
+	return &out, nil
+}
+
+func applyAttributeOp(e *event.Event, op AttributeOp) error {
+	switch op.Op {
+	case OpSet:
+		return setAttribute(e, op.Name, op.Value)
+	case OpRemove:
+		return removeAttribute(e, op.Name)
+	case OpRename:
+		value, ok := getAttribute(e, op.Name)
+		if !ok {
+			return nil
+		}
+		if err := removeAttribute(e, op.Name); err != nil {
+			return err
+		}
+		return setAttribute(e, op.To, value)
+	default:
+		return fmt.Errorf("unknown operation")
+	}
+}
+
+func getAttribute(e *event.Event, name string) (string, bool) {
+	switch strings.ToLower(name) {
+	case "id":
+		return e.ID(), true
+	case "source":
+		return e.Source(), true
+	case "type":
+		return e.Type(), true
+	case "subject":
+		return e.Subject(), e.Subject() != ""
+	case "dataschema":
+		return e.DataSchema(), e.DataSchema() != ""
+	case "datacontenttype":
+		return e.DataContentType(), e.DataContentType() != ""
+	case "time":
+		return types.Timestamp{Time: e.Time()}.String(), !e.Time().IsZero()
+	}
+
+	v, ok := e.Extensions()[name]
+	if !ok {
+		return "", false
+	}
+	s, err := types.ToString(v)
+	return s, err == nil
+}
+
+func setAttribute(e *event.Event, name, value string) error {
+	switch strings.ToLower(name) {
+	case "id":
+		e.SetID(value)
+	case "source":
+		e.SetSource(value)
+	case "type":
+		e.SetType(value)
+	case "subject":
+		e.SetSubject(value)
+	case "dataschema":
+		e.SetDataSchema(value)
+	case "datacontenttype":
+		e.SetDataContentType(value)
+	case "time":
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		e.SetTime(t)
+	case "specversion":
+		return fmt.Errorf("specversion cannot be modified")
+	default:
+		return e.Context.SetExtension(name, value)
+	}
+	return nil
+}
+
+func removeAttribute(e *event.Event, name string) error {
+	switch strings.ToLower(name) {
+	case "id", "source", "type", "specversion":
+		return fmt.Errorf("required attribute cannot be removed")
+	case "subject":
+		e.SetSubject("")
+	case "dataschema":
+		e.SetDataSchema("")
+	case "datacontenttype":
+		e.SetDataContentType("")
+	case "time":
+		e.SetTime(time.Time{})
+	default:
+		return e.Context.SetExtension(name, nil)
+	}
+	return nil
+}
+
+func applyDataOp(data map[string]interface{}, op DataOp) error {
+	switch op.Op {
+	case OpSet:
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return fmt.Errorf("value is not valid JSON: %w", err)
+		}
+		return setField(data, splitPath(op.Path), value)
+	case OpDelete:
+		return deleteField(data, splitPath(op.Path))
+	case OpMove:
+		path := splitPath(op.Path)
+		parent, err := walk(data, path[:len(path)-1], false)
+		if err != nil {
+			return err
+		}
+		value, ok := parent[path[len(path)-1]]
+		if !ok {
+			return fmt.Errorf("field does not exist")
+		}
+		delete(parent, path[len(path)-1])
+		return setField(data, splitPath(op.To), value)
+	default:
+		return fmt.Errorf("unknown operation")
+	}
+}
+
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
+
+func setField(data map[string]interface{}, path []string, value interface{}) error {
+	parent, err := walk(data, path[:len(path)-1], true)
+	if err != nil {
+		return err
+	}
+	parent[path[len(path)-1]] = value
+	return nil
+}
+
+func deleteField(data map[string]interface{}, path []string) error {
+	parent, err := walk(data, path[:len(path)-1], false)
+	if err != nil || parent == nil {
+		return err
+	}
+	delete(parent, path[len(path)-1])
+	return nil
+}
+
+// walk returns the object at path, optionally creating missing objects.
+// When not creating, a missing object returns nil without error.
+func walk(data map[string]interface{}, path []string, create bool) (map[string]interface{}, error) {
+	current := data
+	for i, key := range path {
+		next, ok := current[key]
+		if !ok {
+			if !create {
+				return nil, nil
+			}
+			obj := make(map[string]interface{})
+			current[key] = obj
+			current = obj
+			continue
+		}
+		obj, ok := next.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s is not an object", strings.Join(path[:i+1], "."))
+		}
+		current = obj
+	}
+	return current, nil
+}
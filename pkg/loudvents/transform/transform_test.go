@@ -0,0 +1,125 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newEvent(t *testing.T, data string) *event.Event {
+	e := event.New()
+	e.SetID("1")
+	e.SetType("user.created")
+	e.SetSource("test")
+	e.SetExtension("tenant", "acme")
+	if err := e.SetData(event.ApplicationJSON, json.RawMessage(data)); err != nil {
+		t.Fatalf("Unexpected error setting data: %v", err)
+	}
+	return &e
+}
+
+func TestApply(t *testing.T) {
+	e := newEvent(t, `{"user": {"name": "jane", "ssn": "123"}, "plan": "free"}`)
+
+	out, err := Apply(e, &Config{
+		Attributes: []AttributeOp{
+			{Op: OpSet, Name: "type", Value: "user.registered"},
+			{Op: OpRename, Name: "tenant", To: "org"},
+			{Op: OpSet, Name: "origin", Value: "loudvents"},
+		},
+		Data: []DataOp{
+			{Op: OpDelete, Path: "user.ssn"},
+			{Op: OpMove, Path: "plan", To: "account.plan"},
+			{Op: OpSet, Path: "account.active", Value: json.RawMessage(`true`)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if out.Type() != "user.registered" {
+		t.Errorf("Expected type to be set, got %q", out.Type())
+	}
+	wantExt := map[string]interface{}{"org": "acme", "origin": "loudvents"}
+	if diff := cmp.Diff(wantExt, out.Extensions()); diff != "" {
+		t.Errorf("Unexpected extensions (-want, +got): %s", diff)
+	}
+
+	var got, want interface{}
+	_ = json.Unmarshal(out.Data(), &got)
+	_ = json.Unmarshal([]byte(`{"user": {"name": "jane"}, "account": {"plan": "free", "active": true}}`), &want)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected data (-want, +got): %s", diff)
+	}
+
+	if e.Type() != "user.created" || e.Extensions()["tenant"] != "acme" {
+		t.Error("Original event was modified")
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	for name, cfg := range map[string]*Config{
+		"Remove required attribute": {Attributes: []AttributeOp{{Op: OpRemove, Name: "source"}}},
+		"Traverse non object":       {Data: []DataOp{{Op: OpSet, Path: "plan.tier", Value: json.RawMessage(`1`)}}},
+		"Move missing field":        {Data: []DataOp{{Op: OpMove, Path: "missing", To: "other"}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Apply(newEvent(t, `{"plan": "free"}`), cfg); err == nil {
+				t.Error("Expected transformation error")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := map[string]struct {
+		cfg     *Config
+		wantErr bool
+	}{
+		"valid operations": {
+			cfg: &Config{
+				Attributes: []AttributeOp{{Op: OpSet, Name: "type", Value: "t"}, {Op: OpRename, Name: "a", To: "b"}},
+				Data:       []DataOp{{Op: OpDelete, Path: "a"}, {Op: OpSet, Path: "b", Value: json.RawMessage(`1`)}},
+			},
+		},
+		"unknown attribute operation": {
+			cfg:     &Config{Attributes: []AttributeOp{{Op: "Upsert", Name: "type"}}},
+			wantErr: true,
+		},
+		"unknown data operation": {
+			cfg:     &Config{Data: []DataOp{{Op: OpRename, Path: "a", To: "b"}}},
+			wantErr: true,
+		},
+		"rename without target": {
+			cfg:     &Config{Attributes: []AttributeOp{{Op: OpRename, Name: "a"}}},
+			wantErr: true,
+		},
+		"set invalid JSON": {
+			cfg:     &Config{Data: []DataOp{{Op: OpSet, Path: "a", Value: json.RawMessage(`{`)}}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.cfg.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Expected error: %t, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook wraps plain HTTP requests into CloudEvents, so that
+// sources that cannot produce CloudEvents can send to a channel.
+package webhook
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	nethttp "net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultType is the type of wrapped events when not configured.
+	DefaultType = "io.triggermesh.loudvents.webhook"
+	// DefaultID generates a random ID for each wrapped event.
+	DefaultID = "{{ uuid }}"
+
+	// HeaderExtensionPrefix prefixes the extensions that keep request headers.
+	HeaderExtensionPrefix = "http"
+
+	// maxExtensionNameLength is the longest extension name recommended by the spec.
+	maxExtensionNameLength = 20
+)
+
+// skippedHeaders are not kept as extensions, either because they describe
+// the transport or because they might contain credentials.
+var skippedHeaders = map[string]struct{}{
+	"Authorization":       {},
+	"Connection":          {},
+	"Content-Length":      {},
+	"Content-Type":        {},
+	"Cookie":              {},
+	"Proxy-Authorization": {},
+	"Te":                  {},
+	"Trailer":             {},
+	"Transfer-Encoding":   {},
+	"Upgrade":             {},
+}
+
+// Config for wrapping requests. Type, Source and ID are Go templates that
+// can refer to the request path as {{ .Path }}, to its segments as
+// {{ index .Segments 0 }}, and to request headers as {{ header "X-Name" }}.
+// The uuid function returns a random UUID.
+type Config struct {
+	Type   string `json:"type"`
+	Source string `json:"source"`
+	ID     string `json:"id"`
+	// HeaderExtensions keeps the request headers as extensions, named after
+	// the header prefixed with HeaderExtensionPrefix.
+	HeaderExtensions bool `json:"headerExtensions,omitempty"`
+}
+
+// templateData is the data templates are executed with.
+type templateData struct {
+	Path     string
+	Segments []string
+}
+
+// Wrapper creates CloudEvents from plain requests.
+type Wrapper struct {
+	cfg    Config
+	typ    *template.Template
+	source *template.Template
+	id     *template.Template
+}
+
+// NewWrapper parses the configured templates.
+func NewWrapper(cfg Config) (*Wrapper, error) {
+	if cfg.Type == "" {
+		cfg.Type = DefaultType
+	}
+	if cfg.ID == "" {
+		cfg.ID = DefaultID
+	}
+	if cfg.Source == "" {
+		return nil, fmt.Errorf("webhook source is required")
+	}
+
+	w := &Wrapper{cfg: cfg}
+	var err error
+	if w.typ, err = parse("type", cfg.Type); err != nil {
+		return nil, err
+	}
+	if w.source, err = parse("source", cfg.Source); err != nil {
+		return nil, err
+	}
+	if w.id, err = parse("id", cfg.ID); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func parse(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(template.FuncMap{
+		// Placeholders, replaced with request bound functions on execution.
+		"header": func(string) string { return "" },
+		"uuid":   func() string { return "" },
+	}).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing webhook %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+// Wrap creates a CloudEvent with the request body as data.
+func (w *Wrapper) Wrap(r *nethttp.Request, body []byte) (*event.Event, error) {
+	data := templateData{
+		Path:     r.URL.Path,
+		Segments: strings.FieldsFunc(r.URL.Path, func(c rune) bool { return c == '/' }),
+	}
+	funcs := template.FuncMap{
+		"header": r.Header.Get,
+		"uuid":   func() string { return uuid.New().String() },
+	}
+
+	e := event.New()
+	for _, a := range []struct {
+		t   *template.Template
+		set func(string)
+	}{
+		{w.typ, e.SetType},
+		{w.source, e.SetSource},
+		{w.id, e.SetID},
+	} {
+		v, err := execute(a.t, funcs, data)
+		if err != nil {
+			return nil, err
+		}
+		a.set(v)
+	}
+	e.SetTime(time.Now())
+
+	if len(body) > 0 {
+		contentType := r.Header.Get("Content-Type")
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			contentType = "application/octet-stream"
+		}
+		if err := e.SetData(contentType, body); err != nil {
+			return nil, fmt.Errorf("setting event data: %w", err)
+		}
+	}
+
+	if w.cfg.HeaderExtensions {
+		for name, values := range r.Header {
+			if _, skip := skippedHeaders[name]; skip || len(values) == 0 {
+				continue
+			}
+			if ext := extensionName(name); ext != "" {
+				e.SetExtension(ext, strings.Join(values, ","))
+			}
+		}
+	}
+
+	if err := e.Validate(); err != nil {
+		return nil, fmt.Errorf("wrapped event is not valid: %w", err)
+	}
+	return &e, nil
+}
+
+func execute(t *template.Template, funcs template.FuncMap, data templateData) (string, error) {
+	var buf bytes.Buffer
+	if err := template.Must(t.Clone()).Funcs(funcs).Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing webhook %s template: %w", t.Name(), err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// extensionName returns the extension name for a header, which is the
+// prefixed header name lowercased, without non alphanumeric characters.
+// Names longer than the recommended maximum are truncated.
+func extensionName(header string) string {
+	var b strings.Builder
+	b.WriteString(HeaderExtensionPrefix)
+	for _, c := range strings.ToLower(header) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		}
+	}
+	name := b.String()
+	if name == HeaderExtensionPrefix {
+		return ""
+	}
+	if len(name) > maxExtensionNameLength {
+		name = name[:maxExtensionNameLength]
+	}
+	return name
+}
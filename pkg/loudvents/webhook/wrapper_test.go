@@ -0,0 +1,90 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	w, err := NewWrapper(Config{
+		Type:             `com.github.{{ header "X-GitHub-Event" }}`,
+		Source:           `https://github.com/{{ index .Segments 0 }}`,
+		ID:               `{{ or (header "X-GitHub-Delivery") uuid }}`,
+		HeaderExtensions: true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating wrapper: %v", err)
+	}
+
+	body := `{"action":"opened"}`
+	r := httptest.NewRequest("POST", "/acme/hooks", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-GitHub-Event", "pull_request")
+	r.Header.Set("X-GitHub-Delivery", "72d3162e")
+	r.Header.Set("Authorization", "secret")
+
+	e, err := w.Wrap(r, []byte(body))
+	if err != nil {
+		t.Fatalf("Unexpected error wrapping request: %v", err)
+	}
+
+	if e.Type() != "com.github.pull_request" {
+		t.Errorf("Unexpected type %q", e.Type())
+	}
+	if e.Source() != "https://github.com/acme" {
+		t.Errorf("Unexpected source %q", e.Source())
+	}
+	if e.ID() != "72d3162e" {
+		t.Errorf("Unexpected ID %q", e.ID())
+	}
+	if e.DataContentType() != "application/json" || string(e.Data()) != body {
+		t.Errorf("Unexpected data %s %q", e.DataContentType(), e.Data())
+	}
+
+	exts := e.Extensions()
+	if exts["httpxgithubevent"] != "pull_request" {
+		t.Errorf("Expected the event header to be kept as an extension, got %v", exts)
+	}
+	if _, ok := exts["httpauthorization"]; ok {
+		t.Error("Expected the authorization header not to be kept as an extension")
+	}
+}
+
+func TestWrapGeneratedID(t *testing.T) {
+	w, err := NewWrapper(Config{Source: "/webhook"})
+	if err != nil {
+		t.Fatalf("Unexpected error creating wrapper: %v", err)
+	}
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+	e, err := w.Wrap(r, []byte("hello"))
+	if err != nil {
+		t.Fatalf("Unexpected error wrapping request: %v", err)
+	}
+	if e.ID() == "" || e.Type() != DefaultType {
+		t.Errorf("Unexpected event attributes id=%q type=%q", e.ID(), e.Type())
+	}
+	if len(e.Extensions()) != 0 {
+		t.Errorf("Expected no header extensions, got %v", e.Extensions())
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	if _, err := NewWrapper(Config{Source: "{{ .Path"}); err == nil {
+		t.Error("Expected an error parsing an invalid template")
+	}
+}
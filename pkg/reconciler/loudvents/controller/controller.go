@@ -18,6 +18,7 @@ package controller
 
 import (
 	"context"
+	"net/http"
 
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
 	"knative.dev/pkg/logging"
@@ -45,6 +46,9 @@ const dispatcherName = "loudvents-dispatcher"
 
 type envConfig struct {
 	Image string `envconfig:"DISPATCHER_IMAGE" required:"true"`
+	// PortName is the name of the dispatcher service port probed for
+	// loaded channels.
+	PortName string `envconfig:"DISPATCHER_PORT_NAME" default:"http-dispatcher"`
 }
 
 // NewController initializes the controller and is called by the generated code.
@@ -69,6 +73,7 @@ func NewController(
 		endpointsLister:      endpointsInformer.Lister(),
 		serviceAccountLister: serviceAccountInformer.Lister(),
 		roleBindingLister:    roleBindingInformer.Lister(),
+		probeClient:          &http.Client{Timeout: probeTimeout},
 	}
 
 	env := &envConfig{}
@@ -81,6 +86,7 @@ func NewController(
 	}
 
 	r.dispatcherImage = env.Image
+	r.dispatcherPortName = env.PortName
 
 	impl := loudventschannelreconciler.NewImpl(ctx, r)
 	r.uriResolver = resolver.NewURIResolverFromTracker(ctx, impl.Tracker)
@@ -18,6 +18,8 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 
 	"k8s.io/client-go/kubernetes"
 
@@ -39,6 +41,7 @@ type Reconciler struct {
 
 	systemNamespace      string
 	dispatcherImage      string
+	dispatcherPortName   string
 	deploymentLister     appsv1listers.DeploymentLister
 	serviceLister        corev1listers.ServiceLister
 	endpointsLister      corev1listers.EndpointsLister
@@ -48,6 +51,9 @@ type Reconciler struct {
 	eventDispatcherConfigStore *config.EventDispatcherConfigStore
 
 	uriResolver *resolver.URIResolver
+
+	// probeClient is used to probe dispatcher pods for loaded channels.
+	probeClient *http.Client
 }
 
 // Check that our Reconciler implements Interface
@@ -68,5 +74,35 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, lvc *v1alpha1.LoudVentsC
 
 	// set dls
 
+	if err := r.reconcileInvalidEventsSink(ctx, lvc); err != nil {
+		return err
+	}
+
+	// check the dispatcher pods have loaded the channel
+	if err := r.reconcileDispatcherChannelLoaded(ctx, lvc); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// reconcileInvalidEventsSink resolves the validation invalid events sink URI.
+func (r *Reconciler) reconcileInvalidEventsSink(ctx context.Context, lvc *v1alpha1.LoudVentsChannel) error {
+	if lvc.Spec.Validation == nil || lvc.Spec.Validation.InvalidEventsSink == nil {
+		lvc.Status.InvalidEventsSinkURI = nil
+		return nil
+	}
+
+	dest := lvc.Spec.Validation.InvalidEventsSink.DeepCopy()
+	if dest.Ref != nil && dest.Ref.Namespace == "" {
+		dest.Ref.Namespace = lvc.Namespace
+	}
+
+	uri, err := r.uriResolver.URIFromDestinationV1(ctx, *dest, lvc)
+	if err != nil {
+		lvc.Status.InvalidEventsSinkURI = nil
+		return fmt.Errorf("resolving invalid events sink: %w", err)
+	}
+	lvc.Status.InvalidEventsSinkURI = uri
 	return nil
 }
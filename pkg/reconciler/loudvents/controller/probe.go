@@ -0,0 +1,109 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"knative.dev/pkg/controller"
+
+	v1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/probe"
+)
+
+const (
+	// probeTimeout bounds the probes sent to the dispatcher pods for a
+	// channel, which run in parallel.
+	probeTimeout = 2 * time.Second
+	// probeRequeuePeriod is the time after which channels that are not
+	// loaded by every dispatcher pod are probed again.
+	probeRequeuePeriod = 5 * time.Second
+)
+
+// reconcileDispatcherChannelLoaded probes the dispatcher pods behind the
+// dispatcher service, marking the channel loaded once all of them serve its
+// host name at the current generation. Pods that have not loaded the
+// generation yet leave the condition unknown, which only becomes false when
+// a pod serves the channel at another host or fails to load it.
+func (r *Reconciler) reconcileDispatcherChannelLoaded(ctx context.Context, lvc *v1alpha1.LoudVentsChannel) error {
+	if lvc.Status.Address == nil || lvc.Status.Address.URL == nil {
+		lvc.Status.MarkDispatcherChannelLoadedUnknown("ChannelNotAddressable", "The channel has no address yet")
+		return nil
+	}
+
+	eps, err := r.endpointsLister.Endpoints(r.systemNamespace).Get(dispatcherName)
+	if apierrs.IsNotFound(err) {
+		lvc.Status.MarkDispatcherChannelLoadedUnknown("DispatcherEndpointsNotFound", "Dispatcher endpoints %s/%s do not exist", r.systemNamespace, dispatcherName)
+		return nil
+	}
+	if err != nil {
+		lvc.Status.MarkDispatcherChannelLoadedUnknown("DispatcherEndpointsGetFailed", "Failed to get dispatcher endpoints: %v", err)
+		return err
+	}
+
+	addrs := probe.Addresses(eps, r.dispatcherPortName)
+	if len(addrs) == 0 {
+		lvc.Status.MarkDispatcherChannelLoadedUnknown("DispatcherEndpointsNotReady", "Dispatcher endpoints %s/%s have no ready addresses", r.systemNamespace, dispatcherName)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	results := probe.ProbeAll(ctx, r.probeClient, addrs, lvc.Namespace, lvc.Name)
+
+	// Pods that fail the channel mark it not loaded right away, while the
+	// first pod that has not loaded it yet leaves it unknown.
+	hostName := lvc.Status.Address.URL.Host
+	var reason, message string
+	for _, res := range results {
+		switch status := res.Status; {
+		case errors.Is(res.Err, probe.ErrNotLoaded):
+			if reason == "" {
+				reason, message = "DispatcherChannelNotLoaded", fmt.Sprintf("Dispatcher %s has not loaded the channel", res.Addr)
+			}
+		case res.Err != nil:
+			if reason == "" {
+				reason, message = "DispatcherProbeFailed", fmt.Sprintf("Failed to probe dispatcher %s: %v", res.Addr, res.Err)
+			}
+		case status.FailedGeneration == lvc.Generation:
+			lvc.Status.MarkDispatcherChannelNotLoaded("DispatcherChannelFailed", "Dispatcher %s failed to load generation %d of the channel: %s", res.Addr, status.FailedGeneration, status.Error)
+			return controller.NewRequeueAfter(probeRequeuePeriod)
+		case status.HostName == "":
+			if reason == "" {
+				reason, message = "DispatcherChannelNotLoaded", fmt.Sprintf("Dispatcher %s has not loaded the channel", res.Addr)
+			}
+		case status.HostName != hostName:
+			lvc.Status.MarkDispatcherChannelNotLoaded("DispatcherChannelHostMismatch", "Dispatcher %s serves the channel at %q, expected %q", res.Addr, status.HostName, hostName)
+			return controller.NewRequeueAfter(probeRequeuePeriod)
+		case status.Generation < lvc.Generation:
+			if reason == "" {
+				reason, message = "DispatcherChannelOutdated", fmt.Sprintf("Dispatcher %s has loaded generation %d of the channel, expected %d", res.Addr, status.Generation, lvc.Generation)
+			}
+		}
+	}
+	if reason != "" {
+		lvc.Status.MarkDispatcherChannelLoadedUnknown(reason, "%s", message)
+		return controller.NewRequeueAfter(probeRequeuePeriod)
+	}
+
+	lvc.Status.MarkDispatcherChannelLoaded()
+	return nil
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/controller"
+
+	v1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/probe"
+)
+
+const (
+	testNamespace = "ns"
+	testChannel   = "channel"
+	testHost      = "channel-kn-channel.ns.svc.cluster.local"
+)
+
+// newDispatcher returns the address of a dispatcher answering channel status
+// probes with the status, or as not loaded when nil.
+func newDispatcher(t *testing.T, status *probe.ChannelStatus) string {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != probe.Path(testNamespace, testChannel) || status == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			t.Errorf("Unexpected error encoding status: %v", err)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s.Listener.Addr().String()
+}
+
+// unreachableDispatcher returns the address of a dispatcher that is gone.
+func unreachableDispatcher() string {
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	return s.Listener.Addr().String()
+}
+
+// newEndpointsLister returns a lister with the dispatcher endpoints for the
+// addresses, when any.
+func newEndpointsLister(t *testing.T, addrs ...string) corev1listers.EndpointsLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	if addrs == nil {
+		return corev1listers.NewEndpointsLister(indexer)
+	}
+
+	eps := &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: "system", Name: dispatcherName}}
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			t.Fatalf("Unexpected error splitting address: %v", err)
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing port: %v", err)
+		}
+		eps.Subsets = append(eps.Subsets, corev1.EndpointSubset{
+			Addresses: []corev1.EndpointAddress{{IP: host}},
+			Ports: []corev1.EndpointPort{
+				{Name: "metrics", Port: 9090},
+				{Name: probe.DefaultPortName, Port: int32(p)},
+			},
+		})
+	}
+	if err := indexer.Add(eps); err != nil {
+		t.Fatalf("Unexpected error adding endpoints: %v", err)
+	}
+	return corev1listers.NewEndpointsLister(indexer)
+}
+
+func TestReconcileDispatcherChannelLoaded(t *testing.T) {
+	loaded := &probe.ChannelStatus{Namespace: testNamespace, Name: testChannel, HostName: testHost, Generation: 2}
+	outdated := &probe.ChannelStatus{Namespace: testNamespace, Name: testChannel, HostName: testHost, Generation: 1}
+	mismatch := &probe.ChannelStatus{Namespace: testNamespace, Name: testChannel, HostName: "other.ns.svc.cluster.local", Generation: 2}
+	failed := &probe.ChannelStatus{Namespace: testNamespace, Name: testChannel, HostName: testHost, Generation: 1, FailedGeneration: 2, Error: "invalid spec"}
+	staleFailure := &probe.ChannelStatus{Namespace: testNamespace, Name: testChannel, FailedGeneration: 1, Error: "invalid spec"}
+
+	testCases := map[string]struct {
+		dispatchers func(t *testing.T) []string
+		status      corev1.ConditionStatus
+		reason      string
+		requeue     bool
+	}{
+		"all loaded": {
+			dispatchers: func(t *testing.T) []string {
+				return []string{newDispatcher(t, loaded), newDispatcher(t, loaded)}
+			},
+			status: corev1.ConditionTrue,
+		},
+		"no endpoints": {
+			dispatchers: func(t *testing.T) []string { return nil },
+			status:      corev1.ConditionUnknown,
+			reason:      "DispatcherEndpointsNotFound",
+		},
+		"no ready addresses": {
+			dispatchers: func(t *testing.T) []string { return []string{} },
+			status:      corev1.ConditionUnknown,
+			reason:      "DispatcherEndpointsNotReady",
+		},
+		"not loaded": {
+			dispatchers: func(t *testing.T) []string {
+				return []string{newDispatcher(t, loaded), newDispatcher(t, nil)}
+			},
+			status:  corev1.ConditionUnknown,
+			reason:  "DispatcherChannelNotLoaded",
+			requeue: true,
+		},
+		"outdated": {
+			dispatchers: func(t *testing.T) []string {
+				return []string{newDispatcher(t, outdated), newDispatcher(t, loaded)}
+			},
+			status:  corev1.ConditionUnknown,
+			reason:  "DispatcherChannelOutdated",
+			requeue: true,
+		},
+		"stale failure": {
+			dispatchers: func(t *testing.T) []string {
+				return []string{newDispatcher(t, staleFailure)}
+			},
+			status:  corev1.ConditionUnknown,
+			reason:  "DispatcherChannelNotLoaded",
+			requeue: true,
+		},
+		"unreachable": {
+			dispatchers: func(t *testing.T) []string {
+				return []string{newDispatcher(t, loaded), unreachableDispatcher()}
+			},
+			status:  corev1.ConditionUnknown,
+			reason:  "DispatcherProbeFailed",
+			requeue: true,
+		},
+		"host mismatch": {
+			dispatchers: func(t *testing.T) []string {
+				return []string{newDispatcher(t, nil), newDispatcher(t, mismatch)}
+			},
+			status:  corev1.ConditionFalse,
+			reason:  "DispatcherChannelHostMismatch",
+			requeue: true,
+		},
+		"failed": {
+			dispatchers: func(t *testing.T) []string {
+				return []string{newDispatcher(t, outdated), newDispatcher(t, failed)}
+			},
+			status:  corev1.ConditionFalse,
+			reason:  "DispatcherChannelFailed",
+			requeue: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := &Reconciler{
+				systemNamespace:    "system",
+				dispatcherPortName: probe.DefaultPortName,
+				endpointsLister:    newEndpointsLister(t, tc.dispatchers(t)...),
+				probeClient:        &http.Client{},
+			}
+
+			lvc := &v1alpha1.LoudVentsChannel{ObjectMeta: metav1.ObjectMeta{
+				Namespace:  testNamespace,
+				Name:       testChannel,
+				Generation: 2,
+			}}
+			lvc.Status.InitializeConditions()
+			lvc.Status.SetAddress(apis.HTTP(testHost))
+
+			err := r.reconcileDispatcherChannelLoaded(context.Background(), lvc)
+			if requeue, _ := controller.IsRequeueKey(err); requeue != tc.requeue {
+				t.Errorf("Expected requeue %t, got error %v", tc.requeue, err)
+			}
+			if !tc.requeue && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			cond := lvc.Status.GetCondition(v1alpha1.LoudVentsChannelConditionDispatcherChannelLoaded)
+			if cond == nil {
+				t.Fatal("Expected dispatcher channel loaded condition")
+			}
+			if cond.Status != tc.status || cond.Reason != tc.reason {
+				t.Errorf("Expected condition %s/%q, got %s/%q: %s", tc.status, tc.reason, cond.Status, cond.Reason, cond.Message)
+			}
+		})
+	}
+}
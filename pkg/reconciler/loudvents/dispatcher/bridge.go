@@ -0,0 +1,69 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/tracker"
+
+	v1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/bridge"
+)
+
+// bridgesConfig resolves the addresses of the channels the channel bridges
+// to, tracking them so that address changes are reconciled. Bridges to
+// channels that do not exist or are not ready yet are left out.
+func (r *Reconciler) bridgesConfig(ctx context.Context, lvc *v1alpha1.LoudVentsChannel) ([]bridge.Config, error) {
+	if len(lvc.Spec.Bridges) == 0 {
+		return nil, nil
+	}
+
+	bridges := make([]bridge.Config, 0, len(lvc.Spec.Bridges))
+	for _, b := range lvc.Spec.Bridges {
+		ns := b.Channel.Namespace
+		if ns == "" {
+			ns = lvc.Namespace
+		}
+
+		if err := r.tracker.TrackReference(tracker.Reference{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "LoudVentsChannel",
+			Namespace:  ns,
+			Name:       b.Channel.Name,
+		}, lvc); err != nil {
+			return nil, fmt.Errorf("tracking LoudVentsChannel %s/%s: %w", ns, b.Channel.Name, err)
+		}
+
+		target, err := r.channelLister.LoudVentsChannels(ns).Get(b.Channel.Name)
+		if err != nil || target.Status.Address == nil || target.Status.Address.URL == nil {
+			logging.FromContext(ctx).Warnw("Bridge target channel is not available, skipping",
+				zap.String("bridge", ns+"/"+b.Channel.Name), zap.Error(err))
+			continue
+		}
+
+		bridges = append(bridges, bridge.Config{
+			Channel:  ns + "/" + b.Channel.Name,
+			HostName: target.Status.Address.URL.Host,
+			Filter:   b.Filter,
+		})
+	}
+	return bridges, nil
+}
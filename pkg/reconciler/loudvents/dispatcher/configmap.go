@@ -0,0 +1,56 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/tracker"
+
+	v1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
+)
+
+// configMapValue reads a ConfigMap key in the channel namespace, tracking
+// the ConfigMap so that changes are reconciled. A missing ConfigMap or key
+// is a permanent error, the channel is reconciled again once it is created.
+func (r *Reconciler) configMapValue(lvc *v1alpha1.LoudVentsChannel, ref *corev1.ConfigMapKeySelector) (string, error) {
+	if err := r.tracker.TrackReference(tracker.Reference{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Namespace:  lvc.Namespace,
+		Name:       ref.Name,
+	}, lvc); err != nil {
+		return "", fmt.Errorf("tracking ConfigMap %s/%s: %w", lvc.Namespace, ref.Name, err)
+	}
+
+	cm, err := r.configMapLister.ConfigMaps(lvc.Namespace).Get(ref.Name)
+	if apierrs.IsNotFound(err) {
+		return "", controller.NewPermanentError(fmt.Errorf("ConfigMap %s/%s not found", lvc.Namespace, ref.Name))
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting ConfigMap %s/%s: %w", lvc.Namespace, ref.Name, err)
+	}
+
+	value, ok := cm.Data[ref.Key]
+	if !ok {
+		return "", controller.NewPermanentError(fmt.Errorf("ConfigMap %s/%s has no key %q", lvc.Namespace, ref.Name, ref.Key))
+	}
+	return value, nil
+}
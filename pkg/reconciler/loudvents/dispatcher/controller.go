@@ -18,10 +18,13 @@ package dispatcher
 
 import (
 	"context"
+	"net/http"
 	"time"
 
 	"knative.dev/pkg/injection"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/client-go/tools/cache"
 
 	"github.com/google/uuid"
@@ -34,10 +37,13 @@ import (
 	"knative.dev/pkg/logging"
 
 	"go.uber.org/zap"
+	kubeconfigmapinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/configmap"
+	kubeendpointsinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/endpoints"
 	"knative.dev/pkg/configmap"
 	configmapinformer "knative.dev/pkg/configmap/informer"
 	"knative.dev/pkg/controller"
 	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/system"
 
 	"knative.dev/pkg/tracing"
 	tracingconfig "knative.dev/pkg/tracing/config"
@@ -45,10 +51,19 @@ import (
 	"knative.dev/eventing/pkg/apis/eventing"
 	"knative.dev/eventing/pkg/channel"
 
+	v1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
 	loudventsclient "github.com/odacremolbap/loudvents/pkg/client/generated/injection/client"
 	loudventschannelinformer "github.com/odacremolbap/loudvents/pkg/client/generated/injection/informers/messaging/v1alpha1/loudventschannel"
 	loudventschannelreconciler "github.com/odacremolbap/loudvents/pkg/client/generated/injection/reconciler/messaging/v1alpha1/loudventschannel"
 	"github.com/odacremolbap/loudvents/pkg/loudvents"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/budget"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/dlq"
+	lvfanout "github.com/odacremolbap/loudvents/pkg/loudvents/fanout"
+	lvmetrics "github.com/odacremolbap/loudvents/pkg/loudvents/metrics"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/probe"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/scheduler"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/state"
 )
 
 const (
@@ -63,10 +78,49 @@ type envConfig struct {
 	PodName       string `envconfig:"POD_NAME" required:"true"`
 	ContainerName string `envconfig:"CONTAINER_NAME" required:"true"`
 
+	// ServiceName is the dispatcher service, whose endpoints are the
+	// dispatcher replicas that subscriber readiness is aggregated from.
+	ServiceName string `envconfig:"SERVICE_NAME" default:"loudvents-dispatcher"`
+	// ServicePortName is the dispatcher service port replicas are probed at.
+	ServicePortName string `envconfig:"SERVICE_PORT_NAME" default:"http-dispatcher"`
+
 	// HTTP client conf used when dispatching events
 	MaxIdleConns int `envconfig:"MAX_IDLE_CONNS" required:"true"`
 	// MaxIdleConnsPerHost refers to the max idle connections per host, as in net/http/transport.
 	MaxIdleConnsPerHost int `envconfig:"MAX_IDLE_CONNS_PER_HOST" required:"true"`
+
+	// StateDir enables persistent mode, storing the dispatcher state under this directory.
+	StateDir string `envconfig:"STATE_DIR"`
+
+	// DeadLetterStoreDir enables the local dead letter store for events that
+	// cannot be delivered to subscribers without a dead letter sink.
+	DeadLetterStoreDir string `envconfig:"DEAD_LETTER_STORE_DIR"`
+	// DeadLetterStoreMaxEntries bounds the local dead letter store size.
+	DeadLetterStoreMaxEntries int `envconfig:"DEAD_LETTER_STORE_MAX_ENTRIES"`
+
+	// ArchiveDir enables archiving the events of channels that request it
+	// under this directory.
+	ArchiveDir string `envconfig:"ARCHIVE_DIR"`
+
+	// AdminPort enables the admin API at the given port, which also serves
+	// the dispatcher readiness check to clients other than the kubelet.
+	AdminPort int `envconfig:"ADMIN_PORT"`
+
+	// DebugPort enables the debug API, which exposes the dispatcher state,
+	// at the given port.
+	DebugPort int `envconfig:"DEBUG_PORT"`
+
+	// DispatchConcurrency bounds the deliveries in flight across all
+	// channels, which share it according to their scheduling weight.
+	// Deliveries are not bounded when not positive, which is the default.
+	DispatchConcurrency int `envconfig:"DISPATCH_CONCURRENCY" default:"0"`
+
+	// MemoryBudget bounds the bytes of event payloads held in memory while
+	// they are dispatched, as a Kubernetes quantity. Not bounded when empty.
+	MemoryBudget string `envconfig:"MEMORY_BUDGET"`
+	// MemoryBudgetWait is the time events wait for room at the memory budget
+	// before being refused.
+	MemoryBudgetWait time.Duration `envconfig:"MEMORY_BUDGET_WAIT" default:"1s"`
 }
 
 // NewController initializes the controller and is called by the generated code.
@@ -99,14 +153,68 @@ func NewController(
 		MaxIdleConnsPerHost: env.MaxIdleConnsPerHost,
 	})
 
-	reporter := channel.NewStatsReporter(env.ContainerName, kmeta.ChildName(env.PodName, uuid.New().String()))
+	uniqueName := kmeta.ChildName(env.PodName, uuid.New().String())
+	reporter := channel.NewStatsReporter(env.ContainerName, uniqueName)
+
+	handlerOptions := []lvfanout.Option{
+		lvfanout.WithStatsReporter(lvmetrics.NewStatsReporter(env.ContainerName, uniqueName)),
+	}
+	if env.StateDir != "" {
+		store, err := state.NewStore(env.StateDir)
+		if err != nil {
+			logger.Panicw("Failed to set up persistent mode", zap.Error(err))
+		}
+		handlerOptions = append(handlerOptions, lvfanout.WithStateStore(store))
+	}
+
+	if env.DispatchConcurrency > 0 {
+		handlerOptions = append(handlerOptions, lvfanout.WithScheduler(scheduler.New(env.DispatchConcurrency)))
+	}
+
+	if env.MemoryBudget != "" {
+		limit, err := resource.ParseQuantity(env.MemoryBudget)
+		if err != nil {
+			logger.Panicw("Failed to parse MEMORY_BUDGET", zap.Error(err))
+		}
+		globalBudget := budget.New("dispatcher", limit.Value(), nil)
+		handlerOptions = append(handlerOptions, lvfanout.WithMemoryBudget(globalBudget, env.MemoryBudgetWait))
+	}
+
+	if env.ArchiveDir != "" {
+		handlerOptions = append(handlerOptions, lvfanout.WithArchiveDir(env.ArchiveDir))
+	}
+
+	adminMux := http.NewServeMux()
+	if env.DeadLetterStoreDir != "" {
+		deadLetters, err := dlq.NewStore(env.DeadLetterStoreDir, env.DeadLetterStoreMaxEntries)
+		if err != nil {
+			logger.Panicw("Failed to set up the dead letter store", zap.Error(err))
+		}
+		handlerOptions = append(handlerOptions, lvfanout.WithDeadLetterStore(deadLetters))
+
+		dlqHandler := dlq.NewHandler(deadLetters, delivery.NewDispatcher(logger.Desugar()), logger.Desugar())
+		adminMux.Handle(dlq.PathPrefix, dlqHandler)
+		adminMux.Handle(dlq.PathPrefix+"/", dlqHandler)
+	}
 
 	sh := multichannelfanout.NewMessageHandler(ctx, logger.Desugar(), channel.NewMessageDispatcher(logger.Desugar()), reporter)
+	handlerOptions = append(handlerOptions, lvfanout.WithChannelHandlers(sh))
+
+	adminMux.Handle(replayPathPrefix, &replayHandler{
+		chLister:     loudventschannelinformer.Get(ctx).Lister(),
+		chMsgHandler: sh,
+	})
+
+	registry := newChannelRegistry()
 
 	readinessChecker := &DispatcherReadyChecker{
 		chLister:     loudventschannelinformer.Get(ctx).Lister(),
 		chMsgHandler: sh,
+		registry:     registry,
+		filter:       filterWithAnnotation(injection.HasNamespaceScope(ctx)),
 	}
+	adminMux.Handle(readinessPath, readinessCheckerHTTPHandler(readinessChecker))
+	adminMux.Handle(probe.PathPrefix, channelStatusHTTPHandler(registry))
 
 	args := &loudvents.LoudVentsMessageDispatcherArgs{
 		Port:         port,
@@ -116,21 +224,41 @@ func NewController(
 		Logger:       logger.Desugar(),
 
 		HTTPMessageReceiverOptions: []kncloudevents.HTTPMessageReceiverOption{
-			kncloudevents.WithChecker(readinessCheckerHTTPHandler(readinessChecker)),
+			kncloudevents.WithChecker(probeHTTPHandler(readinessChecker, registry)),
 		},
 	}
 	loudventsDispatcher := loudvents.NewMessageDispatcher(args)
 
 	loudventschannelInformer := loudventschannelinformer.Get(ctx)
+	configMapInformer := kubeconfigmapinformer.Get(ctx)
+	endpointsInformer := kubeendpointsinformer.Get(ctx)
+
+	serviceNamespace := injection.GetNamespaceScope(ctx)
+	if serviceNamespace == "" {
+		serviceNamespace = system.Namespace()
+	}
 
 	r := &Reconciler{
+		ctx:                        ctx,
 		multiChannelMessageHandler: sh,
 		reporter:                   reporter,
+		handlerOptions:             handlerOptions,
 		messagingClientSet:         loudventsclient.Get(ctx).MessagingV1alpha1(),
+		configMapLister:            configMapInformer.Lister(),
+		channelLister:              loudventschannelInformer.Lister(),
+		registry:                   registry,
+		replicas: &dispatcherReplicas{
+			endpointsLister: endpointsInformer.Lister(),
+			namespace:       serviceNamespace,
+			serviceName:     env.ServiceName,
+			portName:        env.ServicePortName,
+			client:          &http.Client{Timeout: replicaProbeTimeout},
+		},
 	}
 	impl := loudventschannelreconciler.NewImpl(ctx, r, func(impl *controller.Impl) controller.Options {
 		return controller.Options{SkipStatusUpdates: true, FinalizerName: finalizerName}
 	})
+	r.tracker = impl.Tracker
 
 	// Watch for loudvent channels.
 	loudventschannelInformer.Informer().AddEventHandler(
@@ -142,6 +270,36 @@ func NewController(
 				DeleteFunc: r.deleteFunc,
 			}})
 
+	// Watch for channels that other channels bridge to.
+	loudventschannelInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(r.tracker.OnChanged, v1alpha1.SchemeGroupVersion.WithKind("LoudVentsChannel")),
+	))
+
+	// Watch for ConfigMaps that contain schemas referenced by channels.
+	configMapInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(r.tracker.OnChanged, corev1.SchemeGroupVersion.WithKind("ConfigMap")),
+	))
+
+	// Aggregate the subscribers status of the loaded channels again when
+	// dispatcher replicas change.
+	endpointsInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: controller.FilterWithNameAndNamespace(serviceNamespace, env.ServiceName),
+		Handler:    r.replicasChangedHandler(impl.EnqueueKey),
+	})
+
+	if env.AdminPort != 0 {
+		go runAdminServer(ctx, env.AdminPort, adminMux, logger.Desugar())
+	}
+
+	if env.DebugPort != 0 {
+		debugMux := http.NewServeMux()
+		debugMux.Handle(debugChannelsPath, &debugHandler{
+			registry:     registry,
+			chMsgHandler: sh,
+		})
+		go runAdminServer(ctx, env.DebugPort, debugMux, logger.Desugar().Named("debug"))
+	}
+
 	// Start the dispatcher.
 	go func() {
 		err := loudventsDispatcher.Start(ctx)
@@ -0,0 +1,60 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"net/http"
+
+	"knative.dev/eventing/pkg/channel/multichannelfanout"
+
+	lvfanout "github.com/odacremolbap/loudvents/pkg/loudvents/fanout"
+)
+
+const debugChannelsPath = "/debug/channels"
+
+// debugChannel describes a registered channel and the state of its handler.
+type debugChannel struct {
+	registeredChannel
+	Handler *lvfanout.DebugInfo `json:"handler,omitempty"`
+}
+
+// debugHandler serves the dispatcher state for troubleshooting:
+//
+//	GET /debug/channels  list the registered channels and their handlers state
+type debugHandler struct {
+	registry     *channelRegistry
+	chMsgHandler multichannelfanout.MultiChannelMessageHandler
+}
+
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	registered := h.registry.list()
+	channels := make([]debugChannel, 0, len(registered))
+	for _, c := range registered {
+		dc := debugChannel{registeredChannel: c}
+		if handler, ok := h.chMsgHandler.GetChannelHandler(c.HostName).(*lvfanout.MessageHandler); ok {
+			info := handler.Debug()
+			dc.Handler = &info
+		}
+		channels = append(channels, dc)
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"channels": channels})
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"knative.dev/eventing/pkg/channel"
+	"knative.dev/eventing/pkg/channel/multichannelfanout"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	lvfanout "github.com/odacremolbap/loudvents/pkg/loudvents/fanout"
+)
+
+type nopReporter struct{}
+
+func (nopReporter) ReportEventCount(*channel.ReportArgs, int) error { return nil }
+func (nopReporter) ReportEventDispatchTime(*channel.ReportArgs, int, time.Duration) error {
+	return nil
+}
+
+func newMultiChannelHandler() *multichannelfanout.MessageHandler {
+	return multichannelfanout.NewMessageHandler(context.Background(), zap.NewNop(), channel.NewMessageDispatcher(zap.NewNop()), nopReporter{})
+}
+
+// newChannelHandler creates a fanout handler for the channel and registers
+// it at its host name.
+func newChannelHandler(t *testing.T, mh *multichannelfanout.MessageHandler, c registeredChannel) *lvfanout.MessageHandler {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	h, err := lvfanout.NewMessageHandler(ctx, zap.NewNop(), delivery.NewDispatcher(zap.NewNop()),
+		channel.ChannelReference{Namespace: c.Namespace, Name: c.Name}, lvfanout.Config{}, nopReporter{})
+	if err != nil {
+		t.Fatalf("Unexpected error creating the handler: %v", err)
+	}
+	mh.SetChannelHandler(c.HostName, h)
+	return h
+}
+
+func TestDebugHandler(t *testing.T) {
+	registered := registeredChannel{Namespace: "ns", Name: "registered", HostName: "registered.ns.svc.cluster.local", Generation: 1}
+	unhandled := registeredChannel{Namespace: "ns", Name: "unhandled", HostName: "unhandled.ns.svc.cluster.local", Generation: 2}
+
+	testCases := map[string]struct {
+		method      string
+		channels    []registeredChannel
+		handled     []registeredChannel
+		wantCode    int
+		wantHandler []bool
+	}{
+		"no channels": {
+			method:      http.MethodGet,
+			wantCode:    http.StatusOK,
+			wantHandler: []bool{},
+		},
+		"channels with and without handler": {
+			method:      http.MethodGet,
+			channels:    []registeredChannel{unhandled, registered},
+			handled:     []registeredChannel{registered},
+			wantCode:    http.StatusOK,
+			wantHandler: []bool{true, false},
+		},
+		"method not allowed": {
+			method:   http.MethodPost,
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			registry := newChannelRegistry()
+			for _, c := range tc.channels {
+				registry.set(c)
+			}
+			mh := newMultiChannelHandler()
+			for _, c := range tc.handled {
+				newChannelHandler(t, mh, c)
+			}
+
+			h := &debugHandler{registry: registry, chMsgHandler: mh}
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, httptest.NewRequest(tc.method, debugChannelsPath, nil))
+			if res.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d", tc.wantCode, res.Code)
+			}
+			if tc.wantHandler == nil {
+				return
+			}
+
+			var body struct {
+				Channels []debugChannel `json:"channels"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("Unexpected error decoding the response: %v", err)
+			}
+			if len(body.Channels) != len(tc.wantHandler) {
+				t.Fatalf("Expected %d channels, got %d", len(tc.wantHandler), len(body.Channels))
+			}
+			for i, c := range body.Channels {
+				if want := registry.list()[i]; c.registeredChannel.Name != want.Name || c.Generation != want.Generation {
+					t.Errorf("Expected channel %s/%s, got %s/%s", want.Namespace, want.Name, c.Namespace, c.Name)
+				}
+				if got := c.Handler != nil; got != tc.wantHandler[i] {
+					t.Errorf("Expected channel %s handler state: %t, got %t", c.Name, tc.wantHandler[i], got)
+				}
+			}
+		})
+	}
+}
@@ -19,36 +19,60 @@ package dispatcher
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"go.uber.org/zap"
 
 	"knative.dev/pkg/apis/duck"
+	"knative.dev/pkg/controller"
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/reconciler"
+	"knative.dev/pkg/tracker"
 
 	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
 	"knative.dev/eventing/pkg/channel"
-	"knative.dev/eventing/pkg/channel/fanout"
 	"knative.dev/eventing/pkg/channel/multichannelfanout"
 	"knative.dev/eventing/pkg/kncloudevents"
 
 	v1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
 	messagingv1alpha1 "github.com/odacremolbap/loudvents/pkg/client/generated/clientset/internalclientset/typed/messaging/v1alpha1"
 	reconcilerv1alpha1 "github.com/odacremolbap/loudvents/pkg/client/generated/injection/reconciler/messaging/v1alpha1/loudventschannel"
+	messaginglistersv1alpha1 "github.com/odacremolbap/loudvents/pkg/client/generated/listers/messaging/v1alpha1"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/archive"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/dedup"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delay"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	lvfanout "github.com/odacremolbap/loudvents/pkg/loudvents/fanout"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/priority"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/replay"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/scheduler"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/webhook"
 )
 
 // Reconciler reconciles LodVent Channels.
 type Reconciler struct {
+	// ctx bounds the lifetime of the channel handlers background work.
+	ctx context.Context
+
 	multiChannelMessageHandler multichannelfanout.MultiChannelMessageHandler
 	reporter                   channel.StatsReporter
+	handlerOptions             []lvfanout.Option
 	messagingClientSet         messagingv1alpha1.MessagingV1alpha1Interface
+	configMapLister            corev1listers.ConfigMapLister
+	channelLister              messaginglistersv1alpha1.LoudVentsChannelLister
+	tracker                    tracker.Interface
+	registry                   *channelRegistry
+	replicas                   *dispatcherReplicas
 }
 
 // Check the interfaces Reconciler should implement
@@ -58,6 +82,8 @@ var (
 )
 
 // ReconcileKind implements loudventchannel.Interface.
+// When leader election is enabled it only runs at the replica leading the
+// channel bucket, otherwise every replica runs it.
 func (r *Reconciler) ReconcileKind(ctx context.Context, lvc *v1alpha1.LoudVentsChannel) reconciler.Event {
 	if err := r.reconcile(ctx, lvc); err != nil {
 		return err
@@ -68,6 +94,7 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, lvc *v1alpha1.LoudVentsC
 }
 
 // ObserveKind implements loudventchannel.ReadOnlyInterface.
+// It runs at the replicas that do not lead the channel bucket.
 func (r *Reconciler) ObserveKind(ctx context.Context, lvc *v1alpha1.LoudVentsChannel) reconciler.Event {
 	return r.reconcile(ctx, lvc)
 }
@@ -75,57 +102,99 @@ func (r *Reconciler) ObserveKind(ctx context.Context, lvc *v1alpha1.LoudVentsCha
 func (r *Reconciler) reconcile(ctx context.Context, lvc *v1alpha1.LoudVentsChannel) reconciler.Event {
 	logging.FromContext(ctx).Infow("Reconciling", zap.Any("LoudVentChannel", lvc))
 
-	if !lvc.IsReady() {
+	if !lvc.IsReadyForDispatch() {
 		logging.FromContext(ctx).Debug("lvc is not ready, skipping")
 		return nil
 	}
 
-	config, err := newConfigForLoudVentChannel(lvc)
+	config, err := r.newConfigForLoudVentChannel(ctx, lvc)
 	if err != nil {
 		logging.FromContext(ctx).Error("Error creating config for loudvent channels", zap.Error(err))
+		if controller.IsPermanentError(err) {
+			r.registry.fail(lvc.Namespace, lvc.Name, lvc.Generation, err)
+		}
 		return err
 	}
 
 	// First grab the MultiChannelFanoutMessage handler
-	handler := r.multiChannelMessageHandler.GetChannelHandler(config.HostName)
-	if handler == nil {
+	handler, ok := r.multiChannelMessageHandler.GetChannelHandler(config.HostName).(*lvfanout.MessageHandler)
+	if !ok {
 		// No handler yet, create one.
-		fanoutHandler, err := fanout.NewFanoutMessageHandler(
+		fanoutHandler, err := lvfanout.NewMessageHandler(
+			r.ctx,
 			logging.FromContext(ctx).Desugar(),
-			channel.NewMessageDispatcher(logging.FromContext(ctx).Desugar()),
+			delivery.NewDispatcher(logging.FromContext(ctx).Desugar()),
+			channel.ChannelReference{Namespace: config.Namespace, Name: config.Name},
 			config.FanoutConfig,
 			r.reporter,
+			r.handlerOptions...,
 		)
 		if err != nil {
-			logging.FromContext(ctx).Error("Failed to create a new fanout.MessageHandler", err)
-			return err
+			logging.FromContext(ctx).Error("Failed to create a new fanout.MessageHandler", zap.Error(err))
+			r.registry.fail(lvc.Namespace, lvc.Name, lvc.Generation, err)
+			return controller.NewPermanentError(err)
 		}
 		r.multiChannelMessageHandler.SetChannelHandler(config.HostName, fanoutHandler)
 	} else {
 		// Just update the config if necessary.
-		haveSubs := handler.GetSubscriptions(ctx)
+		haveConfig := handler.GetConfig(ctx)
 
 		// Ignore the closures, we stash the values that we can tell from if the values have actually changed.
-		if diff := cmp.Diff(config.FanoutConfig.Subscriptions, haveSubs, cmpopts.IgnoreFields(kncloudevents.RetryConfig{}, "Backoff", "CheckRetry")); diff != "" {
+		if diff := cmp.Diff(config.FanoutConfig, haveConfig, cmpopts.IgnoreFields(kncloudevents.RetryConfig{}, "Backoff", "CheckRetry")); diff != "" {
 			logging.FromContext(ctx).Info("Updating fanout config: ", zap.String("Diff", diff))
-			handler.SetSubscriptions(ctx, config.FanoutConfig.Subscriptions)
+			if err := handler.SetConfig(ctx, config.FanoutConfig); err != nil {
+				logging.FromContext(ctx).Error("Failed to update fanout config", zap.Error(err))
+				r.registry.fail(lvc.Namespace, lvc.Name, lvc.Generation, err)
+				return controller.NewPermanentError(err)
+			}
 		}
 	}
 
+	r.registry.set(registeredChannel{
+		Namespace:    config.Namespace,
+		Name:         config.Name,
+		HostName:     config.HostName,
+		Generation:   lvc.Generation,
+		ReconciledAt: time.Now(),
+	})
 	return nil
 }
 
+// patchSubscriberStatus marks the subscribers ready once every dispatcher
+// replica has loaded the channel generation, requeueing the channel until
+// they do.
 func (r *Reconciler) patchSubscriberStatus(ctx context.Context, lvc *v1alpha1.LoudVentsChannel) error {
 	after := lvc.DeepCopy()
 
+	load := r.loadedReplicas(ctx, lvc)
+	ready, message := corev1.ConditionTrue, ""
+	if !load.done() {
+		ready = corev1.ConditionUnknown
+		message = fmt.Sprintf("Channel generation %d loaded by %d of %d dispatcher replicas",
+			lvc.Generation, load.loaded, load.total)
+	}
+
 	after.Status.Subscribers = make([]eventingduckv1.SubscriberStatus, 0)
 	for _, sub := range lvc.Spec.Subscribers {
 		after.Status.Subscribers = append(after.Status.Subscribers, eventingduckv1.SubscriberStatus{
 			UID:                sub.UID,
 			ObservedGeneration: sub.Generation,
-			Ready:              corev1.ConditionTrue,
+			Ready:              ready,
+			Message:            message,
 		})
 	}
+	if err := r.applySubscriberStatus(ctx, lvc, after); err != nil {
+		return err
+	}
+
+	if !load.done() && lvc.IsReadyForDispatch() {
+		return controller.NewRequeueAfter(replicaRequeuePeriod)
+	}
+	return nil
+}
+
+// applySubscriberStatus patches the channel status with the subscribers status.
+func (r *Reconciler) applySubscriberStatus(ctx context.Context, lvc, after *v1alpha1.LoudVentsChannel) error {
 	jsonPatch, err := duck.CreatePatch(lvc, after)
 	if err != nil {
 		return fmt.Errorf("creating JSON patch: %w", err)
@@ -148,29 +217,238 @@ func (r *Reconciler) patchSubscriberStatus(ctx context.Context, lvc *v1alpha1.Lo
 	return nil
 }
 
+// channelConfig is the configuration for a single loudvent channel handler.
+type channelConfig struct {
+	Namespace    string
+	Name         string
+	HostName     string
+	FanoutConfig lvfanout.Config
+}
+
 // newConfigForLoudVentChannel creates a new Config for a single loudvent channel.
-func newConfigForLoudVentChannel(lvc *v1alpha1.LoudVentsChannel) (*multichannelfanout.ChannelConfig, error) {
-	subs := make([]fanout.Subscription, len(lvc.Spec.Subscribers))
+func (r *Reconciler) newConfigForLoudVentChannel(ctx context.Context, lvc *v1alpha1.LoudVentsChannel) (*channelConfig, error) {
+	subs, err := r.subscriptionsConfig(lvc)
+	if err != nil {
+		return nil, err
+	}
 
-	for i, sub := range lvc.Spec.Subscribers {
-		conf, err := fanout.SubscriberSpecToFanoutConfig(sub)
-		if err != nil {
-			return nil, err
-		}
-		subs[i] = *conf
+	validation, err := r.validationConfig(lvc)
+	if err != nil {
+		return nil, err
 	}
 
-	return &multichannelfanout.ChannelConfig{
+	bridges, err := r.bridgesConfig(ctx, lvc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &channelConfig{
 		Namespace: lvc.Namespace,
 		Name:      lvc.Name,
 		HostName:  lvc.Status.Address.URL.Host,
-		FanoutConfig: fanout.Config{
-			AsyncHandler:  true,
-			Subscriptions: subs,
+		FanoutConfig: lvfanout.Config{
+			AsyncHandler:         true,
+			Subscriptions:        subs,
+			Dedup:                dedupConfig(lvc.Spec.Dedup),
+			Validation:           validation,
+			Webhook:              webhookConfig(lvc),
+			Delay:                delayConfig(lvc.Spec.Delay),
+			DeadLetterEnrichment: enrichmentConfig(lvc.Spec.DeadLetterEnrichment),
+			Replay:               replayConfig(lvc.Spec.Replay),
+			Archive:              archiveConfig(lvc.Spec.Archive),
+			Groups:               groupsConfig(lvc.Spec.Groups),
+			Hops:                 hopsConfig(lvc.Spec.Hops),
+			Bridges:              bridges,
+			Priority:             priorityConfig(lvc.Spec.Priority),
+			Weight:               schedulingWeight(ctx, lvc),
+			MemoryBudget:         memoryBudget(lvc.Spec.MemoryBudget),
 		},
 	}, nil
 }
 
+// dedupConfig converts the channel dedup spec into the dispatcher dedup configuration.
+func dedupConfig(spec *v1alpha1.DedupSpec) *dedup.Config {
+	if spec == nil {
+		return nil
+	}
+
+	cfg := &dedup.Config{}
+	if spec.Window != nil {
+		cfg.Window = spec.Window.Duration
+	}
+	if spec.Size != nil {
+		cfg.Size = int(*spec.Size)
+	}
+	return cfg
+}
+
+// delayConfig converts the channel delay spec into the dispatcher delay configuration.
+func delayConfig(spec *v1alpha1.DelaySpec) *delay.Config {
+	if spec == nil {
+		return nil
+	}
+
+	cfg := &delay.Config{
+		MaxDelay:   delay.DefaultMaxDelay,
+		MaxPending: delay.DefaultMaxPending,
+	}
+	if spec.MaxDelay != nil {
+		cfg.MaxDelay = spec.MaxDelay.Duration
+	}
+	if spec.MaxPending != nil {
+		cfg.MaxPending = int(*spec.MaxPending)
+	}
+	return cfg
+}
+
+// enrichmentConfig converts the channel dead letter enrichment spec into the
+// dispatcher enrichment configuration.
+func enrichmentConfig(spec *v1alpha1.DeadLetterEnrichmentSpec) *delivery.Enrichment {
+	if spec == nil {
+		return nil
+	}
+
+	cfg := &delivery.Enrichment{}
+	if spec.MaxDataLength != nil {
+		cfg.MaxDataLength = int(*spec.MaxDataLength)
+	}
+	return cfg
+}
+
+// replayConfig converts the channel replay spec into the dispatcher replay configuration.
+func replayConfig(spec *v1alpha1.ReplaySpec) *replay.Config {
+	if spec == nil {
+		return nil
+	}
+
+	cfg := &replay.Config{MaxBytes: replay.DefaultMaxBytes}
+	if spec.MaxEvents != nil {
+		cfg.MaxEvents = int(*spec.MaxEvents)
+	}
+	if spec.Retention != nil {
+		cfg.Retention = spec.Retention.Duration
+	}
+	if spec.MaxMemory != nil {
+		cfg.MaxBytes = spec.MaxMemory.Value()
+	}
+	return cfg
+}
+
+// webhookConfig converts the channel webhook spec into the dispatcher
+// webhook configuration. Wrapped events use the channel URI as their source
+// unless configured.
+func webhookConfig(lvc *v1alpha1.LoudVentsChannel) *webhook.Config {
+	spec := lvc.Spec.Webhook
+	if spec == nil {
+		return nil
+	}
+
+	cfg := &webhook.Config{
+		Type:             spec.Type,
+		Source:           spec.Source,
+		ID:               spec.ID,
+		HeaderExtensions: spec.HeaderExtensions,
+	}
+	if cfg.Type == "" {
+		cfg.Type = webhook.DefaultType
+	}
+	if cfg.Source == "" {
+		cfg.Source = lvc.Status.Address.URL.String()
+	}
+	if cfg.ID == "" {
+		cfg.ID = webhook.DefaultID
+	}
+	return cfg
+}
+
+// archiveConfig converts the channel archive spec into the dispatcher archive configuration.
+func archiveConfig(spec *v1alpha1.ArchiveSpec) *archive.Config {
+	if spec == nil {
+		return nil
+	}
+
+	cfg := &archive.Config{
+		MaxFileSize: archive.DefaultMaxFileSize,
+		MaxFileAge:  archive.DefaultMaxFileAge,
+	}
+	if spec.MaxFileSize != nil {
+		cfg.MaxFileSize = spec.MaxFileSize.Value()
+	}
+	if spec.MaxFileAge != nil {
+		cfg.MaxFileAge = spec.MaxFileAge.Duration
+	}
+	return cfg
+}
+
+// priorityConfig converts the channel priority spec into the dispatcher
+// priority lanes configuration.
+func priorityConfig(spec *v1alpha1.PrioritySpec) *priority.Config {
+	if spec == nil {
+		return nil
+	}
+
+	cfg := &priority.Config{
+		Lanes:       priority.DefaultLanes,
+		Concurrency: priority.DefaultConcurrency,
+	}
+	if spec.Lanes != nil {
+		cfg.Lanes = int(*spec.Lanes)
+	}
+	if cfg.Lanes > priority.MaxLanes {
+		cfg.Lanes = priority.MaxLanes
+	}
+	cfg.Weights = make([]int, cfg.Lanes)
+	for i := range cfg.Weights {
+		cfg.Weights[i] = 1 << i
+		if i < len(spec.Weights) && spec.Weights[i] > 0 {
+			cfg.Weights[i] = int(spec.Weights[i])
+		}
+	}
+	if spec.DefaultLane != nil && int(*spec.DefaultLane) < cfg.Lanes {
+		cfg.DefaultLane = int(*spec.DefaultLane)
+	}
+	if spec.Concurrency != nil {
+		cfg.Concurrency = int(*spec.Concurrency)
+	}
+	return cfg
+}
+
+// schedulingWeight returns the channel weight at the dispatcher scheduler.
+func schedulingWeight(ctx context.Context, lvc *v1alpha1.LoudVentsChannel) int {
+	v, ok := lvc.Annotations[v1alpha1.SchedulingWeightAnnotation]
+	if !ok {
+		return scheduler.DefaultWeight
+	}
+	weight, err := strconv.Atoi(v)
+	if err != nil || weight <= 0 {
+		logging.FromContext(ctx).Warnw("Invalid scheduling weight, using the default",
+			zap.String("annotation", v1alpha1.SchedulingWeightAnnotation), zap.String("value", v))
+		return scheduler.DefaultWeight
+	}
+	return weight
+}
+
+// memoryBudget returns the channel memory budget in bytes, zero when not bounded.
+func memoryBudget(q *resource.Quantity) int64 {
+	if q == nil {
+		return 0
+	}
+	return q.Value()
+}
+
+// hopsConfig converts the channel hops spec into the dispatcher hop limit.
+func hopsConfig(spec *v1alpha1.HopsSpec) *delivery.HopLimit {
+	cfg := &delivery.HopLimit{Max: delivery.DefaultMaxHops}
+	if spec == nil {
+		return cfg
+	}
+	if spec.Max != nil {
+		cfg.Max = int(*spec.Max)
+	}
+	cfg.DeadLetter = spec.OnExceeded == v1alpha1.HopsExceededPolicyDeadLetter
+	return cfg
+}
+
 func (r *Reconciler) deleteFunc(obj interface{}) {
 	if obj == nil {
 		return
@@ -185,7 +463,12 @@ func (r *Reconciler) deleteFunc(obj interface{}) {
 	}
 	if lvc.Status.Address != nil && lvc.Status.Address.URL != nil {
 		if hostName := lvc.Status.Address.URL.Host; hostName != "" {
+			if handler, ok := r.multiChannelMessageHandler.GetChannelHandler(hostName).(*lvfanout.MessageHandler); ok {
+				handler.Delete()
+			}
 			r.multiChannelMessageHandler.DeleteChannelHandler(hostName)
+			r.registry.delete(hostName)
 		}
 	}
+	r.registry.forget(lvc.Namespace, lvc.Name)
 }
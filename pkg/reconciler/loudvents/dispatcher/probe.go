@@ -0,0 +1,69 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/odacremolbap/loudvents/pkg/loudvents/probe"
+)
+
+// channelStatusHTTPHandler returns a http.Handler which answers the
+// controller probes for the status of channels loaded by the dispatcher,
+// including the generation of the channel the dispatcher failed to load.
+func channelStatusHTTPHandler(registry *channelRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		namespace, name, ok := probe.ParsePath(r.URL.Path)
+		if !ok {
+			writeAdminError(w, http.StatusNotFound, fmt.Errorf("expected path %s{namespace}/{name}", probe.PathPrefix))
+			return
+		}
+
+		c, loaded := registry.find(namespace, name)
+		f, failed := registry.failure(namespace, name)
+		if !loaded && !failed {
+			writeAdminError(w, http.StatusNotFound, fmt.Errorf("channel %s/%s is not loaded", namespace, name))
+			return
+		}
+		status := &probe.ChannelStatus{Namespace: namespace, Name: name}
+		if loaded {
+			status.HostName = c.HostName
+			status.Generation = c.Generation
+		}
+		if failed {
+			status.FailedGeneration = f.Generation
+			status.Error = f.Error
+		}
+		writeAdminJSON(w, http.StatusOK, status)
+	}
+}
+
+// probeHTTPHandler returns the handler for the probes the dispatcher
+// receiver gets, which are channel status probes from the controller when
+// sent to the channel status path and readiness probes otherwise.
+func probeHTTPHandler(c ReadinessChecker, registry *channelRegistry) http.HandlerFunc {
+	readiness := readinessCheckerHTTPHandler(c)
+	channelStatus := channelStatusHTTPHandler(registry)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := probe.ParsePath(r.URL.Path); ok {
+			channelStatus(w, r)
+			return
+		}
+		readiness(w, r)
+	}
+}
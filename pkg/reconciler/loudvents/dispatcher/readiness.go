@@ -20,22 +20,46 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
-	messagingv1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
-	messaginglistersv1alpha1 "github.com/odacremolbap/loudvents/pkg/client/generated/listers/messaging/v1alpha1"
 	"k8s.io/apimachinery/pkg/labels"
 	"knative.dev/eventing/pkg/channel/multichannelfanout"
+
+	messaginglistersv1alpha1 "github.com/odacremolbap/loudvents/pkg/client/generated/listers/messaging/v1alpha1"
 )
 
 const (
 	readinessProbeReady    = http.StatusNoContent
 	readinessProbeNotReady = http.StatusServiceUnavailable
 	readinessProbeError    = http.StatusInternalServerError
+
+	// readinessCachePeriod is the time a positive readiness result is reused
+	// before checking the channels again.
+	readinessCachePeriod = 10 * time.Second
+
+	// readinessPath serves the readiness check at the admin API, which is
+	// only served when ADMIN_PORT is set. Kubelet probes get the readiness
+	// check at any path of the receiver port.
+	readinessPath = "/readyz"
 )
 
 // ReadinessChecker can assert the readiness of a component.
 type ReadinessChecker interface {
 	IsReady() (bool, error)
+	// NotReady returns what kept the component from being ready at the
+	// last check.
+	NotReady() []NotReadyChannel
+}
+
+// NotReadyChannel is a ready channel the dispatcher is not serving yet.
+type NotReadyChannel struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	HostName  string `json:"hostName,omitempty"`
+	Reason    string `json:"reason"`
+	// Failed is set for channels that cannot be loaded until they change,
+	// which do not keep the dispatcher from being ready.
+	Failed bool `json:"failed,omitempty"`
 }
 
 // DispatcherReadyChecker asserts the readiness of a dispatcher for loudvent Channels.
@@ -43,24 +67,35 @@ type DispatcherReadyChecker struct {
 	// Allows listing observed Channels.
 	chLister messaginglistersv1alpha1.LoudVentsChannelLister
 
-	// Allows listing/counting the handlers which have already been registered.
+	// Allows looking up the handlers which have already been registered.
 	chMsgHandler multichannelfanout.MultiChannelMessageHandler
 
-	// Allows safe concurrent read/write of 'isReady'.
+	// Tells the channel generation each handler was configured for.
+	registry *channelRegistry
+
+	// Selects the channels this dispatcher serves.
+	filter func(obj interface{}) bool
+
+	// Allows safe concurrent read/write of the last check result.
 	sync.Mutex
 
-	// Minor perf tweak, bypass check if we already observed readiness once.
-	isReady bool
+	// Minor perf tweak, bypass the check if readiness was observed recently.
+	readyAt  time.Time
+	notReady []NotReadyChannel
 }
 
 // IsReady implements ReadinessChecker.
-// It checks whether the dispatcher has registered a handler for all observed loudvent Channels.
+// It checks whether the dispatcher has registered a handler for every
+// observed ready loudvent Channel, configured for the channel generation.
+// Channels whose generation failed to reconcile permanently are reported
+// without failing the check, since they would keep the dispatcher from
+// being ready until they change.
 func (c *DispatcherReadyChecker) IsReady() (bool, error) {
 	c.Lock()
 	defer c.Unlock()
 
-	// readiness already observed at an earlier point in time, short-circuit the check
-	if c.isReady {
+	// readiness observed recently, short-circuit the check
+	if !c.readyAt.IsZero() && time.Since(c.readyAt) < readinessCachePeriod {
 		return true, nil
 	}
 
@@ -69,28 +104,90 @@ func (c *DispatcherReadyChecker) IsReady() (bool, error) {
 		return false, fmt.Errorf("listing cached LoudVentsChannels: %w", err)
 	}
 
-	readyChannels := make([]*messagingv1alpha1.LoudVentsChannel, 0, len(channels))
+	ready := true
+	notReady := make([]NotReadyChannel, 0)
 	for _, channel := range channels {
-		if channel.IsReady() {
-			readyChannels = append(readyChannels, channel)
+		if !channel.IsReadyForDispatch() || (c.filter != nil && !c.filter(channel)) {
+			continue
+		}
+
+		nr := NotReadyChannel{Namespace: channel.Namespace, Name: channel.Name}
+		if channel.Status.Address == nil || channel.Status.Address.URL == nil {
+			nr.Reason = "channel has no address"
+			notReady = append(notReady, nr)
+			continue
+		}
+
+		nr.HostName = channel.Status.Address.URL.Host
+		registered, ok := c.registry.get(nr.HostName)
+		switch {
+		case c.chMsgHandler.GetChannelHandler(nr.HostName) == nil:
+			nr.Reason = "no handler registered"
+		case !ok || registered.Namespace != channel.Namespace || registered.Name != channel.Name:
+			nr.Reason = "handler registered for another channel"
+		case registered.Generation != channel.Generation:
+			nr.Reason = fmt.Sprintf("handler at generation %d, channel at generation %d",
+				registered.Generation, channel.Generation)
+		default:
+			continue
 		}
+		if failed, ok := c.registry.failure(channel.Namespace, channel.Name); ok && failed.Generation == channel.Generation {
+			nr.Reason = "reconcile failed: " + failed.Error
+			nr.Failed = true
+		}
+		ready = ready && nr.Failed
+		notReady = append(notReady, nr)
 	}
 
-	c.isReady = c.chMsgHandler.CountChannelHandlers() >= len(readyChannels)
-	return c.isReady, nil
+	c.notReady = notReady
+	c.readyAt = time.Time{}
+	if ready {
+		c.readyAt = time.Now()
+	}
+	return ready, nil
+}
+
+// NotReady implements ReadinessChecker.
+func (c *DispatcherReadyChecker) NotReady() []NotReadyChannel {
+	c.Lock()
+	defer c.Unlock()
+	return c.notReady
 }
 
 // readinessCheckerHTTPHandler returns a http.Handler which executes the given ReadinessChecker.
+// Requests with the verbose query parameter get the channels that are not
+// ready listed in the response.
 func readinessCheckerHTTPHandler(c ReadinessChecker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		isReady, err := c.IsReady()
+
+		code := readinessProbeNotReady
+		switch {
+		case err != nil:
+			code = readinessProbeError
+		case isReady:
+			code = readinessProbeReady
+		}
+
+		if _, verbose := r.URL.Query()["verbose"]; !verbose {
+			w.WriteHeader(code)
+			return
+		}
+
 		switch {
 		case err != nil:
-			w.WriteHeader(readinessProbeError)
+			writeAdminError(w, code, err)
 		case isReady:
-			w.WriteHeader(readinessProbeReady)
+			body := map[string]interface{}{"ready": true}
+			if notReady := c.NotReady(); len(notReady) > 0 {
+				body["notReady"] = notReady
+			}
+			writeAdminJSON(w, http.StatusOK, body)
 		default:
-			w.WriteHeader(readinessProbeNotReady)
+			writeAdminJSON(w, code, map[string]interface{}{
+				"ready":    false,
+				"notReady": c.NotReady(),
+			})
 		}
 	}
 }
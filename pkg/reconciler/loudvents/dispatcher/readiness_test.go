@@ -0,0 +1,398 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/controller"
+	logtesting "knative.dev/pkg/logging/testing"
+	"knative.dev/pkg/tracker"
+
+	"github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
+	messaginglistersv1alpha1 "github.com/odacremolbap/loudvents/pkg/client/generated/listers/messaging/v1alpha1"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/probe"
+)
+
+// newReadyChannel returns a channel ready for dispatch at the given host.
+func newReadyChannel(namespace, name, host string, generation int64) *v1alpha1.LoudVentsChannel {
+	lvc := &v1alpha1.LoudVentsChannel{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Generation: generation},
+	}
+	lvc.Status.ObservedGeneration = generation
+	lvc.Status.SetAddress(&apis.URL{Scheme: "http", Host: host})
+	for _, t := range []apis.ConditionType{
+		v1alpha1.LoudVentsChannelConditionDispatcherReady,
+		v1alpha1.LoudVentsChannelConditionServiceReady,
+		v1alpha1.LoudVentsChannelConditionEndpointsReady,
+		v1alpha1.LoudVentsChannelConditionChannelServiceReady,
+		v1alpha1.LoudVentsChannelConditionDeadLetterSinkResolved,
+	} {
+		lvc.Status.Conditions = append(lvc.Status.Conditions, apis.Condition{Type: t, Status: corev1.ConditionTrue})
+	}
+	return lvc
+}
+
+func newChannelLister(t *testing.T, channels ...*v1alpha1.LoudVentsChannel) messaginglistersv1alpha1.LoudVentsChannelLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, c := range channels {
+		if err := indexer.Add(c); err != nil {
+			t.Fatalf("Unexpected error adding channel: %v", err)
+		}
+	}
+	return messaginglistersv1alpha1.NewLoudVentsChannelLister(indexer)
+}
+
+func TestReadiness(t *testing.T) {
+	const host = "channel.ns.svc.cluster.local"
+
+	testCases := map[string]struct {
+		channel  *v1alpha1.LoudVentsChannel
+		handled  bool
+		loaded   *registeredChannel
+		failed   *failedChannel
+		want     bool
+		wantNot  []NotReadyChannel
+		wantCode int
+	}{
+		"channel not ready for dispatch": {
+			channel: func() *v1alpha1.LoudVentsChannel {
+				lvc := newReadyChannel("ns", "channel", host, 2)
+				lvc.Status.ObservedGeneration = 1
+				return lvc
+			}(),
+			want:     true,
+			wantNot:  []NotReadyChannel{},
+			wantCode: readinessProbeReady,
+		},
+		"channel loaded": {
+			channel:  newReadyChannel("ns", "channel", host, 1),
+			handled:  true,
+			loaded:   &registeredChannel{Namespace: "ns", Name: "channel", HostName: host, Generation: 1},
+			want:     true,
+			wantNot:  []NotReadyChannel{},
+			wantCode: readinessProbeReady,
+		},
+		"no handler": {
+			channel:  newReadyChannel("ns", "channel", host, 1),
+			want:     false,
+			wantNot:  []NotReadyChannel{{Namespace: "ns", Name: "channel", HostName: host, Reason: "no handler registered"}},
+			wantCode: readinessProbeNotReady,
+		},
+		"outdated handler": {
+			channel: newReadyChannel("ns", "channel", host, 2),
+			handled: true,
+			loaded:  &registeredChannel{Namespace: "ns", Name: "channel", HostName: host, Generation: 1},
+			want:    false,
+			wantNot: []NotReadyChannel{{Namespace: "ns", Name: "channel", HostName: host,
+				Reason: "handler at generation 1, channel at generation 2"}},
+			wantCode: readinessProbeNotReady,
+		},
+		"permanent reconcile failure": {
+			channel: newReadyChannel("ns", "channel", host, 2),
+			handled: true,
+			loaded:  &registeredChannel{Namespace: "ns", Name: "channel", HostName: host, Generation: 1},
+			failed:  &failedChannel{Generation: 2, Error: "invalid transform"},
+			want:    true,
+			wantNot: []NotReadyChannel{{Namespace: "ns", Name: "channel", HostName: host,
+				Reason: "reconcile failed: invalid transform", Failed: true}},
+			wantCode: readinessProbeReady,
+		},
+		"reconcile failure of a previous generation": {
+			channel: newReadyChannel("ns", "channel", host, 3),
+			handled: true,
+			loaded:  &registeredChannel{Namespace: "ns", Name: "channel", HostName: host, Generation: 1},
+			failed:  &failedChannel{Generation: 2, Error: "invalid transform"},
+			want:    false,
+			wantNot: []NotReadyChannel{{Namespace: "ns", Name: "channel", HostName: host,
+				Reason: "handler at generation 1, channel at generation 3"}},
+			wantCode: readinessProbeNotReady,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			registry := newChannelRegistry()
+			mh := newMultiChannelHandler()
+			if tc.handled {
+				newChannelHandler(t, mh, registeredChannel{Namespace: "ns", Name: "channel", HostName: host})
+			}
+			if tc.loaded != nil {
+				registry.set(*tc.loaded)
+			}
+			if tc.failed != nil {
+				registry.fail("ns", "channel", tc.failed.Generation, errors.New(tc.failed.Error))
+			}
+
+			checker := &DispatcherReadyChecker{
+				chLister:     newChannelLister(t, tc.channel),
+				chMsgHandler: mh,
+				registry:     registry,
+			}
+			ready, err := checker.IsReady()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ready != tc.want {
+				t.Errorf("Expected ready %t, got %t", tc.want, ready)
+			}
+			if diff := cmp.Diff(tc.wantNot, checker.NotReady()); diff != "" {
+				t.Errorf("Unexpected not ready channels (-want, +got):\n%s", diff)
+			}
+
+			res := httptest.NewRecorder()
+			// bypass the cached result
+			checker.readyAt = checker.readyAt.Add(-readinessCachePeriod)
+			readinessCheckerHTTPHandler(checker)(res, httptest.NewRequest(http.MethodGet, readinessPath, nil))
+			if res.Code != tc.wantCode {
+				t.Errorf("Expected status %d, got %d", tc.wantCode, res.Code)
+			}
+		})
+	}
+}
+
+func newConfigMapLister(t *testing.T, configMaps ...*corev1.ConfigMap) corev1listers.ConfigMapLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, cm := range configMaps {
+		if err := indexer.Add(cm); err != nil {
+			t.Fatalf("Unexpected error adding ConfigMap: %v", err)
+		}
+	}
+	return corev1listers.NewConfigMapLister(indexer)
+}
+
+func TestReadinessFailedChannel(t *testing.T) {
+	const (
+		healthyHost = "healthy.ns.svc.cluster.local"
+		brokenHost  = "broken.ns.svc.cluster.local"
+	)
+
+	// withSchema returns a validation spec with the schema.
+	withSchema := func(s v1alpha1.EventSchema) *v1alpha1.ValidationSpec {
+		return &v1alpha1.ValidationSpec{Schemas: []v1alpha1.EventSchema{s}}
+	}
+	inline := func(doc string) *runtime.RawExtension {
+		return &runtime.RawExtension{Raw: []byte(doc)}
+	}
+
+	testCases := map[string]struct {
+		// spec breaks the channel spec.
+		spec func(spec *v1alpha1.LoudVentsChannelSpec)
+		// loaded makes the dispatcher load a healthy generation of the
+		// channel before it breaks.
+		loaded bool
+	}{
+		"invalid schema": {
+			spec: func(spec *v1alpha1.LoudVentsChannelSpec) {
+				spec.Validation = withSchema(v1alpha1.EventSchema{Inline: inline(`{"type": 12}`)})
+			},
+		},
+		"missing schema ConfigMap": {
+			spec: func(spec *v1alpha1.LoudVentsChannelSpec) {
+				spec.Validation = withSchema(v1alpha1.EventSchema{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "schema.json"}})
+			},
+		},
+		"missing schema ConfigMap key": {
+			spec: func(spec *v1alpha1.LoudVentsChannelSpec) {
+				spec.Validation = withSchema(v1alpha1.EventSchema{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "schemas"}, Key: "missing.json"}})
+			},
+		},
+		"unresolved invalid events sink": {
+			spec: func(spec *v1alpha1.LoudVentsChannelSpec) {
+				spec.Validation = withSchema(v1alpha1.EventSchema{Inline: inline(`{"type": "object"}`)})
+				spec.Validation.InvalidEventsSink = &duckv1.Destination{URI: apis.HTTP("sink.ns.svc.cluster.local")}
+			},
+		},
+		"invalid webhook template": {
+			spec: func(spec *v1alpha1.LoudVentsChannelSpec) {
+				spec.Webhook = &v1alpha1.WebhookSpec{Source: "{{"}
+			},
+		},
+		"invalid webhook template update": {
+			spec: func(spec *v1alpha1.LoudVentsChannelSpec) {
+				spec.Webhook = &v1alpha1.WebhookSpec{Source: "{{"}
+			},
+			loaded: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(logtesting.TestContextWithLogger(t))
+			t.Cleanup(cancel)
+
+			r := &Reconciler{
+				ctx:                        ctx,
+				multiChannelMessageHandler: newMultiChannelHandler(),
+				reporter:                   nopReporter{},
+				configMapLister: newConfigMapLister(t, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "schemas"},
+					Data:       map[string]string{"schema.json": `{"type": "object"}`},
+				}),
+				tracker:  tracker.New(func(types.NamespacedName) {}, time.Minute),
+				registry: newChannelRegistry(),
+			}
+
+			healthy := newReadyChannel("ns", "healthy", healthyHost, 1)
+			if err := r.reconcile(ctx, healthy); err != nil {
+				t.Fatalf("Unexpected error reconciling the healthy channel: %v", err)
+			}
+
+			broken := newReadyChannel("ns", "broken", brokenHost, 1)
+			if tc.loaded {
+				if err := r.reconcile(ctx, broken); err != nil {
+					t.Fatalf("Unexpected error reconciling the channel: %v", err)
+				}
+				broken = newReadyChannel("ns", "broken", brokenHost, 2)
+			}
+			tc.spec(&broken.Spec)
+			if err := r.reconcile(ctx, broken); !controller.IsPermanentError(err) {
+				t.Fatalf("Expected a permanent error reconciling the broken channel, got %v", err)
+			}
+
+			checker := &DispatcherReadyChecker{
+				chLister:     newChannelLister(t, healthy, broken),
+				chMsgHandler: r.multiChannelMessageHandler,
+				registry:     r.registry,
+			}
+			ready, err := checker.IsReady()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !ready {
+				t.Errorf("Expected the broken channel not to keep the dispatcher from being ready, got %+v", checker.NotReady())
+			}
+
+			notReady := checker.NotReady()
+			if len(notReady) != 1 || notReady[0].Name != "broken" || !notReady[0].Failed {
+				t.Errorf("Expected the broken channel reported as failed, got %+v", notReady)
+			}
+		})
+	}
+}
+
+func TestChannelRegistry(t *testing.T) {
+	registry := newChannelRegistry()
+	b := registeredChannel{Namespace: "ns", Name: "b", HostName: "b.ns.svc.cluster.local", Generation: 1}
+	a := registeredChannel{Namespace: "ns", Name: "a", HostName: "a.ns.svc.cluster.local", Generation: 2}
+	registry.set(b)
+	registry.set(a)
+
+	if diff := cmp.Diff([]registeredChannel{a, b}, registry.list()); diff != "" {
+		t.Errorf("Unexpected channels (-want, +got):\n%s", diff)
+	}
+	if c, ok := registry.get(a.HostName); !ok || c != a {
+		t.Errorf("Expected channel %v at %s, got %v", a, a.HostName, c)
+	}
+	if c, ok := registry.find("ns", "b"); !ok || c != b {
+		t.Errorf("Expected to find channel %v, got %v", b, c)
+	}
+
+	registry.fail("ns", "a", 3, errors.New("invalid"))
+	if f, ok := registry.failure("ns", "a"); !ok || f.Generation != 3 {
+		t.Errorf("Expected the failure of generation 3 to be recorded, got %v", f)
+	}
+	a.Generation = 3
+	registry.set(a)
+	if _, ok := registry.failure("ns", "a"); ok {
+		t.Error("Expected loading the channel to clear its failure")
+	}
+
+	registry.fail("ns", "b", 2, errors.New("invalid"))
+	registry.delete(b.HostName)
+	if _, ok := registry.find("ns", "b"); ok {
+		t.Error("Expected the deleted channel not to be found")
+	}
+	if _, ok := registry.failure("ns", "b"); ok {
+		t.Error("Expected deleting the channel to clear its failure")
+	}
+}
+
+func TestProbeHTTPHandler(t *testing.T) {
+	const host = "channel.ns.svc.cluster.local"
+	registry := newChannelRegistry()
+	registry.set(registeredChannel{Namespace: "ns", Name: "channel", HostName: host, Generation: 1})
+	registry.fail("ns", "broken", 2, errors.New("invalid spec"))
+	mh := newMultiChannelHandler()
+	newChannelHandler(t, mh, registeredChannel{Namespace: "ns", Name: "channel", HostName: host})
+
+	checker := &DispatcherReadyChecker{
+		chLister:     newChannelLister(t, newReadyChannel("ns", "channel", host, 1)),
+		chMsgHandler: mh,
+		registry:     registry,
+	}
+	h := probeHTTPHandler(checker, registry)
+
+	testCases := map[string]struct {
+		path       string
+		wantCode   int
+		wantStatus *probe.ChannelStatus
+	}{
+		"readiness": {
+			path:     "/",
+			wantCode: readinessProbeReady,
+		},
+		"loaded channel status": {
+			path:       probe.Path("ns", "channel"),
+			wantCode:   http.StatusOK,
+			wantStatus: &probe.ChannelStatus{Namespace: "ns", Name: "channel", HostName: host, Generation: 1},
+		},
+		"failed channel status": {
+			path:       probe.Path("ns", "broken"),
+			wantCode:   http.StatusOK,
+			wantStatus: &probe.ChannelStatus{Namespace: "ns", Name: "broken", FailedGeneration: 2, Error: "invalid spec"},
+		},
+		"unknown channel status": {
+			path:     probe.Path("ns", "unknown"),
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			h(res, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if res.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d", tc.wantCode, res.Code)
+			}
+			if tc.wantStatus == nil {
+				return
+			}
+			status := &probe.ChannelStatus{}
+			if err := json.NewDecoder(res.Body).Decode(status); err != nil {
+				t.Fatalf("Unexpected error decoding the response: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantStatus, status); diff != "" {
+				t.Errorf("Unexpected channel status (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
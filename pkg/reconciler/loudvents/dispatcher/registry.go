@@ -0,0 +1,135 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// registeredChannel is a channel whose handler is registered at the dispatcher.
+type registeredChannel struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	HostName  string `json:"hostName"`
+	// Generation is the channel generation the handler was last reconciled to.
+	Generation   int64     `json:"generation"`
+	ReconciledAt time.Time `json:"reconciledAt"`
+}
+
+// failedChannel is a channel generation the dispatcher cannot load until
+// the channel changes.
+type failedChannel struct {
+	Generation int64  `json:"generation"`
+	Error      string `json:"error"`
+}
+
+// channelRegistry keeps track of the channels registered at the dispatcher,
+// which the multichannel fanout handler does not expose, and of the channels
+// whose reconcile failed permanently.
+type channelRegistry struct {
+	mu       sync.RWMutex
+	channels map[string]registeredChannel
+	// failed is indexed by channel namespace/name.
+	failed map[string]failedChannel
+}
+
+func newChannelRegistry() *channelRegistry {
+	return &channelRegistry{
+		channels: make(map[string]registeredChannel),
+		failed:   make(map[string]failedChannel),
+	}
+}
+
+// set records the channel registered at its host name.
+func (r *channelRegistry) set(c registeredChannel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.channels[c.HostName] = c
+	delete(r.failed, c.Namespace+"/"+c.Name)
+}
+
+// delete forgets the channel registered at the host name.
+func (r *channelRegistry) delete(hostName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.channels[hostName]; ok {
+		delete(r.failed, c.Namespace+"/"+c.Name)
+	}
+	delete(r.channels, hostName)
+}
+
+// fail records that the channel generation cannot be loaded.
+func (r *channelRegistry) fail(namespace, name string, generation int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed[namespace+"/"+name] = failedChannel{Generation: generation, Error: err.Error()}
+}
+
+// forget removes the failure recorded for the channel.
+func (r *channelRegistry) forget(namespace, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.failed, namespace+"/"+name)
+}
+
+// failure returns the failure recorded for the channel.
+func (r *channelRegistry) failure(namespace, name string) (failedChannel, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.failed[namespace+"/"+name]
+	return f, ok
+}
+
+// list returns the registered channels sorted by namespace and name.
+func (r *channelRegistry) list() []registeredChannel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	channels := make([]registeredChannel, 0, len(r.channels))
+	for _, c := range r.channels {
+		channels = append(channels, c)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].Namespace != channels[j].Namespace {
+			return channels[i].Namespace < channels[j].Namespace
+		}
+		return channels[i].Name < channels[j].Name
+	})
+	return channels
+}
+
+// get returns the channel registered at the host name.
+func (r *channelRegistry) get(hostName string) (registeredChannel, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.channels[hostName]
+	return c, ok
+}
+
+// find returns the channel registered with the namespace and name.
+func (r *channelRegistry) find(namespace, name string) (registeredChannel, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.channels {
+		if c.Namespace == namespace && c.Name == name {
+			return c, true
+		}
+	}
+	return registeredChannel{}, false
+}
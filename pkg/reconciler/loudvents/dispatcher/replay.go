@@ -0,0 +1,149 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/eventing/pkg/channel/multichannelfanout"
+
+	messaginglistersv1alpha1 "github.com/odacremolbap/loudvents/pkg/client/generated/listers/messaging/v1alpha1"
+	lvfanout "github.com/odacremolbap/loudvents/pkg/loudvents/fanout"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/replay"
+)
+
+const replayPathPrefix = "/replay/"
+
+// replayRequest selects the subscription and position events are replayed
+// from. The subscription is selected by its UID, or by its subscriber URI
+// when not set.
+type replayRequest struct {
+	Subscription types.UID `json:"subscription,omitempty"`
+	Subscriber   string    `json:"subscriber,omitempty"`
+	FromTime     time.Time `json:"fromTime,omitempty"`
+	FromSequence uint64    `json:"fromSequence,omitempty"`
+}
+
+// bufferedEvent describes an event kept for replays.
+type bufferedEvent struct {
+	Sequence uint64    `json:"sequence"`
+	Time     time.Time `json:"time"`
+	ID       string    `json:"id"`
+	Source   string    `json:"source"`
+	Type     string    `json:"type"`
+}
+
+// replayHandler serves the replay admin API:
+//
+//	GET  /replay/{namespace}/{name}  list the events buffered by the channel
+//	POST /replay/{namespace}/{name}  replay events to a subscription
+type replayHandler struct {
+	chLister     messaginglistersv1alpha1.LoudVentsChannelLister
+	chMsgHandler multichannelfanout.MultiChannelMessageHandler
+}
+
+func (h *replayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, replayPathPrefix), "/"), "/")
+	if len(parts) != 2 {
+		writeAdminError(w, http.StatusNotFound, errors.New("expected path /replay/{namespace}/{name}"))
+		return
+	}
+
+	handler, err := h.channelHandler(parts[0], parts[1])
+	if err != nil {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		records, err := handler.Buffered()
+		if err != nil {
+			writeAdminError(w, http.StatusConflict, err)
+			return
+		}
+		events := make([]bufferedEvent, 0, len(records))
+		for _, rec := range records {
+			events = append(events, bufferedEvent{
+				Sequence: rec.Sequence,
+				Time:     rec.Time,
+				ID:       rec.Event.ID(),
+				Source:   rec.Event.Source(),
+				Type:     rec.Event.Type(),
+			})
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"events": events})
+
+	case http.MethodPost:
+		req := &replayRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("decoding replay request: %w", err))
+			return
+		}
+		n, err := handler.Replay(r.Context(), req.Subscription, req.Subscriber, replay.Position{Time: req.FromTime, Sequence: req.FromSequence})
+		switch {
+		case errors.Is(err, lvfanout.ErrUnknownSubscriber):
+			writeAdminError(w, http.StatusNotFound, err)
+		case errors.Is(err, lvfanout.ErrAmbiguousSubscriber):
+			writeAdminError(w, http.StatusBadRequest, err)
+		case err != nil:
+			writeAdminError(w, http.StatusConflict, err)
+		default:
+			writeAdminJSON(w, http.StatusAccepted, map[string]int{"replaying": n})
+		}
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// channelHandler returns the fanout handler serving the channel.
+func (h *replayHandler) channelHandler(namespace, name string) (*lvfanout.MessageHandler, error) {
+	lvc, err := h.chLister.LoudVentsChannels(namespace).Get(name)
+	if apierrs.IsNotFound(err) {
+		return nil, fmt.Errorf("channel %s/%s not found", namespace, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lvc.Status.Address == nil || lvc.Status.Address.URL == nil {
+		return nil, fmt.Errorf("channel %s/%s has no address", namespace, name)
+	}
+
+	handler, ok := h.chMsgHandler.GetChannelHandler(lvc.Status.Address.URL.Host).(*lvfanout.MessageHandler)
+	if !ok {
+		return nil, fmt.Errorf("channel %s/%s is not served by this dispatcher", namespace, name)
+	}
+	return handler, nil
+}
+
+func writeAdminError(w http.ResponseWriter, code int, err error) {
+	writeAdminJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeAdminJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/cloudevents/sdk-go/v2/event"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	knfanout "knative.dev/eventing/pkg/channel/fanout"
+
+	lvfanout "github.com/odacremolbap/loudvents/pkg/loudvents/fanout"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/replay"
+)
+
+// sendEvent posts an event to the channel handler.
+func sendEvent(t *testing.T, h http.Handler, id string) {
+	e := event.New()
+	e.SetID(id)
+	e.SetType("test.type")
+	e.SetSource("test")
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	if err := cehttp.WriteRequest(context.Background(), binding.ToMessage(&e), req); err != nil {
+		t.Fatalf("Unexpected error writing the request: %v", err)
+	}
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202 sending event %s, got %d", id, res.Code)
+	}
+}
+
+func TestReplayHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	subscriber, _ := url.Parse(srv.URL)
+
+	replayed := registeredChannel{Namespace: "ns", Name: "replayed", HostName: "replayed.ns.svc.cluster.local"}
+	notReplayed := registeredChannel{Namespace: "ns", Name: "notreplayed", HostName: "notreplayed.ns.svc.cluster.local"}
+	unserved := registeredChannel{Namespace: "ns", Name: "unserved", HostName: "unserved.ns.svc.cluster.local"}
+
+	mh := newMultiChannelHandler()
+	h := newChannelHandler(t, mh, replayed)
+	newChannelHandler(t, mh, notReplayed)
+
+	sub := lvfanout.Subscription{Subscription: knfanout.Subscription{Subscriber: subscriber}}
+	first, second := sub, sub
+	first.UID, second.UID = "first", "second"
+	if err := h.SetConfig(context.Background(), lvfanout.Config{
+		Subscriptions: []lvfanout.Subscription{first, second},
+		Replay:        &replay.Config{MaxBytes: replay.DefaultMaxBytes},
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sendEvent(t, h, "1")
+	time.Sleep(10 * time.Millisecond)
+	afterFirst := time.Now()
+	sendEvent(t, h, "2")
+	sendEvent(t, h, "3")
+
+	rh := &replayHandler{
+		chLister: newChannelLister(t,
+			newReadyChannel(replayed.Namespace, replayed.Name, replayed.HostName, 1),
+			newReadyChannel(notReplayed.Namespace, notReplayed.Name, notReplayed.HostName, 1),
+			newReadyChannel(unserved.Namespace, unserved.Name, unserved.HostName, 1),
+		),
+		chMsgHandler: mh,
+	}
+
+	testCases := map[string]struct {
+		method        string
+		path          string
+		request       *replayRequest
+		wantCode      int
+		wantReplaying int
+		wantBuffered  int
+	}{
+		"list buffered events": {
+			method:       http.MethodGet,
+			path:         "/replay/ns/replayed",
+			wantCode:     http.StatusOK,
+			wantBuffered: 3,
+		},
+		"replay from sequence": {
+			method:        http.MethodPost,
+			path:          "/replay/ns/replayed",
+			request:       &replayRequest{Subscription: "first", FromSequence: 2},
+			wantCode:      http.StatusAccepted,
+			wantReplaying: 2,
+		},
+		"replay from time": {
+			method:        http.MethodPost,
+			path:          "/replay/ns/replayed",
+			request:       &replayRequest{Subscription: "second", FromTime: afterFirst},
+			wantCode:      http.StatusAccepted,
+			wantReplaying: 2,
+		},
+		"shared subscriber": {
+			method:   http.MethodPost,
+			path:     "/replay/ns/replayed",
+			request:  &replayRequest{Subscriber: subscriber.String()},
+			wantCode: http.StatusBadRequest,
+		},
+		"unknown subscription": {
+			method:   http.MethodPost,
+			path:     "/replay/ns/replayed",
+			request:  &replayRequest{Subscription: "unknown"},
+			wantCode: http.StatusNotFound,
+		},
+		"replay disabled": {
+			method:   http.MethodGet,
+			path:     "/replay/ns/notreplayed",
+			wantCode: http.StatusConflict,
+		},
+		"channel not served": {
+			method:   http.MethodGet,
+			path:     "/replay/ns/unserved",
+			wantCode: http.StatusNotFound,
+		},
+		"unknown channel": {
+			method:   http.MethodGet,
+			path:     "/replay/ns/unknown",
+			wantCode: http.StatusNotFound,
+		},
+		"invalid path": {
+			method:   http.MethodGet,
+			path:     "/replay/ns",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var body []byte
+			if tc.request != nil {
+				var err error
+				if body, err = json.Marshal(tc.request); err != nil {
+					t.Fatalf("Unexpected error encoding the request: %v", err)
+				}
+			}
+			res := httptest.NewRecorder()
+			rh.ServeHTTP(res, httptest.NewRequest(tc.method, tc.path, bytes.NewReader(body)))
+			if res.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantCode, res.Code, strings.TrimSpace(res.Body.String()))
+			}
+
+			switch res.Code {
+			case http.StatusOK:
+				var out struct {
+					Events []bufferedEvent `json:"events"`
+				}
+				if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+					t.Fatalf("Unexpected error decoding the response: %v", err)
+				}
+				if len(out.Events) != tc.wantBuffered {
+					t.Errorf("Expected %d buffered events, got %d", tc.wantBuffered, len(out.Events))
+				}
+			case http.StatusAccepted:
+				var out map[string]int
+				if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+					t.Fatalf("Unexpected error decoding the response: %v", err)
+				}
+				if out["replaying"] != tc.wantReplaying {
+					t.Errorf("Expected %d events replaying, got %d", tc.wantReplaying, out["replaying"])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/logging"
+
+	"go.uber.org/zap"
+
+	v1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/probe"
+)
+
+const (
+	// replicaProbeTimeout bounds the probes sent to the dispatcher replicas
+	// for a channel, which run in parallel.
+	replicaProbeTimeout = 2 * time.Second
+	// replicaRequeuePeriod is the time after which the subscribers status
+	// is aggregated again while some replicas have not loaded the channel.
+	replicaRequeuePeriod = 5 * time.Second
+)
+
+// dispatcherReplicas finds the replicas of the dispatcher through the
+// endpoints of its service, and probes them for the channels they loaded.
+type dispatcherReplicas struct {
+	endpointsLister corev1listers.EndpointsLister
+	namespace       string
+	serviceName     string
+	portName        string
+	client          *http.Client
+}
+
+// replicaLoad is the number of dispatcher replicas that have loaded the
+// channel generation.
+type replicaLoad struct {
+	loaded int
+	total  int
+}
+
+// done returns whether every replica has loaded the channel generation.
+func (l replicaLoad) done() bool {
+	return l.loaded == l.total
+}
+
+// loadedReplicas returns how many dispatcher replicas have loaded the current
+// generation of the channel. Only this replica is accounted for when the
+// replicas cannot be found.
+func (r *Reconciler) loadedReplicas(ctx context.Context, lvc *v1alpha1.LoudVentsChannel) replicaLoad {
+	addrs, err := r.replicas.addresses()
+	if err != nil || len(addrs) == 0 {
+		logging.FromContext(ctx).Debugw("Dispatcher replicas not found, using the local channel status", zap.Error(err))
+		load := replicaLoad{total: 1}
+		if c, ok := r.registry.find(lvc.Namespace, lvc.Name); ok && c.Generation >= lvc.Generation {
+			load.loaded = 1
+		}
+		return load
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, replicaProbeTimeout)
+	defer cancel()
+
+	load := replicaLoad{total: len(addrs)}
+	for _, res := range probe.ProbeAll(probeCtx, r.replicas.client, addrs, lvc.Namespace, lvc.Name) {
+		switch {
+		case errors.Is(res.Err, probe.ErrNotLoaded):
+		case res.Err != nil:
+			logging.FromContext(ctx).Warnw("Failed to probe dispatcher replica", zap.String("address", res.Addr), zap.Error(res.Err))
+		case res.Status.HostName != "" && res.Status.Generation >= lvc.Generation:
+			load.loaded++
+		}
+	}
+	return load
+}
+
+// addresses returns the host:port addresses of the ready dispatcher replicas.
+func (d *dispatcherReplicas) addresses() ([]string, error) {
+	if d == nil {
+		return nil, nil
+	}
+
+	eps, err := d.endpointsLister.Endpoints(d.namespace).Get(d.serviceName)
+	if apierrs.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return probe.Addresses(eps, d.portName), nil
+}
+
+// replicasChangedHandler returns the handler for the dispatcher endpoints,
+// which enqueues the channels loaded by this replica when the addresses of
+// the dispatcher replicas change, so that their subscribers status is
+// aggregated again.
+func (r *Reconciler) replicasChangedHandler(enqueue func(types.NamespacedName)) cache.ResourceEventHandler {
+	enqueueLoaded := func(interface{}) {
+		for _, c := range r.registry.list() {
+			enqueue(types.NamespacedName{Namespace: c.Namespace, Name: c.Name})
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueueLoaded,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldEps, ok := oldObj.(*corev1.Endpoints)
+			if !ok {
+				return
+			}
+			newEps, ok := newObj.(*corev1.Endpoints)
+			if !ok {
+				return
+			}
+			if reflect.DeepEqual(probe.Addresses(oldEps, r.replicas.portName), probe.Addresses(newEps, r.replicas.portName)) {
+				return
+			}
+			enqueueLoaded(newObj)
+		},
+		DeleteFunc: enqueueLoaded,
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	v1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/probe"
+)
+
+const testServiceName = "loudvents-dispatcher"
+
+// newReplica returns the address of a dispatcher replica answering channel
+// status probes from its registry.
+func newReplica(t *testing.T, registry *channelRegistry) string {
+	s := httptest.NewServer(channelStatusHTTPHandler(registry))
+	t.Cleanup(s.Close)
+	return s.Listener.Addr().String()
+}
+
+// unreachableReplica returns the address of a dispatcher replica that is gone.
+func unreachableReplica() string {
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	return s.Listener.Addr().String()
+}
+
+// newReplicaEndpoints returns the dispatcher service endpoints for the
+// replica addresses.
+func newReplicaEndpoints(t *testing.T, addrs ...string) *corev1.Endpoints {
+	eps := &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: "system", Name: testServiceName}}
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			t.Fatalf("Unexpected error splitting address: %v", err)
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing port: %v", err)
+		}
+		eps.Subsets = append(eps.Subsets, corev1.EndpointSubset{
+			Addresses: []corev1.EndpointAddress{{IP: host}},
+			Ports: []corev1.EndpointPort{
+				{Name: "http-metrics", Port: 9090},
+				{Name: probe.DefaultPortName, Port: int32(p)},
+			},
+		})
+	}
+	return eps
+}
+
+func newEndpointsLister(t *testing.T, endpoints ...*corev1.Endpoints) corev1listers.EndpointsLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, eps := range endpoints {
+		if err := indexer.Add(eps); err != nil {
+			t.Fatalf("Unexpected error adding endpoints: %v", err)
+		}
+	}
+	return corev1listers.NewEndpointsLister(indexer)
+}
+
+func TestLoadedReplicas(t *testing.T) {
+	const host = "channel.ns.svc.cluster.local"
+
+	// registryAt returns a replica registry that loaded the channel at the
+	// generation, or none when zero.
+	registryAt := func(generation int64) *channelRegistry {
+		registry := newChannelRegistry()
+		if generation != 0 {
+			registry.set(registeredChannel{Namespace: "ns", Name: "channel", HostName: host, Generation: generation})
+		}
+		return registry
+	}
+
+	testCases := map[string]struct {
+		// replicas returns the dispatcher endpoints, none when nil.
+		replicas func(t *testing.T) *corev1.Endpoints
+		local    *channelRegistry
+		want     replicaLoad
+	}{
+		"all loaded": {
+			replicas: func(t *testing.T) *corev1.Endpoints {
+				return newReplicaEndpoints(t, newReplica(t, registryAt(2)), newReplica(t, registryAt(3)))
+			},
+			want: replicaLoad{loaded: 2, total: 2},
+		},
+		"partial load": {
+			replicas: func(t *testing.T) *corev1.Endpoints {
+				return newReplicaEndpoints(t, newReplica(t, registryAt(2)), newReplica(t, registryAt(1)), newReplica(t, registryAt(0)))
+			},
+			want: replicaLoad{loaded: 1, total: 3},
+		},
+		"unreachable replica": {
+			replicas: func(t *testing.T) *corev1.Endpoints {
+				return newReplicaEndpoints(t, newReplica(t, registryAt(2)), unreachableReplica())
+			},
+			want: replicaLoad{loaded: 1, total: 2},
+		},
+		"failed replica": {
+			replicas: func(t *testing.T) *corev1.Endpoints {
+				registry := registryAt(0)
+				registry.fail("ns", "channel", 2, errors.New("invalid spec"))
+				return newReplicaEndpoints(t, newReplica(t, registryAt(2)), newReplica(t, registry))
+			},
+			want: replicaLoad{loaded: 1, total: 2},
+		},
+		"no endpoints, loaded locally": {
+			local: registryAt(2),
+			want:  replicaLoad{loaded: 1, total: 1},
+		},
+		"no endpoints, outdated locally": {
+			local: registryAt(1),
+			want:  replicaLoad{loaded: 0, total: 1},
+		},
+		"no ready replicas": {
+			replicas: func(t *testing.T) *corev1.Endpoints {
+				return newReplicaEndpoints(t)
+			},
+			local: registryAt(2),
+			want:  replicaLoad{loaded: 1, total: 1},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var endpoints []*corev1.Endpoints
+			if tc.replicas != nil {
+				endpoints = append(endpoints, tc.replicas(t))
+			}
+			local := tc.local
+			if local == nil {
+				local = newChannelRegistry()
+			}
+
+			r := &Reconciler{
+				registry: local,
+				replicas: &dispatcherReplicas{
+					endpointsLister: newEndpointsLister(t, endpoints...),
+					namespace:       "system",
+					serviceName:     testServiceName,
+					portName:        probe.DefaultPortName,
+					client:          &http.Client{},
+				},
+			}
+
+			lvc := &v1alpha1.LoudVentsChannel{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "channel", Generation: 2}}
+			if got := r.loadedReplicas(context.Background(), lvc); got != tc.want {
+				t.Errorf("Expected %+v loaded replicas, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestReplicasChangedHandler(t *testing.T) {
+	registry := newChannelRegistry()
+	registry.set(registeredChannel{Namespace: "ns", Name: "a", HostName: "a.ns.svc.cluster.local"})
+	registry.set(registeredChannel{Namespace: "ns", Name: "b", HostName: "b.ns.svc.cluster.local"})
+	r := &Reconciler{
+		registry: registry,
+		replicas: &dispatcherReplicas{portName: probe.DefaultPortName},
+	}
+
+	var enqueued []types.NamespacedName
+	h := r.replicasChangedHandler(func(key types.NamespacedName) {
+		enqueued = append(enqueued, key)
+	})
+
+	eps := newReplicaEndpoints(t, "10.0.0.1:8080")
+	updated := eps.DeepCopy()
+	updated.ResourceVersion = "2"
+
+	h.OnUpdate(eps, updated)
+	if len(enqueued) != 0 {
+		t.Errorf("Expected no channels enqueued when the replicas did not change, got %v", enqueued)
+	}
+
+	scaled := newReplicaEndpoints(t, "10.0.0.1:8080", "10.0.0.2:8080")
+	h.OnUpdate(eps, scaled)
+	want := []types.NamespacedName{{Namespace: "ns", Name: "a"}, {Namespace: "ns", Name: "b"}}
+	if diff := cmp.Diff(want, enqueued); diff != "" {
+		t.Errorf("Unexpected enqueued channels (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	"knative.dev/eventing/pkg/channel/fanout"
+	"knative.dev/pkg/controller"
+	"sigs.k8s.io/yaml"
+
+	v1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/batch"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/compression"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/delivery"
+	lvfanout "github.com/odacremolbap/loudvents/pkg/loudvents/fanout"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/group"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/replay"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/transform"
+)
+
+// subscriptionsConfig creates the fanout subscriptions for the channel
+// subscribers, along with their loudvents delivery options.
+func (r *Reconciler) subscriptionsConfig(lvc *v1alpha1.LoudVentsChannel) ([]lvfanout.Subscription, error) {
+	subs := make([]lvfanout.Subscription, len(lvc.Spec.Subscribers))
+
+	for i, sub := range lvc.Spec.Subscribers {
+		conf, err := fanout.SubscriberSpecToFanoutConfig(sub)
+		if err != nil {
+			return nil, err
+		}
+		subs[i] = lvfanout.Subscription{Subscription: *conf, UID: sub.UID}
+
+		ttl, onExpired := lvc.Spec.TTL, lvc.Spec.OnExpired
+		opts, err := subscriberOptions(lvc, sub)
+		if err != nil {
+			return nil, err
+		}
+		if opts != nil {
+			if opts.TTL != nil {
+				ttl = opts.TTL
+			}
+			if opts.OnExpired != "" {
+				onExpired = opts.OnExpired
+			}
+		}
+		if ttl != nil {
+			subs[i].TTL = ttl.Duration
+		}
+		subs[i].DeadLetterExpired = onExpired == v1alpha1.ExpiredPolicyDeadLetter
+
+		if opts == nil {
+			continue
+		}
+		subs[i].Group = opts.Group
+		subs[i].ReplayFrom = replayPosition(opts.ReplayFrom)
+		subs[i].Batch = batchConfig(opts.Batch)
+		subs[i].ContentMode = contentMode(opts.ContentMode)
+		subs[i].ReplyContentMode = contentMode(opts.ReplyContentMode)
+		subs[i].DeadLetterContentMode = contentMode(opts.DeadLetterContentMode)
+		subs[i].Compression = compressionConfig(opts.Compression)
+
+		if opts.Transform != nil {
+			if subs[i].Transform, err = r.transformConfig(lvc, opts.Transform); err != nil {
+				return nil, fmt.Errorf("transformation for subscriber %s: %w", sub.SubscriberURI, err)
+			}
+		}
+	}
+
+	return subs, nil
+}
+
+// subscriberOptions returns the options for the subscriber, if any. Options
+// for the subscription UID take precedence over those for the subscriber
+// URI. More than one match is refused, since it is not clear which applies.
+func subscriberOptions(lvc *v1alpha1.LoudVentsChannel, sub eventingduckv1.SubscriberSpec) (*v1alpha1.SubscriberOptions, error) {
+	var byUID, byURI []*v1alpha1.SubscriberOptions
+	for i := range lvc.Spec.SubscriberOptions {
+		opts := &lvc.Spec.SubscriberOptions[i]
+		switch {
+		case opts.SubscriptionUID != "":
+			if opts.SubscriptionUID == sub.UID {
+				byUID = append(byUID, opts)
+			}
+		case opts.SubscriberURI != nil && sub.SubscriberURI != nil:
+			if opts.SubscriberURI.String() == sub.SubscriberURI.String() {
+				byURI = append(byURI, opts)
+			}
+		}
+	}
+
+	switch {
+	case len(byUID) > 1:
+		return nil, controller.NewPermanentError(fmt.Errorf("several subscriber options for subscription %s", sub.UID))
+	case len(byUID) == 1:
+		return byUID[0], nil
+	case len(byURI) > 1:
+		return nil, controller.NewPermanentError(fmt.Errorf("several subscriber options for subscriber %s, use the subscription UID to tell them apart", sub.SubscriberURI))
+	case len(byURI) == 1:
+		return byURI[0], nil
+	}
+	return nil, nil
+}
+
+// transformConfig converts the transform spec into the dispatcher
+// transformation, reading the rules from a ConfigMap when referenced.
+func (r *Reconciler) transformConfig(lvc *v1alpha1.LoudVentsChannel, spec *v1alpha1.TransformSpec) (*transform.Config, error) {
+	rules := spec.TransformRules
+	if spec.ConfigMapKeyRef != nil {
+		doc, err := r.configMapValue(lvc, spec.ConfigMapKeyRef)
+		if err != nil {
+			return nil, err
+		}
+		rules = v1alpha1.TransformRules{}
+		if err := yaml.Unmarshal([]byte(doc), &rules); err != nil {
+			return nil, controller.NewPermanentError(fmt.Errorf("parsing rules from ConfigMap %s/%s: %w", lvc.Namespace, spec.ConfigMapKeyRef.Name, err))
+		}
+	}
+
+	cfg := &transform.Config{
+		Attributes: make([]transform.AttributeOp, 0, len(rules.Attributes)),
+		Data:       make([]transform.DataOp, 0, len(rules.Data)),
+		OnError:    transform.PolicyDeadLetter,
+	}
+	if spec.OnError != "" {
+		cfg.OnError = transform.Policy(spec.OnError)
+	}
+
+	for _, op := range rules.Attributes {
+		cfg.Attributes = append(cfg.Attributes, transform.AttributeOp{
+			Op:    string(op.Operation),
+			Name:  op.Name,
+			Value: op.Value,
+			To:    op.To,
+		})
+	}
+	for _, op := range rules.Data {
+		dataOp := transform.DataOp{
+			Op:   string(op.Operation),
+			Path: op.Path,
+			To:   op.To,
+		}
+		if op.Value != nil {
+			dataOp.Value = json.RawMessage(op.Value.Raw)
+		}
+		cfg.Data = append(cfg.Data, dataOp)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, controller.NewPermanentError(err)
+	}
+	return cfg, nil
+}
+
+// replayPosition converts the subscriber replay position into the dispatcher one.
+func replayPosition(spec *v1alpha1.ReplayPosition) *replay.Position {
+	if spec == nil {
+		return nil
+	}
+
+	pos := &replay.Position{}
+	if spec.Time != nil {
+		pos.Time = spec.Time.Time
+	}
+	if spec.Sequence != nil && *spec.Sequence > 0 {
+		pos.Sequence = uint64(*spec.Sequence)
+	}
+	return pos
+}
+
+// batchConfig converts the subscriber batch spec into the dispatcher batch configuration.
+func batchConfig(spec *v1alpha1.BatchSpec) *batch.Config {
+	if spec == nil {
+		return nil
+	}
+
+	cfg := &batch.Config{
+		MaxSize:        batch.DefaultMaxSize,
+		MaxBytes:       batch.DefaultMaxBytes,
+		MaxLinger:      batch.DefaultMaxLinger,
+		SplitOnFailure: spec.SplitOnFailure,
+	}
+	if spec.MaxSize != nil {
+		cfg.MaxSize = int(*spec.MaxSize)
+	}
+	if spec.MaxBytes != nil {
+		cfg.MaxBytes = spec.MaxBytes.Value()
+	}
+	if spec.MaxLinger != nil {
+		cfg.MaxLinger = spec.MaxLinger.Duration
+	}
+	return cfg
+}
+
+// contentMode converts the subscriber content mode into the dispatcher one.
+func contentMode(mode v1alpha1.ContentMode) delivery.ContentMode {
+	switch mode {
+	case v1alpha1.ContentModeBinary:
+		return delivery.ContentModeBinary
+	case v1alpha1.ContentModeStructured:
+		return delivery.ContentModeStructured
+	default:
+		return delivery.ContentModePassthrough
+	}
+}
+
+// compressionConfig converts the subscriber compression spec into the
+// dispatcher compression configuration.
+func compressionConfig(spec *v1alpha1.CompressionSpec) *compression.Config {
+	if spec == nil {
+		return nil
+	}
+
+	cfg := &compression.Config{
+		Encoding: compression.Gzip,
+		MinSize:  compression.DefaultMinSize,
+	}
+	if spec.Encoding == v1alpha1.CompressionEncodingDeflate {
+		cfg.Encoding = compression.Deflate
+	}
+	if spec.MinSize != nil {
+		cfg.MinSize = int(spec.MinSize.Value())
+	}
+	return cfg
+}
+
+// groupsConfig converts the channel delivery groups into the dispatcher
+// group configuration.
+func groupsConfig(specs []v1alpha1.DeliveryGroup) []group.Config {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	groups := make([]group.Config, 0, len(specs))
+	for _, g := range specs {
+		cfg := group.Config{
+			Name:         g.Name,
+			Strategy:     group.StrategyRoundRobin,
+			PartitionKey: g.PartitionKey,
+		}
+		if g.Strategy != "" {
+			cfg.Strategy = group.Strategy(g.Strategy)
+		}
+		groups = append(groups, cfg)
+	}
+	return groups
+}
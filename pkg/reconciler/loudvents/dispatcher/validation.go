@@ -0,0 +1,76 @@
+/*
+Copyright 2021 TriggerMesh Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"fmt"
+
+	"knative.dev/pkg/controller"
+
+	v1alpha1 "github.com/odacremolbap/loudvents/pkg/apis/messaging/v1alpha1"
+	"github.com/odacremolbap/loudvents/pkg/loudvents/schema"
+)
+
+// validationConfig resolves the channel validation spec into the dispatcher
+// validation configuration, reading schemas from referenced ConfigMaps.
+func (r *Reconciler) validationConfig(lvc *v1alpha1.LoudVentsChannel) (*schema.Config, error) {
+	spec := lvc.Spec.Validation
+	if spec == nil {
+		return nil, nil
+	}
+
+	cfg := &schema.Config{
+		Mode:    schema.ModeEnforce,
+		Schemas: make([]schema.Schema, 0, len(spec.Schemas)),
+	}
+	if spec.Mode == v1alpha1.ValidationModeAudit {
+		cfg.Mode = schema.ModeAudit
+	}
+
+	if spec.InvalidEventsSink != nil {
+		if lvc.Status.InvalidEventsSinkURI == nil {
+			return nil, controller.NewPermanentError(fmt.Errorf("invalid events sink for %s/%s has not been resolved", lvc.Namespace, lvc.Name))
+		}
+		cfg.InvalidEventsSink = lvc.Status.InvalidEventsSinkURI.URL()
+	}
+
+	for i, s := range spec.Schemas {
+		var doc string
+		switch {
+		case s.Inline != nil:
+			doc = string(s.Inline.Raw)
+		case s.ConfigMapKeyRef != nil:
+			var err error
+			if doc, err = r.configMapValue(lvc, s.ConfigMapKeyRef); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, controller.NewPermanentError(fmt.Errorf("schema %d for %s/%s has no document", i, lvc.Namespace, lvc.Name))
+		}
+
+		cfg.Schemas = append(cfg.Schemas, schema.Schema{
+			Type:       s.Type,
+			DataSchema: s.DataSchema,
+			Document:   doc,
+		})
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, controller.NewPermanentError(err)
+	}
+	return cfg, nil
+}